@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/diff"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	port             int
+	scriptURL        string
+	fromVersion      int
+	toVersion        int
+	ignoreWhitespace bool
+	contextLines     int
+	jsonOutput       bool
+)
+
+// result is the response of the diff route
+type result struct {
+	From struct {
+		ID      string `json:"id"`
+		URL     string `json:"url"`
+		Version int    `json:"version"`
+	} `json:"from"`
+	To struct {
+		ID      string `json:"id"`
+		URL     string `json:"url"`
+		Version int    `json:"version"`
+	} `json:"to"`
+	Added   int          `json:"added"`
+	Removed int          `json:"removed"`
+	Unified string       `json:"unified"`
+	Summary diff.Summary `json:"summary"`
+}
+
+// fetchDiff calls the diff route of the running server and returns the raw JSON response
+func fetchDiff(params url.Values) ([]byte, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/api/diff?%s", port, params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("is the server running on port %d? %w", port, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("server returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// printChanges prints the added and removed items of a summary section
+func printChanges(title string, changes diff.Changes) {
+	if len(changes.Added) == 0 && len(changes.Removed) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (+%d -%d)\n", title, len(changes.Added), len(changes.Removed))
+	for _, item := range changes.Added {
+		fmt.Printf("  + %s\n", item)
+	}
+	for _, item := range changes.Removed {
+		fmt.Printf("  - %s\n", item)
+	}
+}
+
+// DiffCmd prints the diff of two scripts stored by a running JSHunter server
+var DiffCmd = &cobra.Command{
+	Use:   "diff [<from-js-file-id> <to-js-file-id>]",
+	Short: "Compare two JavaScript files or two versions of a script",
+	Long: `Print the unified diff of the prettified content of two js_files, followed by
+the string literals and URLs that were added or removed.
+
+Compare two js_files by ID, or two versions of a URL with --url (by default the
+latest version against the one before it).
+
+Like diff(1), the exit status is 0 when the files are equal, 1 when they differ
+and 2 on errors.`,
+	Example: `  jshunter diff 4az9v32ftf0ppk1 s01949k9dr35sw8
+  jshunter diff --url https://example.com/app.js
+  jshunter diff --url https://example.com/app.js --from-version 2 --to-version 5 -w
+  jshunter diff 4az9v32ftf0ppk1 s01949k9dr35sw8 --json | jq .summary.urls.added`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if scriptURL != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		params := url.Values{}
+		if scriptURL != "" {
+			params.Set("url", scriptURL)
+			if fromVersion > 0 {
+				params.Set("from_version", strconv.Itoa(fromVersion))
+			}
+			if toVersion > 0 {
+				params.Set("to_version", strconv.Itoa(toVersion))
+			}
+		} else {
+			params.Set("from", args[0])
+			params.Set("to", args[1])
+		}
+		params.Set("ignore_whitespace", strconv.FormatBool(ignoreWhitespace))
+		params.Set("context", strconv.Itoa(contextLines))
+
+		data, err := fetchDiff(params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error comparing files: %v\n", err)
+			os.Exit(2)
+		}
+
+		var res result
+		if err := json.Unmarshal(data, &res); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid response: %v\n", err)
+			os.Exit(2)
+		}
+
+		if jsonOutput {
+			os.Stdout.Write(data)
+			fmt.Println()
+		} else if res.Unified != "" {
+			fmt.Print(res.Unified)
+			printChanges("Strings", res.Summary.Strings)
+			printChanges("URLs", res.Summary.URLs)
+			fmt.Printf("\n%d lines added, %d lines removed\n", res.Added, res.Removed)
+		}
+
+		if res.Added > 0 || res.Removed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	DiffCmd.Flags().IntVarP(&port, "port", "p", config.DefaultPort, "Port of the running JSHunter server")
+	DiffCmd.Flags().StringVar(&scriptURL, "url", "", "Compare two versions of this script URL")
+	DiffCmd.Flags().IntVar(&fromVersion, "from-version", 0, "Old version of --url (default: the version before --to-version)")
+	DiffCmd.Flags().IntVar(&toVersion, "to-version", 0, "New version of --url (default: the latest version)")
+	DiffCmd.Flags().BoolVarP(&ignoreWhitespace, "ignore-whitespace", "w", false, "Ignore whitespace when comparing lines")
+	DiffCmd.Flags().IntVarP(&contextLines, "context", "U", diff.DefaultContext, "Number of unchanged lines shown around changes")
+	DiffCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the JSON response of the server")
+}
@@ -0,0 +1,191 @@
+package findings
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+var (
+	targetNames    []string
+	category       string
+	findingType    string
+	search         string
+	minTargets     int
+	minOccurrences int
+	limit          int
+	jsonOutput     bool
+)
+
+// maxValueWidth truncates the values printed in the table
+const maxValueWidth = 80
+
+// unique is a unique finding across targets
+type unique struct {
+	Key         string         `json:"key"`
+	Category    string         `json:"category"`
+	Value       string         `json:"value"`
+	Types       []string       `json:"types"`
+	Occurrences int            `json:"occurrences"`
+	Files       int            `json:"files"`
+	Targets     map[string]int `json:"targets"` // Occurrences by target
+}
+
+// loadTarget returns the unique findings of a target, read from its database
+func loadTarget(storageDir string, filter fingerprint.UniqueFilter) ([]fingerprint.Unique, error) {
+	dbPath := filepath.Join(storageDir, "db", "data.db")
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	db, err := core.DefaultDBConnect(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	uniques := []fingerprint.Unique{}
+	if err := fingerprint.UniqueQuery(db, filter).All(&uniques); err != nil {
+		return nil, err
+	}
+	fingerprint.Tidy(uniques)
+	return uniques, nil
+}
+
+// aggregate merges the unique findings of every target by key
+func aggregate(filter fingerprint.UniqueFilter) ([]*unique, []string, error) {
+	names := targetNames
+	if len(names) == 0 {
+		for name := range config.GlobalConfig.Targets {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	byKey := make(map[string]*unique)
+	var read []string
+	for _, name := range names {
+		target, ok := config.GlobalConfig.Targets[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown target %q", name)
+		}
+		uniques, err := loadTarget(target.StorageDir, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping target %s: %v\n", name, err)
+			continue
+		}
+		read = append(read, name)
+
+		for _, u := range uniques {
+			merged, ok := byKey[u.Key]
+			if !ok {
+				merged = &unique{Key: u.Key, Category: u.Category, Value: u.Value, Targets: make(map[string]int)}
+				byKey[u.Key] = merged
+			}
+			for _, t := range u.Types {
+				if !slices.Contains(merged.Types, t) {
+					merged.Types = append(merged.Types, t)
+				}
+			}
+			merged.Occurrences += u.Occurrences
+			merged.Files += u.Files
+			merged.Targets[name] += u.Occurrences
+		}
+	}
+
+	var result []*unique
+	for _, u := range byKey {
+		if len(u.Targets) >= minTargets {
+			result = append(result, u)
+		}
+	}
+	slices.SortFunc(result, func(a, b *unique) int {
+		if len(a.Targets) != len(b.Targets) {
+			return len(b.Targets) - len(a.Targets)
+		}
+		if a.Occurrences != b.Occurrences {
+			return b.Occurrences - a.Occurrences
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, read, nil
+}
+
+// FindingsCmd prints the unique findings of one or more targets
+var FindingsCmd = &cobra.Command{
+	Use:   "findings",
+	Short: "List unique findings across targets",
+	Long: `List the unique findings of the configured targets: findings sharing a category
+and a normalized value are counted once, whatever the script or target they were
+found in. Findings shared by several targets come first.
+
+The databases of the targets are read directly, so the servers do not need to run.
+Findings stored by older versions are keyed the next time their target starts.`,
+	Example: `  jshunter findings
+  jshunter findings --targets acme,acme-staging --min-targets 2
+  jshunter findings --category httpapi --search /api/ --json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config.LoadConfig()
+
+		filter := fingerprint.UniqueFilter{
+			Category:       category,
+			Type:           findingType,
+			Search:         search,
+			MinOccurrences: minOccurrences,
+		}
+		uniques, read, err := aggregate(filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing findings: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			data, _ := json.MarshalIndent(map[string]any{"targets": read, "items": uniques}, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		if len(uniques) == 0 {
+			fmt.Println("No findings")
+			return
+		}
+		fmt.Printf("%-10s %-8s %-6s %-30s %s\n", "CATEGORY", "COUNT", "FILES", "TARGETS", "VALUE")
+		fmt.Println(strings.Repeat("-", 100))
+		for _, u := range uniques {
+			targets := make([]string, 0, len(u.Targets))
+			for name := range u.Targets {
+				targets = append(targets, name)
+			}
+			slices.Sort(targets)
+
+			value := u.Value
+			if len(value) > maxValueWidth {
+				value = value[:maxValueWidth-3] + "..."
+			}
+			fmt.Printf("%-10s %-8d %-6d %-30s %s\n", u.Category, u.Occurrences, u.Files, strings.Join(targets, ","), value)
+		}
+	},
+}
+
+func init() {
+	FindingsCmd.Flags().StringSliceVar(&targetNames, "targets", nil, "Targets to read (default: every configured target)")
+	FindingsCmd.Flags().StringVar(&category, "category", "", "Only findings of this category")
+	FindingsCmd.Flags().StringVar(&findingType, "type", "", "Only findings of this type")
+	FindingsCmd.Flags().StringVar(&search, "search", "", "Only findings whose value contains this text")
+	FindingsCmd.Flags().IntVar(&minTargets, "min-targets", 1, "Only findings found in at least this many targets")
+	FindingsCmd.Flags().IntVar(&minOccurrences, "min-occurrences", 1, "Only findings found at least this many times in a target")
+	FindingsCmd.Flags().IntVar(&limit, "limit", 100, "Maximum number of findings printed, 0 for all")
+	FindingsCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the findings as JSON")
+}
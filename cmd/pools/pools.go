@@ -0,0 +1,176 @@
+package pools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/spf13/cobra"
+)
+
+var port int
+
+// callAPI sends a request to the running JSHunter server and decodes the JSON response
+func callAPI(method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", port, path), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("is the server running on port %d? %w", port, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("server returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+func printStats(stats []pool.Stats) {
+	fmt.Printf("%-12s %-8s %-8s %-8s %-8s %-20s %-10s %s\n", "STAGE", "STATE", "WORKERS", "ACTIVE", "QUEUED", "LANES (H/N/L/B)", "CAPACITY", "PROCESSED")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, s := range stats {
+		state := "running"
+		if !s.Running {
+			state = "stopped"
+		} else if s.Paused {
+			state = "paused"
+		}
+		lanes := make([]string, 0, len(pool.PriorityValues))
+		for _, priority := range pool.PriorityValues {
+			lanes = append(lanes, strconv.Itoa(s.Lanes[priority]))
+		}
+		fmt.Printf("%-12s %-8s %-8d %-8d %-8d %-20s %-10d %d\n", s.Name, state, s.Workers, s.Active, s.Queued, strings.Join(lanes, "/"), s.Capacity, s.Processed)
+	}
+}
+
+// runStageAction calls a pool control route for a stage and prints the resulting state
+func runStageAction(action string, stage string, body any) {
+	var stats pool.Stats
+	if action == "drain" {
+		var result struct {
+			Drained int        `json:"drained"`
+			Pool    pool.Stats `json:"pool"`
+		}
+		if err := callAPI(http.MethodPost, "/api/pools/"+stage+"/drain", nil, &result); err != nil {
+			fmt.Printf("Error draining %s: %v\n", stage, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Drained %d queued jobs from %s\n\n", result.Drained, stage)
+		stats = result.Pool
+	} else if err := callAPI(http.MethodPost, "/api/pools/"+stage+"/"+action, body, &stats); err != nil {
+		fmt.Printf("Error running %s on %s: %v\n", action, stage, err)
+		os.Exit(1)
+	}
+
+	printStats([]pool.Stats{stats})
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Show the state of every stage worker pool",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var stats []pool.Stats
+		if err := callAPI(http.MethodGet, "/api/pools", nil, &stats); err != nil {
+			fmt.Printf("Error listing pools: %v\n", err)
+			os.Exit(1)
+		}
+		printStats(stats)
+	},
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause <stage>",
+	Short: "Stop a stage from picking up new jobs",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStageAction("pause", args[0], nil)
+	},
+}
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume <stage>",
+	Short: "Resume a paused stage",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStageAction("resume", args[0], nil)
+	},
+}
+
+var resizeCmd = &cobra.Command{
+	Use:   "resize <stage> <workers>",
+	Short: "Change the number of workers of a stage",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		workers, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Printf("Invalid worker count %q\n", args[1])
+			os.Exit(1)
+		}
+		runStageAction("resize", args[0], map[string]int{"workers": workers})
+	},
+}
+
+var drainCmd = &cobra.Command{
+	Use:   "drain <stage>",
+	Short: "Remove every queued job of a stage",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runStageAction("drain", args[0], nil)
+	},
+}
+
+// PoolsCmd groups the runtime controls of a running JSHunter server
+var PoolsCmd = &cobra.Command{
+	Use:   "pools",
+	Short: "Control the worker pools of a running JSHunter server",
+	Long: `Inspect and control the stage worker pools (extraction, prettify, sourcemap,
+analysis, dechunker) of a running JSHunter server.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		listCmd.Run(cmd, args)
+	},
+}
+
+func init() {
+	PoolsCmd.PersistentFlags().IntVarP(&port, "port", "p", config.DefaultPort, "Port of the running JSHunter server")
+
+	PoolsCmd.AddCommand(listCmd)
+	PoolsCmd.AddCommand(pauseCmd)
+	PoolsCmd.AddCommand(resumeCmd)
+	PoolsCmd.AddCommand(resizeCmd)
+	PoolsCmd.AddCommand(drainCmd)
+}
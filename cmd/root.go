@@ -2,9 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/jsh-team/jshunter/cmd/diff"
+	"github.com/jsh-team/jshunter/cmd/findings"
+	"github.com/jsh-team/jshunter/cmd/pools"
 	"github.com/jsh-team/jshunter/cmd/start"
 	"github.com/jsh-team/jshunter/cmd/targets"
+	"github.com/jsh-team/jshunter/cmd/worker"
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -55,9 +61,31 @@ func init() {
 	targetsCmd := targets.TargetsCmd
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(targetsCmd)
+	rootCmd.AddCommand(pools.PoolsCmd)
+	rootCmd.AddCommand(worker.WorkerCmd)
+	rootCmd.AddCommand(diff.DiffCmd)
+	rootCmd.AddCommand(findings.FindingsCmd)
 	rootCmd.AddCommand(versionCmd)
+
+	rootCmd.PersistentFlags().StringVar(&config.LogLevel, "log-level", config.LogLevel, "Log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&config.LogFormat, "log-format", config.LogFormat, "Log format: console or json")
+	rootCmd.PersistentFlags().StringVar(&config.LogFile, "log-file", "", "Also write logs to this file, rotated by size")
+	rootCmd.PersistentFlags().IntVar(&config.LogMaxSize, "log-max-size", config.LogMaxSize, "Size in MB at which the log file is rotated")
+	rootCmd.PersistentFlags().IntVar(&config.LogMaxBackups, "log-max-backups", config.LogMaxBackups, "Number of rotated log files to keep")
 }
 
 func initConfig() {
+	err := logger.Configure(logger.Options{
+		Level:      config.LogLevel,
+		Format:     config.LogFormat,
+		File:       config.LogFile,
+		MaxSizeMB:  config.LogMaxSize,
+		MaxBackups: config.LogMaxBackups,
+	})
+	if err != nil {
+		fmt.Printf("Invalid logging options: %v\n", err)
+		os.Exit(1)
+	}
+
 	config.LoadConfig()
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/jsh-team/jshunter/internal/config"
 	"github.com/jsh-team/jshunter/internal/db"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
 )
 
 var (
@@ -21,6 +22,11 @@ var StartCmd = &cobra.Command{
 	Short: "Start JSHunter server",
 	Long:  `Start JSHunter server`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if err := extraction.ValidateSettle(config.SettleStrategy, config.SettlePredicate); err != nil {
+			fmt.Printf("Invalid settle configuration: %v\n", err)
+			os.Exit(1)
+		}
+
 		config.InitializeBinaryPaths()
 		if err := config.RunInstallationSteps(); err != nil {
 			fmt.Printf("Installation failed: %v\n", err)
@@ -92,6 +98,18 @@ func customHelpFunc(cmd *cobra.Command, args []string) {
 
 		fmt.Printf("   --%s%s %s    %s%s\n", flag.Name, short, flag.Value.Type(), flag.Usage, defaultVal)
 	})
+
+	fmt.Println("")
+	fmt.Println("LOGGING:")
+
+	cmd.InheritedFlags().VisitAll(func(flag *pflag.Flag) {
+		defaultVal := ""
+		if flag.DefValue != "" && flag.DefValue != "false" {
+			defaultVal = fmt.Sprintf(" (default %s)", flag.DefValue)
+		}
+
+		fmt.Printf("   --%s %s    %s%s\n", flag.Name, flag.Value.Type(), flag.Usage, defaultVal)
+	})
 }
 
 func init() {
@@ -103,21 +121,55 @@ func init() {
 	StartCmd.Flags().StringVarP(&config.Target, "target", "t", "", "Target Name")
 	StartCmd.Flags().StringVarP(&storageDir, "storage-dir", "s", "", "Storage directory for target data")
 	StartCmd.Flags().BoolVar(&config.MobileExtractionEnabled, "mobile", false, "Enable mobile extraction")
+	StartCmd.Flags().BoolVar(&config.GitSnapshotsEnabled, "git-snapshots", false, "Commit the scripts and recovered sources of every extraction run to a git repository in the storage directory")
 	StartCmd.Flags().BoolVar(&config.ForceInstallation, "force", false, "Force installation")
+	StartCmd.Flags().StringVar(&config.BindAddress, "bind", config.BindAddress, "Interface to listen on (use 0.0.0.0 to accept remote workers)")
+	StartCmd.Flags().StringVar(&config.WorkerToken, "worker-token", os.Getenv("JSHUNTER_WORKER_TOKEN"), "Shared token of remote workers (env JSHUNTER_WORKER_TOKEN), disabled when empty")
+	StartCmd.Flags().IntVar(&config.ShutdownTimeout, "shutdown-timeout", config.ShutdownTimeout, "Seconds to wait for in-flight jobs on shutdown before cancelling them")
 
 	// Concurrency configuration flags
-	StartCmd.Flags().IntVarP(&config.MaxConcurrentBrowsers, "concurrent-browsers", "b", config.MaxConcurrentBrowsers, "Maximum concurrent browser instances for extraction")
+	StartCmd.Flags().IntVarP(&config.MaxConcurrentBrowsers, "concurrent-browsers", "b", config.MaxConcurrentBrowsers, "Maximum concurrent extractions, as pages of the pooled browsers")
 	StartCmd.Flags().IntVarP(&config.MaxConcurrentPrettify, "concurrent-prettify", "r", config.MaxConcurrentPrettify, "Maximum concurrent prettify workers")
 	StartCmd.Flags().IntVarP(&config.MaxConcurrentSourcemaps, "concurrent-sourcemaps", "m", config.MaxConcurrentSourcemaps, "Maximum concurrent sourcemap workers")
 	StartCmd.Flags().IntVarP(&config.MaxConcurrentAnalysis, "concurrent-analysis", "a", config.MaxConcurrentAnalysis, "Maximum concurrent analysis workers")
 	StartCmd.Flags().IntVarP(&config.MaxConcurrentDechunker, "concurrent-dechunker", "d", config.MaxConcurrentDechunker, "Maximum concurrent dechunker workers")
 
+	// Browser pool flags
+	StartCmd.Flags().IntVar(&config.BrowserPagesPerProcess, "browser-pages", config.BrowserPagesPerProcess, "Pages open at the same time in one browser process")
+	StartCmd.Flags().IntVar(&config.BrowserRecycleAfter, "browser-recycle", config.BrowserRecycleAfter, "Pages served by a browser process before it is replaced, 0 to never replace")
+	StartCmd.Flags().IntVar(&config.BrowserMaxMemoryMB, "browser-max-memory", config.BrowserMaxMemoryMB, "Memory in MB of a browser process and its renderers above which it is replaced, 0 for no limit")
+
+	// Page settle flags
+	StartCmd.Flags().StringVar(&config.SettleStrategy, "settle", config.SettleStrategy, "When a page is extracted: fixed, load, networkidle, dom or script")
+	StartCmd.Flags().IntVar(&config.SettleIdleTime, "settle-idle", config.SettleIdleTime, "Milliseconds without requests (networkidle) or DOM changes (dom) before a page is settled")
+	StartCmd.Flags().IntVar(&config.SettleMaxWait, "settle-max-wait", config.SettleMaxWait, "Seconds a page may take to settle before it is extracted anyway")
+	StartCmd.Flags().StringVar(&config.SettlePredicate, "settle-predicate", config.SettlePredicate, "JavaScript expression true once the page is settled (script strategy)")
+
+	// Per-job timeout flags (seconds, 0 disables the timeout)
+	StartCmd.Flags().IntVar(&config.BrowserWorkerTimeout, "timeout-extraction", config.BrowserWorkerTimeout, "Timeout in seconds for a single extraction job")
+	StartCmd.Flags().IntVar(&config.PrettifyTimeout, "timeout-prettify", config.PrettifyTimeout, "Timeout in seconds for a single prettify job")
+	StartCmd.Flags().IntVar(&config.SourcemapTimeout, "timeout-sourcemap", config.SourcemapTimeout, "Timeout in seconds for a single sourcemap job")
+	StartCmd.Flags().IntVar(&config.AnalysisTimeout, "timeout-analysis", config.AnalysisTimeout, "Timeout in seconds for a single analysis job")
+	StartCmd.Flags().IntVar(&config.DechunkerTimeout, "timeout-dechunker", config.DechunkerTimeout, "Timeout in seconds for a single dechunker job")
+
 	// Group flags using annotations for custom help formatting
 	StartCmd.Flags().Lookup("concurrent-browsers").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
 	StartCmd.Flags().Lookup("concurrent-prettify").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
 	StartCmd.Flags().Lookup("concurrent-sourcemaps").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
 	StartCmd.Flags().Lookup("concurrent-analysis").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
 	StartCmd.Flags().Lookup("concurrent-dechunker").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("browser-pages").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("browser-recycle").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("browser-max-memory").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("settle").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("settle-idle").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("settle-max-wait").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("settle-predicate").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("timeout-extraction").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("timeout-prettify").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("timeout-sourcemap").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("timeout-analysis").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
+	StartCmd.Flags().Lookup("timeout-dechunker").Annotations = map[string][]string{"group": {"OPTIMIZATION"}}
 
 	StartCmd.MarkFlagRequired("target")
 }
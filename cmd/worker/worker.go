@@ -0,0 +1,111 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/remote"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	server      string
+	token       string
+	workerID    string
+	stages      string
+	concurrency int
+)
+
+// WorkerCmd runs extraction and analysis jobs for a JSHunter server on this machine
+var WorkerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Process jobs of a remote JSHunter server",
+	Long: `Lease extraction and analysis jobs from a JSHunter server started with
+--bind 0.0.0.0 --worker-token TOKEN, run them on this machine and upload the results.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if server == "" {
+			fmt.Println("Missing --server")
+			os.Exit(1)
+		}
+		if token == "" {
+			fmt.Println("Missing --token (or JSHUNTER_WORKER_TOKEN)")
+			os.Exit(1)
+		}
+
+		var selected []string
+		for _, stage := range strings.Split(stages, ",") {
+			stage = strings.TrimSpace(stage)
+			if stage == "" {
+				continue
+			}
+			if !slices.Contains(remote.Stages, stage) {
+				fmt.Printf("Stage %q cannot run on remote workers (supported: %s)\n", stage, strings.Join(remote.Stages, ", "))
+				os.Exit(1)
+			}
+			selected = append(selected, stage)
+		}
+		if len(selected) == 0 {
+			fmt.Println("No stages selected")
+			os.Exit(1)
+		}
+		if err := extraction.ValidateSettle(config.SettleStrategy, config.SettlePredicate); err != nil {
+			fmt.Printf("Invalid settle configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		// The analyzer binary is needed locally to run analysis jobs
+		if slices.Contains(selected, remote.StageAnalysis) {
+			config.InitializeBinaryPaths()
+			if err := config.RunInstallationSteps(); err != nil {
+				fmt.Printf("Installation failed: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if workerID == "" {
+			hostname, _ := os.Hostname()
+			workerID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+
+		// First Ctrl-C hands the running jobs back, a second one quits immediately
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
+		logger.Info("Worker %s processing %s jobs from %s", workerID, strings.Join(selected, ", "), server)
+		remote.NewWorker(remote.WorkerOptions{
+			Server:      server,
+			Token:       token,
+			WorkerID:    workerID,
+			Stages:      selected,
+			Concurrency: concurrency,
+		}).Run(ctx)
+		extraction.CloseBrowsers()
+		logger.Info("Worker %s stopped", workerID)
+	},
+}
+
+func init() {
+	WorkerCmd.Flags().StringVar(&server, "server", "", "URL of the JSHunter server, e.g. http://10.0.0.1:20450")
+	WorkerCmd.Flags().StringVar(&token, "token", os.Getenv("JSHUNTER_WORKER_TOKEN"), "Worker token of the server (env JSHUNTER_WORKER_TOKEN)")
+	WorkerCmd.Flags().StringVar(&workerID, "id", "", "Worker name shown on the server (default hostname-pid)")
+	WorkerCmd.Flags().StringVar(&stages, "stages", strings.Join(remote.Stages, ","), "Comma separated stages to process")
+	WorkerCmd.Flags().IntVarP(&concurrency, "concurrency", "c", 2, "Number of jobs processed at the same time")
+	WorkerCmd.Flags().StringVar(&config.SettleStrategy, "settle", config.SettleStrategy, "When a page is extracted: fixed, load, networkidle, dom or script")
+	WorkerCmd.Flags().IntVar(&config.SettleIdleTime, "settle-idle", config.SettleIdleTime, "Milliseconds without requests (networkidle) or DOM changes (dom) before a page is settled")
+	WorkerCmd.Flags().IntVar(&config.SettleMaxWait, "settle-max-wait", config.SettleMaxWait, "Seconds a page may take to settle before it is extracted anyway")
+	WorkerCmd.Flags().StringVar(&config.SettlePredicate, "settle-predicate", config.SettlePredicate, "JavaScript expression true once the page is settled (script strategy)")
+}
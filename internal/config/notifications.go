@@ -0,0 +1,47 @@
+package config
+
+// Notification channel types
+const (
+	ChannelWebhook = "webhook" // Generic JSON webhook, signed with HMAC-SHA256 when a secret is set
+	ChannelSlack   = "slack"   // Slack incoming webhook
+	ChannelDiscord = "discord" // Discord incoming webhook
+	ChannelEmail   = "email"   // Email sent through the PocketBase mailer (SMTP settings of the target)
+)
+
+// Severities of findings, lowest first
+var Severities = []string{"info", "low", "medium", "high", "critical"}
+
+// NotificationsConfig describes where and when to send notifications about findings and changes
+type NotificationsConfig struct {
+	Channels []ChannelConfig          `mapstructure:"channels" yaml:"channels,omitempty" json:"channels,omitempty"`
+	Rules    []NotificationRuleConfig `mapstructure:"rules" yaml:"rules,omitempty" json:"rules,omitempty"`
+
+	// Events matched within this window are sent together, 60 seconds by default
+	BatchWindow int `mapstructure:"batch_window" yaml:"batch_window,omitempty" json:"batch_window,omitempty"`
+	// Events listed in a chat or email message, the others are only counted; 50 by default.
+	// The generic webhook receives every event of the batch.
+	MaxBatch int `mapstructure:"max_batch" yaml:"max_batch,omitempty" json:"max_batch,omitempty"`
+}
+
+// ChannelConfig is a destination of notifications
+type ChannelConfig struct {
+	Name       string   `mapstructure:"name" yaml:"name" json:"name"`
+	Type       string   `mapstructure:"type" yaml:"type" json:"type"`                                             // webhook, slack, discord or email
+	URL        string   `mapstructure:"url" yaml:"url,omitempty" json:"url,omitempty"`                            // Webhook URL
+	Secret     string   `mapstructure:"secret" yaml:"secret,omitempty" json:"-"`                                  // HMAC key of the generic webhook
+	To         []string `mapstructure:"to" yaml:"to,omitempty" json:"to,omitempty"`                               // Email recipients
+	MaxPerHour int      `mapstructure:"max_per_hour" yaml:"max_per_hour,omitempty" json:"max_per_hour,omitempty"` // Messages per hour, 0 for no limit
+}
+
+// NotificationRuleConfig selects the events sent to channels. Empty lists match everything.
+type NotificationRuleConfig struct {
+	Name        string   `mapstructure:"name" yaml:"name" json:"name"`
+	Channels    []string `mapstructure:"channels" yaml:"channels" json:"channels"`
+	Events      []string `mapstructure:"events" yaml:"events,omitempty" json:"events,omitempty"`             // finding.created by default
+	Categories  []string `mapstructure:"categories" yaml:"categories,omitempty" json:"categories,omitempty"` // Finding categories
+	Types       []string `mapstructure:"types" yaml:"types,omitempty" json:"types,omitempty"`                // Finding types
+	Domains     []string `mapstructure:"domains" yaml:"domains,omitempty" json:"domains,omitempty"`          // A domain also matches its subdomains
+	MinSeverity string   `mapstructure:"min_severity" yaml:"min_severity,omitempty" json:"min_severity,omitempty"`
+	// Findings already seen in an earlier build of the script are skipped unless set
+	IncludeRepeats bool `mapstructure:"include_repeats" yaml:"include_repeats,omitempty" json:"include_repeats,omitempty"`
+}
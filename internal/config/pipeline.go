@@ -0,0 +1,38 @@
+package config
+
+// StageConfig describes one stage of the processing pipeline.
+// A stage runs on the records of a collection once every stage it depends on
+// reached the trigger status. Its state is kept in the "<name>_status" field.
+type StageConfig struct {
+	Name       string   `mapstructure:"name" yaml:"name" json:"name"`
+	Collection string   `mapstructure:"collection" yaml:"collection" json:"collection"`
+	DependsOn  []string `mapstructure:"depends_on" yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	Trigger    string   `mapstructure:"trigger" yaml:"trigger,omitempty" json:"trigger,omitempty"`          // Status the dependencies must reach, "processed" by default
+	Pool       string   `mapstructure:"pool" yaml:"pool,omitempty" json:"pool,omitempty"`                   // Worker pool running the stage, the stage name by default
+	Disabled   bool     `mapstructure:"disabled" yaml:"disabled,omitempty" json:"disabled,omitempty"`       // Disabled stages are skipped and satisfy their dependents
+	SkipTypes  []string `mapstructure:"skip_types" yaml:"skip_types,omitempty" json:"skip_types,omitempty"` // Record types marked as processed without running the stage
+
+	// Custom stages only: external command run on the stored file of the record.
+	// The placeholders {file}, {url}, {id} and {collection} are replaced in every argument.
+	Command []string `mapstructure:"command" yaml:"command,omitempty" json:"command,omitempty"`
+	Workers int      `mapstructure:"workers" yaml:"workers,omitempty" json:"workers,omitempty"`
+	Timeout int      `mapstructure:"timeout" yaml:"timeout,omitempty" json:"timeout,omitempty"` // Seconds, 0 uses the default of 300
+}
+
+// DefaultPipeline is the built-in stage graph used when the config file has no pipeline section
+var DefaultPipeline = []StageConfig{
+	{Name: "extraction", Collection: "endpoints"},
+	{Name: "prettify", Collection: "endpoints", DependsOn: []string{"extraction"}},
+	{Name: "prettify", Collection: "js_files"},
+	{Name: "sourcemap", Collection: "js_files"},
+	{Name: "analysis", Collection: "js_files", DependsOn: []string{"prettify"}},
+	{Name: "dechunker", Collection: "js_files", DependsOn: []string{"prettify"}, SkipTypes: []string{"inline", "chunk"}},
+}
+
+// GetPipeline returns the configured pipeline, or the default one when none is configured
+func GetPipeline() []StageConfig {
+	if len(GlobalConfig.Pipeline) > 0 {
+		return GlobalConfig.Pipeline
+	}
+	return DefaultPipeline
+}
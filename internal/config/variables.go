@@ -19,28 +19,61 @@ var (
 	ForceInstallation    bool
 
 	// Browser worker pool configuration (extraction)
-	MaxConcurrentBrowsers = 4   // Maximum concurrent browser instances
+	MaxConcurrentBrowsers = 4   // Maximum concurrent extractions, pages shared by the pooled browsers
 	BrowserWorkerTimeout  = 90  // Timeout in seconds for browser processing
 	QueueBufferSize       = 100 // Size of extraction processing queue buffer
 
+	// Browser pool configuration (extraction)
+	BrowserPagesPerProcess = 4    // Pages open at the same time in one browser process
+	BrowserRecycleAfter    = 200  // Pages served by a browser process before it is replaced, 0 to never replace
+	BrowserMaxMemoryMB     = 2048 // Memory of a browser process and its renderers above which it is replaced, 0 for no limit
+	BrowserIdleTimeout     = 300  // Seconds an unused browser process is kept running
+
+	// Page settling configuration (extraction)
+	SettleStrategy  = "networkidle" // fixed, load, networkidle, dom or script
+	SettleIdleTime  = 500           // Milliseconds without requests (networkidle) or DOM changes (dom) before a page is settled
+	SettleMaxWait   = 15            // Seconds a page may take to settle before it is extracted anyway
+	SettlePredicate string          // JavaScript expression true once the page is settled (script)
+
 	// Prettify worker pool configuration
 	MaxConcurrentPrettify = 8   // Maximum concurrent prettify workers (CPU intensive)
 	PrettifyQueueSize     = 400 // Size of prettify processing queue buffer
+	PrettifyTimeout       = 300 // Timeout in seconds for a single prettify job
 
 	// Sourcemap worker pool configuration
 	MaxConcurrentSourcemaps = 4   // Maximum concurrent sourcemap workers (I/O intensive)
 	SourcemapQueueSize      = 400 // Size of sourcemap processing queue buffer
+	SourcemapTimeout        = 120 // Timeout in seconds for a single sourcemap job
 
 	// Analysis worker pool configuration
 	MaxConcurrentAnalysis = 6   // Maximum concurrent analysis workers (CPU intensive)
 	AnalysisQueueSize     = 400 // Size of analysis processing queue buffer
+	AnalysisTimeout       = 300 // Timeout in seconds for a single analysis job
 
 	// Dechunker worker pool configuration
 	MaxConcurrentDechunker = 4   // Maximum concurrent dechunker workers (CPU intensive)
 	DechunkerQueueSize     = 400 // Size of dechunker processing queue buffer
+	DechunkerTimeout       = 300 // Timeout in seconds for a single dechunker job (chunk downloads included)
+
+	// Remote worker configuration
+	BindAddress = "localhost" // Interface the server listens on, use 0.0.0.0 to accept remote workers
+	WorkerToken string        // Shared secret of remote workers, remote workers are disabled when empty
+
+	// Shutdown configuration
+	ShutdownTimeout = 30 // Seconds to wait for in-flight jobs before cancelling them on shutdown
+
+	// Logging configuration
+	LogLevel      = "info"    // debug, info, warn or error
+	LogFormat     = "console" // console or json
+	LogFile       string      // Rotating log file written in addition to stderr, disabled when empty
+	LogMaxSize    = 100       // Size in MB at which the log file is rotated
+	LogMaxBackups = 5         // Number of rotated log files kept
 
 	// Mobile extraction configuration
 	MobileExtractionEnabled = false // Whether mobile extraction is enabled
+
+	// Git snapshot configuration
+	GitSnapshotsEnabled = false // Whether extraction runs are committed to a git repository in the storage directory
 )
 
 var DefaultConfig = Config{
@@ -54,6 +87,12 @@ type Config struct {
 	MaxConcurrentBrowsers int `mapstructure:"max_concurrent_browsers" yaml:"max_concurrent_browsers"`
 	WorkerPoolSize        int `mapstructure:"worker_pool_size" yaml:"worker_pool_size"`
 	BrowserTimeout        int `mapstructure:"browser_timeout" yaml:"browser_timeout"`
+
+	// Processing pipeline, DefaultPipeline when empty
+	Pipeline []StageConfig `mapstructure:"pipeline" yaml:"pipeline,omitempty"`
+
+	// Notification channels and rules, no notifications when empty
+	Notifications NotificationsConfig `mapstructure:"notifications" yaml:"notifications,omitempty"`
 }
 
 type TargetConfig struct {
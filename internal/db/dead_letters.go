@@ -0,0 +1,143 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+	"github.com/jsh-team/jshunter/internal/workers/prettify"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerDeadLetterRoutes registers the routes used to triage permanently failed jobs
+func registerDeadLetterRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/dead-letters", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+
+		filter := "id != ''"
+		params := dbx.Params{}
+		if stage := query.Get("stage"); stage != "" {
+			filter += " && stage = {:stage}"
+			params["stage"] = stage
+		}
+		status := query.Get("status")
+		if status == "" {
+			status = deadletter.StatusOpen
+		}
+		if status != "all" {
+			filter += " && status = {:status}"
+			params["status"] = status
+		}
+
+		page, perPage := parsePagination(c)
+		records, err := app.FindRecordsByFilter(deadletter.CollectionName, filter, "-updated_at", perPage, (page-1)*perPage, params)
+		if err != nil {
+			return c.InternalServerError("Failed to list dead letters", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":    page,
+			"perPage": perPage,
+			"items":   records,
+		})
+	})
+
+	se.Router.GET("/api/dead-letters/{id}", func(c *core.RequestEvent) error {
+		deadLetter, err := app.FindRecordById(deadletter.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Dead letter not found", err)
+		}
+
+		// Include the failed record itself so it can be inspected in one request
+		data := map[string]any{
+			"dead_letter": deadLetter,
+		}
+		if record, err := app.FindRecordById(deadLetter.GetString("record_collection"), deadLetter.GetString("record_id")); err == nil {
+			data["record"] = record
+		}
+
+		return c.JSON(http.StatusOK, data)
+	})
+
+	se.Router.POST("/api/dead-letters/{id}/requeue", func(c *core.RequestEvent) error {
+		deadLetter, err := app.FindRecordById(deadletter.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Dead letter not found", err)
+		}
+
+		if err := requeueDeadLetter(app, deadLetter); err != nil {
+			return c.BadRequestError("Failed to requeue dead letter", err)
+		}
+
+		return c.JSON(http.StatusOK, deadLetter)
+	})
+
+	se.Router.DELETE("/api/dead-letters/{id}", func(c *core.RequestEvent) error {
+		deadLetter, err := app.FindRecordById(deadletter.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Dead letter not found", err)
+		}
+
+		if err := app.Delete(deadLetter); err != nil {
+			return c.InternalServerError("Failed to discard dead letter", err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	})
+}
+
+// requeueDeadLetter resets the failed record status and submits it again to its stage.
+// The status is put back when the job cannot be queued.
+func requeueDeadLetter(app *pocketbase.PocketBase, deadLetter *core.Record) error {
+	stage := deadLetter.GetString("stage")
+
+	record, err := app.FindRecordById(deadLetter.GetString("record_collection"), deadLetter.GetString("record_id"))
+	if err != nil {
+		return fmt.Errorf("failed record no longer exists: %w", err)
+	}
+
+	// Prettify keeps the exact file that failed (desktop or mobile HTML)
+	filePath := deadLetter.GetString("input_path")
+	keepFile := stage == "prettify" && filePath != ""
+	var pipelineStage *pipeline.Stage
+	if !keepFile {
+		if pipelineStage, err = pipeline.Find(record.Collection().Name, stage); err != nil {
+			return err
+		}
+	}
+
+	statusField := stage + "_status"
+	previousStatus := record.GetString(statusField)
+	record.Set(statusField, "processing")
+	if err := app.Save(record); err != nil {
+		return fmt.Errorf("failed to reset %s status: %w", stage, err)
+	}
+
+	if keepFile {
+		fileType := "js"
+		if record.Collection().Name == "endpoints" {
+			fileType = "html"
+		}
+		err = prettify.AddPrettifyJob(app, record, filePath, fileType)
+	} else {
+		err = pipelineStage.Submit(app, record, pool.RecordPriority(record))
+	}
+	if err != nil {
+		record.Set(statusField, previousStatus)
+		if saveErr := app.UnsafeWithoutHooks().Save(record); saveErr != nil {
+			logger.Error("Failed to restore %s of %s: %v", statusField, record.Id, saveErr)
+		}
+		return err
+	}
+
+	deadLetter.Set("status", deadletter.StatusRequeued)
+	deadLetter.Set("updated_at", time.Now())
+	return app.Save(deadLetter)
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/diff"
+	"github.com/jsh-team/jshunter/internal/workers/jsversion"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// diffSide describes one of the compared scripts
+type diffSide struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	Hash       string `json:"hash"`
+	Version    int    `json:"version,omitempty"`
+	Prettified bool   `json:"prettified"`
+
+	content string
+}
+
+// diffResponse is the comparison of two scripts
+type diffResponse struct {
+	From             diffSide     `json:"from"`
+	To               diffSide     `json:"to"`
+	IgnoreWhitespace bool         `json:"ignore_whitespace"`
+	Added            int          `json:"added"`
+	Removed          int          `json:"removed"`
+	Unified          string       `json:"unified"`
+	Summary          diff.Summary `json:"summary"`
+}
+
+// loadDiffSide reads the stored, prettified once the prettify stage ran, content of a js_file
+func loadDiffSide(app *pocketbase.PocketBase, jsFileID string, version int) (diffSide, error) {
+	record, err := app.FindRecordById("js_files", jsFileID)
+	if err != nil {
+		return diffSide{}, fmt.Errorf("js_file %s not found", jsFileID)
+	}
+
+	filePath, err := storage.GetJSFilePath(record.GetString("url"), record.GetString("hash"))
+	if err != nil {
+		return diffSide{}, fmt.Errorf("failed to locate js_file %s: %w", jsFileID, err)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return diffSide{}, fmt.Errorf("failed to read js_file %s: %w", jsFileID, err)
+	}
+
+	return diffSide{
+		ID:         record.Id,
+		URL:        record.GetString("url"),
+		Hash:       record.GetString("hash"),
+		Version:    version,
+		Prettified: record.GetString("prettify_status") == "processed",
+		content:    string(content),
+	}, nil
+}
+
+// resolveVersions returns the js_files of two versions of a URL. The new version defaults
+// to the latest one and the old version to the one before it.
+func resolveVersions(app *pocketbase.PocketBase, url string, fromVersion int, toVersion int) (string, string, int, int, error) {
+	versions, err := jsversion.List(app, url)
+	if err != nil || len(versions) == 0 {
+		return "", "", 0, 0, fmt.Errorf("no versions of %s", url)
+	}
+
+	if toVersion == 0 {
+		toVersion = versions[0].GetInt("version")
+	}
+	if fromVersion == 0 {
+		fromVersion = toVersion - 1
+	}
+
+	jsFiles := make(map[int]string, len(versions))
+	for _, version := range versions {
+		jsFiles[version.GetInt("version")] = version.GetString("js_file")
+	}
+	fromID, ok := jsFiles[fromVersion]
+	if !ok {
+		return "", "", 0, 0, fmt.Errorf("version %d of %s not found", fromVersion, url)
+	}
+	toID, ok := jsFiles[toVersion]
+	if !ok {
+		return "", "", 0, 0, fmt.Errorf("version %d of %s not found", toVersion, url)
+	}
+	return fromID, toID, fromVersion, toVersion, nil
+}
+
+// registerDiffRoutes registers the route comparing two scripts or two versions of a script
+func registerDiffRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	// Either ?from=<js_file>&to=<js_file> or ?url=<url>&from_version=<n>&to_version=<n>.
+	// ignore_whitespace=true compares lines without their whitespace, context sets the
+	// number of unchanged lines around changes and format=text returns only the unified diff.
+	se.Router.GET("/api/diff", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+
+		ignoreWhitespace, _ := strconv.ParseBool(query.Get("ignore_whitespace"))
+		context := diff.DefaultContext
+		if value := query.Get("context"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return c.BadRequestError("Invalid context", err)
+			}
+			context = parsed
+		}
+
+		fromID, toID := query.Get("from"), query.Get("to")
+		var fromVersion, toVersion int
+		if url := query.Get("url"); url != "" {
+			fromVersion, _ = strconv.Atoi(query.Get("from_version"))
+			toVersion, _ = strconv.Atoi(query.Get("to_version"))
+
+			var err error
+			fromID, toID, fromVersion, toVersion, err = resolveVersions(app, url, fromVersion, toVersion)
+			if err != nil {
+				return c.NotFoundError(err.Error(), err)
+			}
+		} else if fromID == "" || toID == "" {
+			return c.BadRequestError("Set from and to, or url with from_version and to_version", nil)
+		}
+
+		from, err := loadDiffSide(app, fromID, fromVersion)
+		if err != nil {
+			return c.NotFoundError(err.Error(), err)
+		}
+		to, err := loadDiffSide(app, toID, toVersion)
+		if err != nil {
+			return c.NotFoundError(err.Error(), err)
+		}
+
+		result := diff.Unified(
+			fmt.Sprintf("%s\t%s", from.URL, from.ID),
+			fmt.Sprintf("%s\t%s", to.URL, to.ID),
+			from.content,
+			to.content,
+			diff.Options{IgnoreWhitespace: ignoreWhitespace, Context: context},
+		)
+
+		if query.Get("format") == "text" {
+			return c.String(http.StatusOK, result.Unified)
+		}
+
+		return c.JSON(http.StatusOK, diffResponse{
+			From:             from,
+			To:               to,
+			IgnoreWhitespace: ignoreWhitespace,
+			Added:            result.Added,
+			Removed:          result.Removed,
+			Unified:          result.Unified,
+			Summary:          diff.Summarize(from.content, to.content),
+		})
+	})
+}
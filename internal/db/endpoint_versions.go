@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/jsh-team/jshunter/internal/utils/diff"
+	"github.com/jsh-team/jshunter/internal/utils/html"
+	"github.com/jsh-team/jshunter/internal/workers/htmlversion"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// pageDiffResponse is the comparison of two versions of the page of an endpoint
+type pageDiffResponse struct {
+	Endpoint string       `json:"endpoint"`
+	Variant  string       `json:"variant"`
+	From     *core.Record `json:"from"`
+	To       *core.Record `json:"to"`
+	Added    int          `json:"added"`
+	Removed  int          `json:"removed"`
+	Unified  string       `json:"unified"`
+}
+
+// pageVariant returns the variant requested with ?variant=, desktop by default
+func pageVariant(c *core.RequestEvent) (string, error) {
+	variant := c.Request.URL.Query().Get("variant")
+	if variant == "" {
+		return htmlversion.VariantDesktop, nil
+	}
+	if !slices.Contains(htmlversion.Variants, variant) {
+		return "", fmt.Errorf("unknown variant %q, use one of %v", variant, htmlversion.Variants)
+	}
+	return variant, nil
+}
+
+// normalizedPage reads the stored page of a version and returns its normalized HTML, one tag per line
+func normalizedPage(version *core.Record) (string, error) {
+	content, err := os.ReadFile(htmlversion.Path(version))
+	if err != nil {
+		return "", fmt.Errorf("failed to read version %d of the page: %w", version.GetInt("version"), err)
+	}
+	normalized, err := html.NormalizeHTML(string(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to normalize version %d of the page: %w", version.GetInt("version"), err)
+	}
+	return html.SplitTags(normalized), nil
+}
+
+// registerEndpointVersionRoutes registers the routes listing and comparing the structural
+// history of endpoint pages
+func registerEndpointVersionRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	// Versions of the page, newest first. variant=mobile lists the mobile page.
+	se.Router.GET("/api/endpoints/{id}/versions", func(c *core.RequestEvent) error {
+		endpoint, err := app.FindRecordById("endpoints", c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Endpoint not found", err)
+		}
+		variant, err := pageVariant(c)
+		if err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+
+		versions, err := htmlversion.List(app, endpoint.Id, variant)
+		if err != nil {
+			return c.InternalServerError("Failed to list page versions", err)
+		}
+
+		data := map[string]any{
+			"endpoint": endpoint.Id,
+			"url":      endpoint.GetString("url"),
+			"variant":  variant,
+			"items":    versions,
+			"latest":   nil,
+		}
+		if len(versions) > 0 {
+			data["latest"] = versions[0]
+		}
+		return c.JSON(http.StatusOK, data)
+	})
+
+	// Compare two versions of the page as normalized for the structural hash. to_version
+	// defaults to the latest version and from_version to the one before it; context and
+	// format=text work as for /api/diff.
+	se.Router.GET("/api/endpoints/{id}/diff", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+
+		endpoint, err := app.FindRecordById("endpoints", c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Endpoint not found", err)
+		}
+		variant, err := pageVariant(c)
+		if err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		context := diff.DefaultContext
+		if value := query.Get("context"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return c.BadRequestError("Invalid context", err)
+			}
+			context = parsed
+		}
+
+		versions, err := htmlversion.List(app, endpoint.Id, variant)
+		if err != nil || len(versions) == 0 {
+			return c.NotFoundError(fmt.Sprintf("No %s page versions of %s", variant, endpoint.GetString("url")), err)
+		}
+
+		toVersion, _ := strconv.Atoi(query.Get("to_version"))
+		if toVersion == 0 {
+			toVersion = versions[0].GetInt("version")
+		}
+		fromVersion, _ := strconv.Atoi(query.Get("from_version"))
+		if fromVersion == 0 {
+			fromVersion = toVersion - 1
+		}
+		if fromVersion == 0 {
+			return c.NotFoundError("The page has a single version, nothing to compare", nil)
+		}
+
+		byNumber := make(map[int]*core.Record, len(versions))
+		for _, version := range versions {
+			byNumber[version.GetInt("version")] = version
+		}
+		from, ok := byNumber[fromVersion]
+		if !ok {
+			return c.NotFoundError(fmt.Sprintf("Version %d of the page not found", fromVersion), nil)
+		}
+		to, ok := byNumber[toVersion]
+		if !ok {
+			return c.NotFoundError(fmt.Sprintf("Version %d of the page not found", toVersion), nil)
+		}
+
+		fromPage, err := normalizedPage(from)
+		if err != nil {
+			return c.NotFoundError(err.Error(), err)
+		}
+		toPage, err := normalizedPage(to)
+		if err != nil {
+			return c.NotFoundError(err.Error(), err)
+		}
+
+		url := endpoint.GetString("url")
+		result := diff.Unified(
+			fmt.Sprintf("%s\tversion %d", url, fromVersion),
+			fmt.Sprintf("%s\tversion %d", url, toVersion),
+			fromPage,
+			toPage,
+			diff.Options{Context: context},
+		)
+
+		if query.Get("format") == "text" {
+			return c.String(http.StatusOK, result.Unified)
+		}
+
+		return c.JSON(http.StatusOK, pageDiffResponse{
+			Endpoint: endpoint.Id,
+			Variant:  variant,
+			From:     from,
+			To:       to,
+			Added:    result.Added,
+			Removed:  result.Removed,
+			Unified:  result.Unified,
+		})
+	})
+}
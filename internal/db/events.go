@@ -0,0 +1,193 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/events"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// eventKeepAlive is how often a comment is sent on idle event streams so proxies keep them open
+const eventKeepAlive = 30 * time.Second
+
+// registerEventHooks publishes the pipeline events derived from record creation
+func registerEventHooks(app *pocketbase.PocketBase) {
+	app.OnRecordAfterCreateSuccess("endpoints").BindFunc(func(e *core.RecordEvent) error {
+		events.Publish(events.Event{
+			Type:       events.EndpointQueued,
+			Collection: "endpoints",
+			RecordID:   e.Record.Id,
+			URL:        e.Record.GetString("url"),
+			Data:       map[string]any{"priority": e.Record.GetString("priority")},
+		})
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("js_files").BindFunc(func(e *core.RecordEvent) error {
+		event := events.Event{
+			Type:       events.JSFileCreated,
+			Collection: "js_files",
+			RecordID:   e.Record.Id,
+			URL:        e.Record.GetString("url"),
+			Data:       map[string]any{"type": e.Record.GetString("type")},
+		}
+		if e.Record.GetString("type") == "chunk" {
+			event.Type = events.ChunkDiscovered
+			event.Data["parent_id"] = e.Record.GetString("parent_id")
+		}
+		events.Publish(event)
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess("findings").BindFunc(func(e *core.RecordEvent) error {
+		jsFileID := e.Record.GetString("js_file")
+
+		// Findings are filtered by the domain of the script they were found in
+		var jsFileURL string
+		if jsFile, err := app.FindRecordById("js_files", jsFileID); err == nil {
+			jsFileURL = jsFile.GetString("url")
+		}
+
+		var category string
+		var metadata map[string]any
+		if err := e.Record.UnmarshalJSONField("metadata", &metadata); err == nil {
+			category, _ = metadata["finding_category"].(string)
+		}
+
+		// A finding is new when its fingerprint was first seen with it, not in an earlier build
+		isNew := true
+		if fingerprintRecord, err := app.FindFirstRecordByFilter(fingerprint.CollectionName, "fingerprint = {:fingerprint}", dbx.Params{"fingerprint": e.Record.GetString("fingerprint")}); err == nil {
+			isNew = !fingerprintRecord.GetDateTime("first_seen").Time().Before(e.Record.GetDateTime("created_at").Time())
+		}
+
+		// Severity as triaged when the finding inherited a decision
+		severity := e.Record.GetString("severity")
+		if severity == "" {
+			severity = analysis.Severity(category, metadata)
+		}
+
+		events.Publish(events.Event{
+			Type:       events.FindingCreated,
+			Collection: "findings",
+			RecordID:   e.Record.Id,
+			URL:        jsFileURL,
+			Data: map[string]any{
+				"js_file":     jsFileID,
+				"type":        e.Record.GetString("type"),
+				"category":    category,
+				"value":       e.Record.GetString("value"),
+				"line":        e.Record.GetInt("line"),
+				"fingerprint": e.Record.GetString("fingerprint"),
+				"severity":    severity,
+				"status":      e.Record.GetString("status"),
+				"new":         isNew,
+			},
+		})
+		return e.Next()
+	})
+}
+
+// splitParam splits a comma separated query parameter, ignoring empty items
+func splitParam(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// registerEventRoutes registers the server-sent events stream of pipeline events
+func registerEventRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/events", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+		filter := events.Filter{
+			Targets: splitParam(query.Get("target")),
+			Domains: splitParam(query.Get("domain")),
+			Types:   splitParam(query.Get("type")),
+		}
+		for _, eventType := range filter.Types {
+			if !slices.Contains(events.Types, eventType) {
+				return c.BadRequestError(fmt.Sprintf("Unknown event type %q", eventType), nil)
+			}
+		}
+
+		// EventSource sends the header on reconnects; the query parameter allows resuming a new connection
+		lastEventID := c.Request.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = query.Get("last_event_id")
+		}
+
+		// The stream outlives the server write timeout
+		if err := http.NewResponseController(c.Response).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return c.InternalServerError("Failed to open event stream", err)
+		}
+
+		backlog, sub := events.Default.Subscribe(filter, lastEventID)
+		defer events.Default.Unsubscribe(sub)
+
+		c.Response.Header().Set("Content-Type", "text/event-stream")
+		c.Response.Header().Set("Cache-Control", "no-store")
+		c.Response.Header().Set("X-Accel-Buffering", "no")
+		c.Response.WriteHeader(http.StatusOK)
+
+		for _, event := range backlog {
+			if err := writeEvent(c, event); err != nil {
+				return nil
+			}
+		}
+		if err := c.Flush(); err != nil {
+			return nil
+		}
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return nil
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(c.Response, ": keep-alive\n\n"); err != nil {
+					return nil
+				}
+				if err := c.Flush(); err != nil {
+					return nil
+				}
+			case event, ok := <-sub.C:
+				if !ok {
+					// Too slow or shutting down: the client reconnects with its last event ID
+					return nil
+				}
+				if err := writeEvent(c, event); err != nil {
+					return nil
+				}
+				if err := c.Flush(); err != nil {
+					return nil
+				}
+			}
+		}
+	})
+}
+
+// writeEvent writes an event in the server-sent events format
+func writeEvent(c *core.RequestEvent, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Response, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
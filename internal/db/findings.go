@@ -0,0 +1,289 @@
+package db
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/schedule"
+	"github.com/jsh-team/jshunter/internal/workers/triage"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// runStart returns when a run started: the start of a job run, or the last run of a
+// re-crawl schedule
+func runStart(app *pocketbase.PocketBase, runID string) (types.DateTime, bool) {
+	if run, err := app.FindRecordById(jobrun.CollectionName, runID); err == nil {
+		return run.GetDateTime("started_at"), true
+	}
+	if record, err := app.FindRecordById(schedule.CollectionName, runID); err == nil && !record.GetDateTime("last_run_at").IsZero() {
+		return record.GetDateTime("last_run_at"), true
+	}
+	return types.DateTime{}, false
+}
+
+// maxTriageBatch is the maximum number of findings changed by one bulk triage request
+const maxTriageBatch = 5000
+
+// triageBody is the request body of the triage routes. Omitted fields keep their current
+// value. actor names who made the change when the request is not authenticated.
+type triageBody struct {
+	triage.Change
+	Actor string `json:"actor"`
+}
+
+// bulkTriageBody selects the findings of a bulk triage: finding ids, fingerprints (every
+// occurrence of a distinct finding) and unique keys (every finding with that value)
+type bulkTriageBody struct {
+	triageBody
+	IDs          []string `json:"ids"`
+	Fingerprints []string `json:"fingerprints"`
+	UniqueKeys   []string `json:"unique_keys"`
+}
+
+// registerFindingRoutes registers the routes listing distinct findings and their occurrences
+func registerFindingRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	// Distinct findings, most recently discovered first. since=<date> or since_run=<job run
+	// or schedule id> keeps the findings first seen after that time; category, type, status
+	// and assignee filter, status=new including the findings never triaged.
+	se.Router.GET("/api/findings", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+		page, perPage := parsePagination(c)
+
+		var conditions []dbx.Expression
+		if value := query.Get("since"); value != "" {
+			since, err := types.ParseDateTime(value)
+			if err != nil || since.IsZero() {
+				return c.BadRequestError("Invalid since date", err)
+			}
+			conditions = append(conditions, dbx.NewExp("first_seen > {:since}", dbx.Params{"since": since.String()}))
+		} else if runID := query.Get("since_run"); runID != "" {
+			since, ok := runStart(app, runID)
+			if !ok {
+				return c.NotFoundError("Run not found", nil)
+			}
+			conditions = append(conditions, dbx.NewExp("first_seen > {:since}", dbx.Params{"since": since.String()}))
+		}
+		if category := query.Get("category"); category != "" {
+			conditions = append(conditions, dbx.HashExp{"category": category})
+		}
+		if findingType := query.Get("type"); findingType != "" {
+			conditions = append(conditions, dbx.HashExp{"type": findingType})
+		}
+		if status := query.Get("status"); status != "" {
+			conditions = append(conditions, triage.StatusExpression(status))
+		}
+		if assignee := query.Get("assignee"); assignee != "" {
+			conditions = append(conditions, dbx.HashExp{"assignee": assignee})
+		}
+
+		records := []*core.Record{}
+		recordQuery := app.RecordQuery(fingerprint.CollectionName)
+		if len(conditions) > 0 {
+			recordQuery.AndWhere(dbx.And(conditions...))
+		}
+		err := recordQuery.
+			OrderBy("first_seen DESC").
+			Limit(int64(perPage)).
+			Offset(int64((page - 1) * perPage)).
+			All(&records)
+		if err != nil {
+			return c.InternalServerError("Failed to list findings", err)
+		}
+		total, err := app.CountRecords(fingerprint.CollectionName, conditions...)
+		if err != nil {
+			return c.InternalServerError("Failed to count findings", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":       page,
+			"perPage":    perPage,
+			"totalItems": total,
+			"items":      records,
+		})
+	})
+
+	// Unique findings: the findings sharing a category and a normalized value, whatever the
+	// type or script, most frequent first. category, type, q=<part of the value> and
+	// min_occurrences filter.
+	se.Router.GET("/api/findings/unique", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+		page, perPage := parsePagination(c)
+
+		filter := fingerprint.UniqueFilter{
+			Category: query.Get("category"),
+			Type:     query.Get("type"),
+			Search:   query.Get("q"),
+		}
+		if value := query.Get("min_occurrences"); value != "" {
+			minOccurrences, err := strconv.Atoi(value)
+			if err != nil {
+				return c.BadRequestError("Invalid min_occurrences", err)
+			}
+			filter.MinOccurrences = minOccurrences
+		}
+
+		total, err := fingerprint.CountUnique(app.DB(), fingerprint.UniqueQuery(app.DB(), filter))
+		if err != nil {
+			return c.InternalServerError("Failed to count unique findings", err)
+		}
+		uniques := []fingerprint.Unique{}
+		err = fingerprint.UniqueQuery(app.DB(), filter).
+			Limit(int64(perPage)).
+			Offset(int64((page - 1) * perPage)).
+			All(&uniques)
+		if err != nil {
+			return c.InternalServerError("Failed to list unique findings", err)
+		}
+		fingerprint.Tidy(uniques)
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":       page,
+			"perPage":    perPage,
+			"totalItems": total,
+			"items":      uniques,
+		})
+	})
+
+	// One unique finding with every occurrence: the js_file, line and column of each copy
+	se.Router.GET("/api/findings/unique/{key}", func(c *core.RequestEvent) error {
+		key := c.Request.PathValue("key")
+		uniques := []fingerprint.Unique{}
+		if err := fingerprint.UniqueQuery(app.DB(), fingerprint.UniqueFilter{Key: key}).All(&uniques); err != nil {
+			return c.InternalServerError("Failed to load unique finding", err)
+		}
+		if len(uniques) == 0 {
+			return c.NotFoundError("Unique finding not found", nil)
+		}
+		fingerprint.Tidy(uniques)
+
+		page, perPage := parsePagination(c)
+		occurrences, err := app.FindRecordsByFilter("findings", "unique_key = {:key}", "js_file,line,column", perPage, (page-1)*perPage, dbx.Params{"key": key})
+		if err != nil {
+			return c.InternalServerError("Failed to list occurrences", err)
+		}
+		app.ExpandRecords(occurrences, []string{"js_file"}, nil)
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"finding":     uniques[0],
+			"page":        page,
+			"perPage":     perPage,
+			"occurrences": occurrences,
+		})
+	})
+
+	// Triage one finding. The decision is also kept on its fingerprint for later detections.
+	se.Router.PATCH("/api/findings/{id}/triage", func(c *core.RequestEvent) error {
+		finding, err := app.FindRecordById("findings", c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Finding not found", err)
+		}
+
+		var body triageBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if err := body.Validate(app); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		if _, err := triage.Apply(app, []*core.Record{finding}, body.Change, triage.NewActor(c.Auth, body.Actor)); err != nil {
+			return c.InternalServerError("Failed to triage finding", err)
+		}
+
+		app.ExpandRecord(finding, []string{"assignee"}, nil)
+		return c.JSON(http.StatusOK, finding)
+	})
+
+	// Triage many findings at once, selected by ids, fingerprints and unique_keys, in one
+	// transaction. Findings already in the requested state are left untouched.
+	se.Router.POST("/api/findings/triage", func(c *core.RequestEvent) error {
+		var body bulkTriageBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if err := body.Validate(app); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+
+		findings, err := triage.Find(app, body.IDs, body.Fingerprints, body.UniqueKeys, maxTriageBatch)
+		if err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		changed, err := triage.Apply(app, findings, body.Change, triage.NewActor(c.Auth, body.Actor))
+		if err != nil {
+			return c.InternalServerError("Failed to triage findings", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"selected": len(findings),
+			"changed":  changed,
+		})
+	})
+
+	// Audit trail of the triage changes, newest first. finding=<id>, fingerprint and
+	// user filter.
+	se.Router.GET("/api/findings/audit", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+		page, perPage := parsePagination(c)
+
+		var conditions []dbx.Expression
+		for _, param := range []string{"finding", "fingerprint", "user"} {
+			if value := query.Get(param); value != "" {
+				conditions = append(conditions, dbx.HashExp{param: value})
+			}
+		}
+
+		records := []*core.Record{}
+		recordQuery := app.RecordQuery(triage.AuditCollectionName)
+		if len(conditions) > 0 {
+			recordQuery.AndWhere(dbx.And(conditions...))
+		}
+		err := recordQuery.
+			OrderBy("created_at DESC", "id DESC").
+			Limit(int64(perPage)).
+			Offset(int64((page - 1) * perPage)).
+			All(&records)
+		if err != nil {
+			return c.InternalServerError("Failed to list triage changes", err)
+		}
+		total, err := app.CountRecords(triage.AuditCollectionName, conditions...)
+		if err != nil {
+			return c.InternalServerError("Failed to count triage changes", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":       page,
+			"perPage":    perPage,
+			"totalItems": total,
+			"items":      records,
+		})
+	})
+
+	// One distinct finding with every occurrence, newest first, and the js_file it was found in
+	se.Router.GET("/api/findings/{fingerprint}", func(c *core.RequestEvent) error {
+		record, err := app.FindFirstRecordByFilter(fingerprint.CollectionName, "fingerprint = {:fingerprint}", dbx.Params{"fingerprint": c.Request.PathValue("fingerprint")})
+		if err != nil {
+			return c.NotFoundError("Finding not found", err)
+		}
+
+		page, perPage := parsePagination(c)
+		occurrences, err := app.FindRecordsByFilter("findings", "fingerprint = {:fingerprint}", "-created_at", perPage, (page-1)*perPage, dbx.Params{"fingerprint": record.GetString("fingerprint")})
+		if err != nil {
+			return c.InternalServerError("Failed to list occurrences", err)
+		}
+		// Occurrences whose js_file was deleted are returned without it
+		app.ExpandRecords(occurrences, []string{"js_file"}, nil)
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"finding":     record,
+			"page":        page,
+			"perPage":     perPage,
+			"occurrences": occurrences,
+		})
+	})
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"os/exec"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/metrics"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Pool gauges, read from the pool registry on every scrape
+var (
+	_ = metrics.NewGaugeFunc("jshunter_queue_depth", "Jobs waiting in the stage queue.", []string{"stage"}, func(set func(float64, ...string)) {
+		for _, controller := range pool.All() {
+			set(float64(controller.Stats().Queued), controller.Name())
+		}
+	})
+	_ = metrics.NewGaugeFunc("jshunter_jobs_in_flight", "Jobs currently processed by the stage workers.", []string{"stage"}, func(set func(float64, ...string)) {
+		for _, controller := range pool.All() {
+			set(float64(controller.Stats().Active), controller.Name())
+		}
+	})
+	_ = metrics.NewGaugeFunc("jshunter_pool_workers", "Configured workers of the stage pool.", []string{"stage"}, func(set func(float64, ...string)) {
+		for _, controller := range pool.All() {
+			set(float64(controller.Stats().Workers), controller.Name())
+		}
+	})
+	_ = metrics.NewGaugeFunc("jshunter_pool_running", "Whether the stage pool is running (1) or stopped (0).", []string{"stage"}, func(set func(float64, ...string)) {
+		for _, controller := range pool.All() {
+			set(boolValue(controller.Stats().Running), controller.Name())
+		}
+	})
+	_ = metrics.NewGaugeFunc("jshunter_browsers", "Browser processes of the extraction browser pool.", nil, func(set func(float64, ...string)) {
+		set(float64(extraction.BrowserStats().Browsers))
+	})
+	_ = metrics.NewGaugeFunc("jshunter_browser_pages_open", "Pages open in the pooled browsers.", nil, func(set func(float64, ...string)) {
+		set(float64(extraction.BrowserStats().Pages))
+	})
+	_ = metrics.NewGaugeFunc("jshunter_pool_paused", "Whether the stage pool is paused.", []string{"stage"}, func(set func(float64, ...string)) {
+		for _, controller := range pool.All() {
+			set(boolValue(controller.Stats().Paused), controller.Name())
+		}
+	})
+)
+
+// stageBinaries maps the built-in pools to the external binary they run
+var stageBinaries = map[string]*string{
+	"prettify":  &config.PrettifierBinaryPath,
+	"analysis":  &config.AnalyzerBinaryPath,
+	"dechunker": &config.DechunkerBinaryPath,
+}
+
+// boolValue converts a flag to a gauge value
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// poolChecks reports whether every registered pool is running
+func poolChecks() (map[string]bool, bool) {
+	checks := make(map[string]bool)
+	healthy := true
+	for _, controller := range pool.All() {
+		running := controller.Stats().Running
+		checks[controller.Name()] = running
+		healthy = healthy && running
+	}
+	return checks, healthy
+}
+
+// binaryChecks reports whether the binaries of every enabled stage are present
+func binaryChecks() (map[string]bool, bool) {
+	checks := make(map[string]bool)
+	ready := true
+	for _, stage := range pipeline.Stages() {
+		if stage.Disabled {
+			continue
+		}
+
+		var name string
+		var present bool
+		if stage.Custom {
+			name = stage.Command[0]
+			_, err := exec.LookPath(name)
+			present = err == nil
+		} else if path, ok := stageBinaries[stage.Pool]; ok {
+			name = *path
+			_, err := os.Stat(name)
+			present = name != "" && err == nil
+		} else {
+			continue
+		}
+
+		checks[name] = present
+		ready = ready && present
+	}
+	return checks, ready
+}
+
+// registerHealthRoutes registers the Prometheus metrics and the health probes
+func registerHealthRoutes(se *core.ServeEvent) {
+	se.Router.GET("/metrics", func(c *core.RequestEvent) error {
+		var buf bytes.Buffer
+		metrics.WriteText(&buf)
+		return c.Blob(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+	})
+
+	// Liveness: the stage pools are running
+	se.Router.GET("/healthz", func(c *core.RequestEvent) error {
+		pools, healthy := poolChecks()
+
+		status := http.StatusOK
+		if !healthy {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, map[string]any{
+			"healthy": healthy,
+			"pools":   pools,
+		})
+	})
+
+	// Readiness: the pools are running, the stage binaries are installed and the server is not shutting down
+	se.Router.GET("/readyz", func(c *core.RequestEvent) error {
+		pools, poolsRunning := poolChecks()
+		binaries, binariesPresent := binaryChecks()
+		stopping := shuttingDown.Load()
+		ready := poolsRunning && binariesPresent && !stopping
+
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		return c.JSON(status, map[string]any{
+			"ready":         ready,
+			"shutting_down": stopping,
+			"pools":         pools,
+			"binaries":      binaries,
+		})
+	})
+}
@@ -1,15 +1,12 @@
 package db
 
 import (
-	"github.com/jsh-team/jshunter/internal/storage"
 	"github.com/jsh-team/jshunter/internal/utils/db"
 	"github.com/jsh-team/jshunter/internal/utils/html"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
-	"github.com/jsh-team/jshunter/internal/workers/analysis"
-	"github.com/jsh-team/jshunter/internal/workers/dechunker"
-	"github.com/jsh-team/jshunter/internal/workers/extraction"
-	"github.com/jsh-team/jshunter/internal/workers/prettify"
-	"github.com/jsh-team/jshunter/internal/workers/sourcemap"
+	"github.com/jsh-team/jshunter/internal/workers/htmlversion"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 	"time"
 
 	"github.com/pocketbase/dbx"
@@ -43,10 +40,32 @@ func RegisterHooks(app *pocketbase.PocketBase) error {
 				dbx.Params{"hash": hash},
 			)
 			if existingRecord != nil {
+				// The page did not change: only its last sighting is recorded
+				if existingRecord.GetString("url") == e.Record.GetString("url") {
+					htmlversion.Observe(app, existingRecord, htmlversion.VariantDesktop, hash)
+				}
 				return nil
 			}
 		}
 
+		// A known URL whose page changed is extracted again, so its endpoint keeps the
+		// history of the page instead of a new endpoint being added
+		knownRecord, _ := app.FindFirstRecordByFilter(
+			"endpoints",
+			"url = {:url} && query_string = {:query_string}",
+			dbx.Params{"url": e.Record.GetString("url"), "query_string": e.Record.GetString("query_string")},
+		)
+		if knownRecord != nil {
+			if !pipeline.InFlight(knownRecord) {
+				if err := pipeline.Restart(app, knownRecord, pool.RecordPriority(knownRecord)); err != nil {
+					logger.Error("Failed to extract %s again: %v", knownRecord.GetString("url"), err)
+					return err
+				}
+			}
+			app.Delete(e.Record)
+			return e.Next()
+		}
+
 		endpointsCollection, err := app.FindCollectionByNameOrId("endpoints")
 		if err != nil {
 			logger.Error("Failed to find endpoints collection: %v", err)
@@ -57,6 +76,12 @@ func RegisterHooks(app *pocketbase.PocketBase) error {
 		record.Set("hash", hash)
 		record.Set("query_string", e.Record.GetString("query_string"))
 		record.Set("request_headers", e.Record.GetString("request_headers"))
+		// User-submitted endpoints go to the high priority lane unless the request says otherwise
+		priority := pool.PriorityHigh
+		if requested := e.Record.GetString("priority"); requested != "" {
+			priority = pool.RecordPriority(e.Record)
+		}
+		record.Set("priority", priority.String())
 		record.Set("extraction_status", "pending")
 		record.Set("prettify_status", "pending")
 		record.Set("created_at", time.Now())
@@ -72,99 +97,45 @@ func RegisterHooks(app *pocketbase.PocketBase) error {
 		return e.Next()
 	})
 
-	app.OnRecordAfterCreateSuccess("endpoints").BindFunc(func(e *core.RecordEvent) error {
-		if e.Record.GetString("extraction_status") == "pending" {
-			e.Record.Set("extraction_status", "processing")
-			app.Save(e.Record)
-
-			if err := extraction.AddExtractionJob(app, e.Record); err != nil {
-				logger.Error("Failed to add endpoint to extraction queue: %v", err)
-				return err
+	// =============================================================================
+	// PIPELINE HOOKS
+	// =============================================================================
+	// Stage ordering lives in the pipeline configuration: new records get the initial
+	// status of every stage, and every save queues the stages that became ready.
+	for _, collection := range []string{"endpoints", "js_files"} {
+		app.OnRecordCreate(collection).BindFunc(func(e *core.RecordEvent) error {
+			if e.Record.GetDateTime("created_at").IsZero() {
+				e.Record.Set("created_at", time.Now())
 			}
-		}
+			pipeline.Init(e.Record)
+			return e.Next()
+		})
 
-		return e.Next()
-	})
-
-	app.OnRecordAfterUpdateSuccess("endpoints").BindFunc(func(e *core.RecordEvent) error {
-		if e.Record.GetString("prettify_status") == "pending" && e.Record.GetString("extraction_status") == "processed" {
-			filePath, err := storage.GetHTMLFilePath(e.Record.GetString("url"), e.Record.GetString("hash"))
-			if err != nil {
-				logger.Error("Failed to get HTML file path: %v", err)
-			} else {
-				e.Record.Set("prettify_status", "processing")
-				app.Save(e.Record)
-				if err := prettify.AddPrettifyJob(app, e.Record, filePath, "html"); err != nil {
-					logger.Error("Failed to add HTML to prettify queue: %v", err)
-				}
-			}
-			mobileHash := e.Record.GetString("mobile_hash")
-			if mobileHash != "" {
-				mobileFilePath, err := storage.GetHTMLFilePath(e.Record.GetString("url"), e.Record.GetString("mobile_hash"))
-				if err != nil {
-					logger.Error("Failed to get mobile HTML file path: %v", err)
-				} else {
-					e.Record.Set("prettify_status", "processing")
-					app.Save(e.Record)
-					if err := prettify.AddPrettifyJob(app, e.Record, mobileFilePath, "html"); err != nil {
-						logger.Error("Failed to add mobile HTML to prettify queue: %v", err)
-					}
-				}
-			}
-		}
+		app.OnRecordAfterCreateSuccess(collection).BindFunc(func(e *core.RecordEvent) error {
+			pipeline.Advance(app, e.Record)
+			return e.Next()
+		})
 
-		return e.Next()
-	})
+		app.OnRecordAfterUpdateSuccess(collection).BindFunc(func(e *core.RecordEvent) error {
+			pipeline.Advance(app, e.Record)
+			return e.Next()
+		})
+	}
 
 	// =============================================================================
-	// JS_FILES HOOKS
+	// EVENT HOOKS
 	// =============================================================================
+	registerEventHooks(app)
 
-	app.OnRecordAfterCreateSuccess("js_files").BindFunc(func(e *core.RecordEvent) error {
-		e.Record.Set("prettify_status", "pending")
-		e.Record.Set("analysis_status", "pending")
-		e.Record.Set("sourcemap_status", "pending")
-		e.Record.Set("dechunker_status", "pending")
-
-		fileType := e.Record.GetString("type")
-		if fileType == "inline" || fileType == "chunk" {
-			e.Record.Set("dechunker_status", "processed") // Skip dechunking for inline/chunk files
-		}
-
-		e.Record.Set("created_at", time.Now())
-		filePath, err := storage.GetJSFilePath(e.Record.GetString("url"), e.Record.GetString("hash"))
-		if err != nil {
-			return err
-		}
-		e.Record.Set("prettify_status", "processing")
-		e.Record.Set("sourcemap_status", "processing")
-
-		app.Save(e.Record)
-
-		prettify.AddPrettifyJob(app, e.Record, filePath, "js")
-		sourcemap.AddSourcemapJob(app, e.Record)
-
-		return e.Next()
-	})
-
-	app.OnRecordAfterUpdateSuccess("js_files").BindFunc(func(e *core.RecordEvent) error {
-		if e.Record.GetString("prettify_status") == "processed" {
-			if e.Record.GetString("analysis_status") == "pending" {
-				e.Record.Set("analysis_status", "processing")
-				app.Save(e.Record)
-				analysis.AddAnalysisJob(app, e.Record)
-			}
-			if e.Record.GetString("dechunker_status") == "pending" {
-				e.Record.Set("dechunker_status", "processing")
-				app.Save(e.Record)
-				if err := dechunker.AddDechunkerJob(app, e.Record); err != nil {
-					logger.Error("Failed to add dechunker job for %s: %v", e.Record.GetString("url"), err)
-				}
-			}
-		}
+	// =============================================================================
+	// SCHEDULE HOOKS
+	// =============================================================================
+	registerScheduleHooks(app)
 
-		return e.Next()
-	})
+	// =============================================================================
+	// MONITOR HOOKS
+	// =============================================================================
+	registerMonitorHooks(app)
 
 	return nil
 }
@@ -3,11 +3,20 @@ package db
 import (
 	"fmt"
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/notify"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
 	"github.com/jsh-team/jshunter/internal/workers/analysis"
 	"github.com/jsh-team/jshunter/internal/workers/dechunker"
 	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+	"github.com/jsh-team/jshunter/internal/workers/gitsnapshot"
+	"github.com/jsh-team/jshunter/internal/workers/lineage"
+	"github.com/jsh-team/jshunter/internal/workers/monitor"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 	"github.com/jsh-team/jshunter/internal/workers/prettify"
+	"github.com/jsh-team/jshunter/internal/workers/remote"
+	"github.com/jsh-team/jshunter/internal/workers/schedule"
 	"github.com/jsh-team/jshunter/internal/workers/sourcemap"
 	"os"
 	"time"
@@ -36,6 +45,7 @@ func RunDB() {
 		config.MaxConcurrentBrowsers,
 		config.QueueBufferSize,
 	)
+	extractionWorkerPool.SetTimeout(time.Duration(config.BrowserWorkerTimeout) * time.Second)
 
 	if err := extractionWorkerPool.Start(); err != nil {
 		return
@@ -46,6 +56,7 @@ func RunDB() {
 		config.MaxConcurrentPrettify,
 		config.PrettifyQueueSize,
 	)
+	prettifyWorkerPool.SetTimeout(time.Duration(config.PrettifyTimeout) * time.Second)
 
 	if err := prettifyWorkerPool.Start(); err != nil {
 		return
@@ -56,6 +67,7 @@ func RunDB() {
 		config.MaxConcurrentSourcemaps,
 		config.SourcemapQueueSize,
 	)
+	sourcemapWorkerPool.SetTimeout(time.Duration(config.SourcemapTimeout) * time.Second)
 
 	if err := sourcemapWorkerPool.Start(); err != nil {
 		return
@@ -66,6 +78,7 @@ func RunDB() {
 		config.MaxConcurrentAnalysis,
 		config.AnalysisQueueSize,
 	)
+	analysisWorkerPool.SetTimeout(time.Duration(config.AnalysisTimeout) * time.Second)
 
 	if err := analysisWorkerPool.Start(); err != nil {
 		return
@@ -76,6 +89,7 @@ func RunDB() {
 		config.MaxConcurrentDechunker,
 		config.DechunkerQueueSize,
 	)
+	dechunkerWorkerPool.SetTimeout(time.Duration(config.DechunkerTimeout) * time.Second)
 
 	if err := dechunkerWorkerPool.Start(); err != nil {
 		return
@@ -88,51 +102,60 @@ func RunDB() {
 	analysis.SetGlobalAnalysisPool(analysisWorkerPool)
 	dechunker.SetGlobalDechunkerPool(dechunkerWorkerPool)
 
-	// Register crons and hooks
-	RegisterHooks(app)
-
-	// Handle graceful shutdown
-	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
-		// Silently stop all worker pools
-		if err := extractionWorkerPool.Stop(); err != nil {
-			logger.Error("Error stopping extraction worker pool: %v", err)
-		}
-
-		if err := prettifyWorkerPool.Stop(); err != nil {
-			logger.Error("Error stopping prettify worker pool: %v", err)
-		}
+	// Expose the pools to the runtime controls (pause, resume, resize, drain)
+	pool.Register(extractionWorkerPool)
+	pool.Register(prettifyWorkerPool)
+	pool.Register(sourcemapWorkerPool)
+	pool.Register(analysisWorkerPool)
+	pool.Register(dechunkerWorkerPool)
 
-		if err := sourcemapWorkerPool.Stop(); err != nil {
-			logger.Error("Error stopping sourcemap worker pool: %v", err)
-		}
+	// Hand queued extraction and analysis jobs to remote workers as well
+	coordinator = remote.NewCoordinator(app, extractionWorkerPool, analysisWorkerPool)
+	coordinator.Start()
 
-		if err := analysisWorkerPool.Stop(); err != nil {
-			logger.Error("Error stopping analysis worker pool: %v", err)
-		}
+	// Load the stage graph before any record can enter the pipeline
+	if err := loadPipeline(); err != nil {
+		logger.Fatal("Invalid pipeline configuration: %v", err)
+	}
 
-		if err := dechunkerWorkerPool.Stop(); err != nil {
-			logger.Error("Error stopping dechunker worker pool: %v", err)
-		}
+	// Register crons and hooks
+	RegisterHooks(app)
 
+	// Handle graceful shutdown: drain the pools and put unfinished records back to pending
+	app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		gracefulShutdown(e.App)
 		return e.Next()
 	})
 
 	RegisterRoutes(app)
 
-	// Hook para ejecutar después de que la base de datos esté completamente lista
-	app.OnBootstrap().BindFunc(func(e *core.BootstrapEvent) error {
-		// Ejecutar recuperación de jobs pendientes después del bootstrap
+	// Once migrations ran, make sure every stage has its fields and recover unfinished jobs
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		if err := pipeline.EnsureFields(se.App); err != nil {
+			logger.Error("Failed to add pipeline stage fields: %v", err)
+		}
+		go recoverPendingJobs(app)
 		go func() {
-			// Pequeña pausa para asegurar que todo esté listo
-			time.Sleep(2 * time.Second)
-			if pbApp, ok := e.App.(*pocketbase.PocketBase); ok {
-				recoverPendingJobs(pbApp)
-			}
+			// Findings are fingerprinted by lineage, so lineages come first
+			lineage.Backfill(app)
+			fingerprint.Backfill(app)
 		}()
-		return e.Next()
+		if err := schedule.Load(app); err != nil {
+			logger.Error("Failed to load re-crawl schedules: %v", err)
+		}
+		if err := monitor.Start(app); err != nil {
+			logger.Error("Failed to start the endpoint monitor: %v", err)
+		}
+		if err := gitsnapshot.Start(app); err != nil {
+			logger.Error("Git snapshots disabled: %v", err)
+		}
+		if err := notify.Start(app, config.GlobalConfig.Notifications); err != nil {
+			logger.Error("Notifications disabled: %v", err)
+		}
+		return se.Next()
 	})
 
-	os.Args = []string{"pocketbase", "serve", "--http", fmt.Sprintf("localhost:%d", config.Port)}
+	os.Args = []string{"pocketbase", "serve", "--http", fmt.Sprintf("%s:%d", config.BindAddress, config.Port)}
 	logger.Info("JSHunter server started on port %d", config.Port)
 
 	if err := app.Start(); err != nil {
@@ -148,150 +171,5 @@ func GetWorkerPool() *extraction.ExtractionWorkerPool {
 // recoverPendingJobs recovers all pending jobs and queues them for processing
 func recoverPendingJobs(app *pocketbase.PocketBase) {
 	logger.Info("Starting recovery of pending jobs...")
-
-	pendingEndpoints, err := app.FindRecordsByFilter(
-		"endpoints",
-		"extraction_status = 'pending'  || extraction_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit - process all pending
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending endpoints: %v", err)
-	} else if len(pendingEndpoints) > 0 {
-		logger.Info("Found %d pending extraction jobs to recover", len(pendingEndpoints))
-
-		for _, record := range pendingEndpoints {
-			if err := extraction.AddExtractionJob(app, record); err != nil {
-				logger.Error("Failed to queue recovery extraction job for %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	// 2. Recover pending prettify jobs (endpoints and js_files with prettify_status = 'pending')
-
-	// 2a. Endpoints with pending prettify
-	pendingEndpointPrettify, err := app.FindRecordsByFilter(
-		"endpoints",
-		"prettify_status = 'pending' || prettify_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending endpoint prettify jobs: %v", err)
-	} else if len(pendingEndpointPrettify) > 0 {
-		logger.Info("Found %d pending endpoint prettify jobs to recover", len(pendingEndpointPrettify))
-
-		for _, record := range pendingEndpointPrettify {
-			job := prettify.PrettifyJob{
-				Record: record,
-				App:    app,
-			}
-			if err := prettifyWorkerPool.SubmitJob(job); err != nil {
-				logger.Error("Failed to queue recovery prettify job for endpoint %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	// 2b. JS files with pending prettify
-	pendingJSPrettify, err := app.FindRecordsByFilter(
-		"js_files",
-		"prettify_status = 'pending' || prettify_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending JS prettify jobs: %v", err)
-	} else if len(pendingJSPrettify) > 0 {
-		logger.Info("Found %d pending JS prettify jobs to recover", len(pendingJSPrettify))
-
-		for _, record := range pendingJSPrettify {
-			job := prettify.PrettifyJob{
-				Record: record,
-				App:    app,
-			}
-			if err := prettifyWorkerPool.SubmitJob(job); err != nil {
-				logger.Error("Failed to queue recovery prettify job for JS %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	// 3. Recover pending sourcemap jobs (js_files with sourcemap_status = 'pending')
-	pendingSourcemap, err := app.FindRecordsByFilter(
-		"js_files",
-		"sourcemap_status = 'pending' || sourcemap_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending sourcemap jobs: %v", err)
-	} else if len(pendingSourcemap) > 0 {
-		logger.Info("Found %d pending sourcemap jobs to recover", len(pendingSourcemap))
-
-		for _, record := range pendingSourcemap {
-			if err := sourcemap.AddSourcemapJob(app, record); err != nil {
-				logger.Error("Failed to queue recovery sourcemap job for %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	// 4. Recover pending analysis jobs (js_files with analysis_status = 'pending')
-	pendingAnalysis, err := app.FindRecordsByFilter(
-		"js_files",
-		"analysis_status = 'pending' || analysis_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending analysis jobs: %v", err)
-	} else if len(pendingAnalysis) > 0 {
-		logger.Info("Found %d pending analysis jobs to recover", len(pendingAnalysis))
-
-		for _, record := range pendingAnalysis {
-			job := analysis.AnalysisJob{
-				Record: record,
-				App:    app,
-			}
-			if err := analysisWorkerPool.SubmitJob(job); err != nil {
-				logger.Error("Failed to queue recovery analysis job for %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	// 5. Recover pending dechunker jobs (js_files with dechunker_status = 'pending')
-	pendingDechunker, err := app.FindRecordsByFilter(
-		"js_files",
-		"dechunker_status = 'pending' || dechunker_status = 'processing'",
-		"created_at", // Order from oldest to newest
-		0,            // No limit
-		0,
-	)
-
-	if err != nil {
-		logger.Error("Error finding pending dechunker jobs: %v", err)
-	} else if len(pendingDechunker) > 0 {
-		logger.Info("Found %d pending dechunker jobs to recover", len(pendingDechunker))
-
-		for _, record := range pendingDechunker {
-			if err := dechunker.AddDechunkerJob(app, record); err != nil {
-				logger.Error("Failed to queue recovery dechunker job for %s: %v", record.GetString("url"), err)
-			}
-		}
-	}
-
-	totalRecovered := len(pendingEndpoints) + len(pendingEndpointPrettify) + len(pendingJSPrettify) + len(pendingSourcemap) + len(pendingAnalysis) + len(pendingDechunker)
-	if totalRecovered > 0 {
-		logger.Info("Recovery completed: %d total pending jobs queued for processing", totalRecovered)
-	} else {
-		logger.Info("No pending jobs found to recover")
-	}
+	pipeline.Recover(app)
 }
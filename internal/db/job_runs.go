@@ -0,0 +1,122 @@
+package db
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxTimelineDepth bounds how many levels of chunks are followed below a JavaScript file
+const maxTimelineDepth = 5
+
+// timelineNode is a record with its job runs and the records processed because of it
+type timelineNode struct {
+	Record   *core.Record    `json:"record"`
+	Runs     []*core.Record  `json:"runs"`
+	Children []*timelineNode `json:"children,omitempty"`
+}
+
+// registerJobRunRoutes registers the route returning the processing timeline of a record
+func registerJobRunRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/timeline/{collection}/{id}", func(c *core.RequestEvent) error {
+		collection := c.Request.PathValue("collection")
+		if collection != "endpoints" && collection != "js_files" {
+			return c.BadRequestError("Timelines are only available for endpoints and js_files", nil)
+		}
+
+		record, err := app.FindRecordById(collection, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Record not found", err)
+		}
+
+		root, err := buildTimeline(app, record)
+		if err != nil {
+			return c.InternalServerError("Failed to load job runs", err)
+		}
+
+		return c.JSON(http.StatusOK, root)
+	})
+}
+
+// buildTimeline collects the record, its JavaScript files (for endpoints) and their
+// chunks, then attaches the job runs of every collected record
+func buildTimeline(app *pocketbase.PocketBase, record *core.Record) (*timelineNode, error) {
+	nodes := make(map[string]*timelineNode)
+	root := &timelineNode{Record: record}
+	nodes[record.Id] = root
+
+	var jsFiles []*timelineNode
+	if record.Collection().Name == "endpoints" {
+		if ids := record.GetStringSlice("js_files"); len(ids) > 0 {
+			records, err := app.FindRecordsByIds("js_files", ids)
+			if err != nil {
+				return nil, err
+			}
+			for _, jsFile := range records {
+				node := &timelineNode{Record: jsFile}
+				nodes[jsFile.Id] = node
+				root.Children = append(root.Children, node)
+				jsFiles = append(jsFiles, node)
+			}
+		}
+	} else {
+		jsFiles = []*timelineNode{root}
+	}
+
+	// Chunks point to the file they were found in through parent_id
+	level := jsFiles
+	for depth := 0; depth < maxTimelineDepth && len(level) > 0; depth++ {
+		parentIDs := make([]any, 0, len(level))
+		for _, node := range level {
+			parentIDs = append(parentIDs, node.Record.Id)
+		}
+
+		chunks, err := app.FindAllRecords("js_files", dbx.In("parent_id", parentIDs...))
+		if err != nil {
+			return nil, err
+		}
+
+		var next []*timelineNode
+		for _, chunk := range chunks {
+			if _, seen := nodes[chunk.Id]; seen {
+				continue
+			}
+			node := &timelineNode{Record: chunk}
+			nodes[chunk.Id] = node
+			if parent, ok := nodes[chunk.GetString("parent_id")]; ok {
+				parent.Children = append(parent.Children, node)
+			}
+			next = append(next, node)
+		}
+		level = next
+	}
+
+	recordIDs := make([]any, 0, len(nodes))
+	for id := range nodes {
+		recordIDs = append(recordIDs, id)
+	}
+
+	runs, err := app.FindAllRecords(jobrun.CollectionName, dbx.In("record_id", recordIDs...))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].GetDateTime("started_at").Before(runs[j].GetDateTime("started_at"))
+	})
+
+	for _, node := range nodes {
+		node.Runs = []*core.Record{}
+	}
+	for _, run := range runs {
+		if node, ok := nodes[run.GetString("record_id")]; ok {
+			node.Runs = append(node.Runs, run)
+		}
+	}
+
+	return root, nil
+}
@@ -0,0 +1,47 @@
+package db
+
+import (
+	"net/http"
+
+	"github.com/jsh-team/jshunter/internal/workers/jsversion"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// versionsResponse writes the version history of a URL, newest first
+func versionsResponse(app *pocketbase.PocketBase, c *core.RequestEvent, url string) error {
+	versions, err := jsversion.List(app, url)
+	if err != nil {
+		return c.InternalServerError("Failed to list versions", err)
+	}
+
+	data := map[string]any{
+		"url":    url,
+		"items":  versions,
+		"latest": nil,
+	}
+	if len(versions) > 0 {
+		data["latest"] = versions[0]
+	}
+	return c.JSON(http.StatusOK, data)
+}
+
+// registerVersionRoutes registers the routes listing the content history of script URLs
+func registerVersionRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/versions", func(c *core.RequestEvent) error {
+		url := c.Request.URL.Query().Get("url")
+		if url == "" {
+			return c.BadRequestError("The url parameter is required", nil)
+		}
+		return versionsResponse(app, c, url)
+	})
+
+	se.Router.GET("/api/js-files/{id}/versions", func(c *core.RequestEvent) error {
+		jsFile, err := app.FindRecordById("js_files", c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("JS file not found", err)
+		}
+		return versionsResponse(app, c, jsFile.GetString("url"))
+	})
+}
@@ -0,0 +1,46 @@
+package db
+
+import (
+	"net/http"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// lineageResponse writes the builds of a lineage, oldest first
+func lineageResponse(app *pocketbase.PocketBase, c *core.RequestEvent, lineageID string) error {
+	page, perPage := parsePagination(c)
+	records, err := app.FindRecordsByFilter("js_files", "lineage_id = {:lineage}", "created_at", perPage, (page-1)*perPage, dbx.Params{"lineage": lineageID})
+	if err != nil {
+		return c.InternalServerError("Failed to list lineage", err)
+	}
+	if len(records) == 0 && page == 1 {
+		return c.NotFoundError("Lineage not found", nil)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"lineage_id": lineageID,
+		"page":       page,
+		"perPage":    perPage,
+		"items":      records,
+	})
+}
+
+// registerLineageRoutes registers the routes following one bundle across its builds
+func registerLineageRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/lineages/{id}", func(c *core.RequestEvent) error {
+		return lineageResponse(app, c, c.Request.PathValue("id"))
+	})
+
+	se.Router.GET("/api/js-files/{id}/lineage", func(c *core.RequestEvent) error {
+		jsFile, err := app.FindRecordById("js_files", c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("JS file not found", err)
+		}
+		if jsFile.GetString("lineage_id") == "" {
+			return c.NotFoundError("JS file has no lineage yet", nil)
+		}
+		return lineageResponse(app, c, jsFile.GetString("lineage_id"))
+	})
+}
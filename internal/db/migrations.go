@@ -1,6 +1,13 @@
 package db
 
 import (
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/htmlversion"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+	"github.com/jsh-team/jshunter/internal/workers/triage"
+
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	m "github.com/pocketbase/pocketbase/migrations"
 )
@@ -223,74 +230,1264 @@ func RegisterFindingsCollection(app core.App, jsFilesCollection *core.Collection
 	return findingsCollection, app.Save(findingsCollection)
 }
 
-func init() {
-	m.Register(
-		// Up migration
-		func(app core.App) error {
+func RegisterDeadLettersCollection(app core.App) (*core.Collection, error) {
+	deadLettersCollection := core.NewBaseCollection("dead_letters")
 
-			jsFilesCollection, err := RegisterJavaScriptFilesCollection(app)
-			if err != nil {
-				return err
-			}
+	deadLettersCollection.Fields.Add(
+		&core.TextField{
+			Name:     "stage",
+			Required: true,
+			Max:      100,
+		},
+		&core.TextField{
+			Name:     "record_collection",
+			Required: false,
+			Max:      100,
+		},
+		&core.TextField{
+			Name:     "record_id",
+			Required: true,
+		},
+		&core.TextField{
+			Name:     "url",
+			Required: false,
+			Max:      50000,
+		},
+		&core.TextField{
+			Name:     "input_path",
+			Required: false,
+			Max:      4096,
+		},
+		&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      50000,
+		},
+		&core.TextField{
+			Name:     "stderr",
+			Required: false,
+			Max:      100000,
+		},
+		&core.NumberField{
+			Name:     "attempts",
+			Required: false,
+		},
+		&core.SelectField{
+			Name:     "status",
+			Required: false,
+			Values:   []string{"open", "requeued"},
+		},
+		&core.DateField{
+			Name:     "created_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "updated_at",
+			Required: false,
+		},
+	)
 
-			_, err = RegisterEndpointsCollection(app, jsFilesCollection)
-			if err != nil {
-				return err
-			}
+	rule := "id != ''"
+	deadLettersCollection.ListRule = &rule
+	deadLettersCollection.ViewRule = &rule
 
-			_, err = RegisterTempEndpointsCollection(app)
-			if err != nil {
-				return err
-			}
+	return deadLettersCollection, app.Save(deadLettersCollection)
+}
 
-			_, err = RegisterFindingsCollection(app, jsFilesCollection)
-			if err != nil {
-				return err
-			}
+func RegisterJobRunsCollection(app core.App) (*core.Collection, error) {
+	jobRunsCollection := core.NewBaseCollection("job_runs")
 
-			return nil
+	jobRunsCollection.Fields.Add(
+		&core.TextField{
+			Name:     "stage",
+			Required: true,
+			Max:      100,
 		},
+		&core.TextField{
+			Name:     "record_collection",
+			Required: false,
+			Max:      100,
+		},
+		&core.TextField{
+			Name:     "record_id",
+			Required: true,
+		},
+		&core.TextField{
+			Name:     "url",
+			Required: false,
+			Max:      50000,
+		},
+		&core.TextField{
+			Name:     "worker_id",
+			Required: false,
+			Max:      255,
+		},
+		&core.DateField{
+			Name:     "started_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "finished_at",
+			Required: false,
+		},
+		&core.NumberField{
+			Name:     "duration_ms",
+			Required: false,
+		},
+		&core.SelectField{
+			Name:     "status",
+			Required: false,
+			Values:   pool.StatusValues,
+		},
+		&core.NumberField{
+			Name:     "exit_code",
+			Required: false,
+		},
+		&core.TextField{
+			Name:     "binary",
+			Required: false,
+			Max:      255,
+		},
+		&core.TextField{
+			Name:     "binary_version",
+			Required: false,
+			Max:      255,
+		},
+		&core.TextField{
+			Name:     "binary_checksum",
+			Required: false,
+			Max:      128,
+		},
+		&core.NumberField{
+			Name:     "stdout_size",
+			Required: false,
+		},
+		&core.NumberField{
+			Name:     "stderr_size",
+			Required: false,
+		},
+		&core.TextField{
+			Name:     "error",
+			Required: false,
+			Max:      50000,
+		},
+	)
 
-		// Down migration
-		func(app core.App) error {
-			endpoints, err := app.FindCollectionByNameOrId("endpoints")
-			if err == nil {
-				if err := app.Delete(endpoints); err != nil {
-					return err
-				}
-			}
+	jobRunsCollection.AddIndex("idx_job_runs_record", false, "record_id, started_at", "")
 
-			jsFiles, err := app.FindCollectionByNameOrId("js_files")
-			if err == nil {
-				if err := app.Delete(jsFiles); err != nil {
-					return err
-				}
-			}
+	rule := "id != ''"
+	jobRunsCollection.ListRule = &rule
+	jobRunsCollection.ViewRule = &rule
 
-			// Findings
-			findings, err := app.FindCollectionByNameOrId("findings")
-			if err == nil {
-				if err := app.Delete(findings); err != nil {
-					return err
-				}
-			}
+	return jobRunsCollection, app.Save(jobRunsCollection)
+}
 
-			return nil
-		}, "")
+func RegisterSchedulesCollection(app core.App, endpointsCollection *core.Collection) (*core.Collection, error) {
+	schedulesCollection := core.NewBaseCollection("schedules")
 
-	// Migration to add missing fields to existing collections
-	m.Register(
-		// Up migration - Add missing fields
-		func(app core.App) error {
+	schedulesCollection.Fields.Add(
+		&core.TextField{
+			Name:     "name",
+			Required: false,
+			Max:      255,
+		},
+		&core.TextField{
+			Name:     "cron",
+			Required: true,
+			Max:      255,
+		},
+		&core.RelationField{
+			Name:          "endpoint",
+			Required:      false,
+			CollectionId:  endpointsCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.BoolField{
+			Name:     "enabled",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "last_run_at",
+			Required: false,
+		},
+		&core.SelectField{
+			Name:     "last_status",
+			Required: false,
+			Values:   []string{"ok", "failed"},
+		},
+		&core.TextField{
+			Name:     "last_error",
+			Required: false,
+			Max:      50000,
+		},
+		&core.NumberField{
+			Name:     "last_queued",
+			Required: false,
+		},
+		&core.NumberField{
+			Name:     "last_skipped",
+			Required: false,
+		},
+		&core.NumberField{
+			Name:     "last_failed",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "created_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "updated_at",
+			Required: false,
+		},
+	)
 
-			return nil
+	rule := "id != ''"
+	schedulesCollection.ListRule = &rule
+	schedulesCollection.ViewRule = &rule
+
+	return schedulesCollection, app.Save(schedulesCollection)
+}
+
+func RegisterJSFileVersionsCollection(app core.App, jsFilesCollection *core.Collection) (*core.Collection, error) {
+	versionsCollection := core.NewBaseCollection("js_file_versions")
+
+	versionsCollection.Fields.Add(
+		&core.TextField{
+			Name:     "url",
+			Required: true,
+			Max:      50000,
+		},
+		&core.TextField{
+			Name:     "hash",
+			Required: true,
+			Max:      256,
+		},
+		&core.RelationField{
+			Name:          "js_file",
+			Required:      false,
+			CollectionId:  jsFilesCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.NumberField{
+			Name:     "version",
+			Required: false,
 		},
+		&core.DateField{
+			Name:     "first_seen",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "last_seen",
+			Required: false,
+		},
+	)
 
-		// Down migration - Remove added fields
-		func(app core.App) error {
-			// This migration is safe to leave empty as removing fields
-			// could cause data loss, better to leave them
-			return nil
-		}, "")
+	versionsCollection.AddIndex("idx_js_file_versions_url_hash", true, "url, hash", "")
+	versionsCollection.AddIndex("idx_js_file_versions_js_file", false, "js_file", "")
+
+	rule := "id != ''"
+	versionsCollection.ListRule = &rule
+	versionsCollection.ViewRule = &rule
+
+	return versionsCollection, app.Save(versionsCollection)
+}
+
+func RegisterFindingFingerprintsCollection(app core.App, jsFilesCollection *core.Collection) (*core.Collection, error) {
+	fingerprintsCollection := core.NewBaseCollection("finding_fingerprints")
+
+	fingerprintsCollection.Fields.Add(
+		&core.TextField{
+			Name:     "fingerprint",
+			Required: true,
+			Max:      64,
+		},
+		&core.TextField{
+			Name:     "category",
+			Required: false,
+		},
+		&core.TextField{
+			Name:     "type",
+			Required: false,
+		},
+		&core.TextField{
+			Name:     "value",
+			Required: false,
+			Max:      50000,
+		},
+		&core.TextField{
+			Name:     "scope",
+			Required: false,
+			Max:      50000,
+		},
+		&core.DateField{
+			Name:     "first_seen",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "last_seen",
+			Required: false,
+		},
+		&core.NumberField{
+			Name:     "occurrences",
+			Required: false,
+		},
+		&core.RelationField{
+			Name:         "first_js_file",
+			Required:     false,
+			CollectionId: jsFilesCollection.Id,
+		},
+		&core.RelationField{
+			Name:         "last_js_file",
+			Required:     false,
+			CollectionId: jsFilesCollection.Id,
+		},
+	)
 
+	fingerprintsCollection.AddIndex("idx_finding_fingerprints_fingerprint", true, "fingerprint", "")
+	fingerprintsCollection.AddIndex("idx_finding_fingerprints_first_seen", false, "first_seen", "")
+
+	rule := "id != ''"
+	fingerprintsCollection.ListRule = &rule
+	fingerprintsCollection.ViewRule = &rule
+
+	return fingerprintsCollection, app.Save(fingerprintsCollection)
+}
+
+func RegisterMonitorsCollection(app core.App, endpointsCollection *core.Collection) (*core.Collection, error) {
+	monitorsCollection := core.NewBaseCollection("monitors")
+
+	monitorsCollection.Fields.Add(
+		&core.RelationField{
+			Name:          "endpoint",
+			Required:      true,
+			CollectionId:  endpointsCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.NumberField{
+			Name:     "interval",
+			Required: true,
+			OnlyInt:  true,
+		},
+		&core.BoolField{
+			Name:     "enabled",
+			Required: false,
+		},
+		&core.SelectField{
+			Name:     "state",
+			Required: false,
+			Values:   []string{"idle", "checking"},
+		},
+		&core.JSONField{
+			Name:     "snapshot",
+			Required: false,
+			MaxSize:  1024 * 1024 * 100,
+		},
+		&core.DateField{
+			Name:     "last_check_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "last_compared_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "created_at",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "updated_at",
+			Required: false,
+		},
+	)
+
+	monitorsCollection.AddIndex("idx_monitors_endpoint", true, "endpoint", "")
+
+	rule := "id != ''"
+	monitorsCollection.ListRule = &rule
+	monitorsCollection.ViewRule = &rule
+
+	return monitorsCollection, app.Save(monitorsCollection)
+}
+
+func RegisterChangesCollection(app core.App, endpointsCollection *core.Collection, monitorsCollection *core.Collection) (*core.Collection, error) {
+	changesCollection := core.NewBaseCollection("changes")
+
+	changesCollection.Fields.Add(
+		&core.RelationField{
+			Name:         "monitor",
+			Required:     false,
+			CollectionId: monitorsCollection.Id,
+		},
+		&core.RelationField{
+			Name:          "endpoint",
+			Required:      false,
+			CollectionId:  endpointsCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:     "url",
+			Required: false,
+			Max:      50000,
+		},
+		&core.DateField{
+			Name:     "detected_at",
+			Required: true,
+		},
+		&core.JSONField{
+			Name:     "new_scripts",
+			Required: false,
+			MaxSize:  1024 * 1024 * 10,
+		},
+		&core.JSONField{
+			Name:     "removed_scripts",
+			Required: false,
+			MaxSize:  1024 * 1024 * 10,
+		},
+		&core.JSONField{
+			Name:     "new_findings",
+			Required: false,
+			MaxSize:  1024 * 1024 * 100,
+		},
+	)
+
+	changesCollection.AddIndex("idx_changes_endpoint", false, "endpoint", "")
+	changesCollection.AddIndex("idx_changes_detected_at", false, "detected_at", "")
+
+	rule := "id != ''"
+	changesCollection.ListRule = &rule
+	changesCollection.ViewRule = &rule
+
+	return changesCollection, app.Save(changesCollection)
+}
+
+func RegisterEndpointVersionsCollection(app core.App, endpointsCollection *core.Collection) (*core.Collection, error) {
+	versionsCollection := core.NewBaseCollection("endpoint_versions")
+
+	versionsCollection.Fields.Add(
+		&core.RelationField{
+			Name:          "endpoint",
+			Required:      true,
+			CollectionId:  endpointsCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:     "url",
+			Required: false,
+			Max:      50000,
+		},
+		&core.SelectField{
+			Name:     "variant",
+			Required: true,
+			Values:   htmlversion.Variants,
+		},
+		&core.TextField{
+			Name:     "hash",
+			Required: true,
+			Max:      256,
+		},
+		&core.TextField{
+			Name:     "file",
+			Required: false,
+			Max:      50000,
+		},
+		&core.NumberField{
+			Name:     "version",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "first_seen",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "last_seen",
+			Required: false,
+		},
+	)
+
+	versionsCollection.AddIndex("idx_endpoint_versions_endpoint_hash", true, "endpoint, variant, hash", "")
+
+	rule := "id != ''"
+	versionsCollection.ListRule = &rule
+	versionsCollection.ViewRule = &rule
+
+	return versionsCollection, app.Save(versionsCollection)
+}
+
+// triageFields returns the review fields of findings, also kept on their fingerprints as the
+// latest decision
+func triageFields(usersCollection *core.Collection) []core.Field {
+	return []core.Field{
+		&core.SelectField{
+			Name:      "status",
+			Required:  false,
+			MaxSelect: 1,
+			Values:    triage.Statuses,
+		},
+		&core.SelectField{
+			Name:      "severity",
+			Required:  false,
+			MaxSelect: 1,
+			Values:    config.Severities,
+		},
+		&core.TextField{
+			Name:     "notes",
+			Required: false,
+			Max:      triage.MaxNotes,
+		},
+		&core.RelationField{
+			Name:         "assignee",
+			Required:     false,
+			CollectionId: usersCollection.Id,
+		},
+		&core.DateField{
+			Name:     "triaged_at",
+			Required: false,
+		},
+	}
+}
+
+func RegisterFindingAuditCollection(app core.App, findingsCollection *core.Collection, usersCollection *core.Collection) (*core.Collection, error) {
+	auditCollection := core.NewBaseCollection(triage.AuditCollectionName)
+
+	auditCollection.Fields.Add(
+		&core.RelationField{
+			Name:          "finding",
+			Required:      false,
+			CollectionId:  findingsCollection.Id,
+			CascadeDelete: true,
+		},
+		&core.TextField{
+			Name:     "fingerprint",
+			Required: false,
+			Max:      64,
+		},
+		&core.TextField{
+			Name:     "field",
+			Required: true,
+		},
+		&core.TextField{
+			Name:     "old_value",
+			Required: false,
+			Max:      triage.MaxNotes,
+		},
+		&core.TextField{
+			Name:     "new_value",
+			Required: false,
+			Max:      triage.MaxNotes,
+		},
+		&core.RelationField{
+			Name:         "user",
+			Required:     false,
+			CollectionId: usersCollection.Id,
+		},
+		&core.TextField{
+			Name:     "actor",
+			Required: false,
+		},
+		&core.DateField{
+			Name:     "created_at",
+			Required: true,
+		},
+	)
+
+	auditCollection.AddIndex("idx_finding_audit_finding", false, "finding, created_at", "")
+	auditCollection.AddIndex("idx_finding_audit_fingerprint", false, "fingerprint", "")
+
+	rule := "id != ''"
+	auditCollection.ListRule = &rule
+	auditCollection.ViewRule = &rule
+
+	return auditCollection, app.Save(auditCollection)
+}
+
+// backfillTriage marks the findings stored before triage existed as new, with the severity
+// the analyzer gives them. Severities are set with one update per category and risk rather
+// than per finding.
+func backfillTriage(app core.App) error {
+	var groups []struct {
+		Category string `db:"category"`
+		Risk     string `db:"risk"`
+	}
+	err := app.DB().
+		Select(
+			"COALESCE(json_extract(metadata, '$.finding_category'), '') AS category",
+			"COALESCE(json_extract(metadata, '$.security_risk'), '') AS risk",
+		).
+		Distinct(true).
+		From("findings").
+		All(&groups)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		severity := analysis.Severity(group.Category, map[string]any{"security_risk": group.Risk})
+		_, err := app.DB().NewQuery(`UPDATE findings SET severity = {:severity}
+			WHERE COALESCE(json_extract(metadata, '$.finding_category'), '') = {:category}
+			AND COALESCE(json_extract(metadata, '$.security_risk'), '') = {:risk}`).
+			Bind(dbx.Params{"severity": severity, "category": group.Category, "risk": group.Risk}).
+			Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = app.DB().NewQuery("UPDATE findings SET status = {:status} WHERE status = ''").
+		Bind(dbx.Params{"status": triage.StatusNew}).
+		Execute()
+	return err
+}
+
+// renumberVersions numbers the versions of every subject of a versions table 1, 2, 3...
+// in the order they were numbered and first seen, so duplicated numbers become unique.
+// subject lists the columns identifying the versioned page or script.
+func renumberVersions(app core.App, table string, subject string) error {
+	_, err := app.DB().NewQuery(`UPDATE ` + table + ` SET version = (
+		SELECT numbered.n FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY ` + subject + ` ORDER BY version, first_seen, id) AS n
+			FROM ` + table + `
+		) AS numbered
+		WHERE numbered.id = ` + table + `.id
+	)`).Execute()
+	return err
+}
+
+// backfillJSFileVersions adds a first version for every js_file stored before versions were tracked
+func backfillJSFileVersions(app core.App, versionsCollection *core.Collection) error {
+	jsFiles, err := app.FindRecordsByFilter("js_files", "hash != ''", "created_at", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[string]int)
+	for _, jsFile := range jsFiles {
+		url := jsFile.GetString("url")
+		versions[url]++
+
+		seen := jsFile.GetDateTime("created_at")
+		record := core.NewRecord(versionsCollection)
+		record.Set("url", url)
+		record.Set("hash", jsFile.GetString("hash"))
+		record.Set("js_file", jsFile.Id)
+		record.Set("version", versions[url])
+		record.Set("first_seen", seen)
+		record.Set("last_seen", seen)
+		if err := app.Save(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillEndpointVersions adds a first version for the page of every endpoint extracted
+// before page versions were tracked
+func backfillEndpointVersions(app core.App, versionsCollection *core.Collection) error {
+	endpoints, err := app.FindRecordsByFilter("endpoints", "hash != '' || mobile_hash != ''", "created_at", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		for _, variant := range htmlversion.Variants {
+			hash := endpoint.GetString(htmlversion.HashField(variant))
+			if hash == "" {
+				continue
+			}
+
+			seen := endpoint.GetDateTime("created_at")
+			record := core.NewRecord(versionsCollection)
+			record.Set("endpoint", endpoint.Id)
+			record.Set("url", endpoint.GetString("url"))
+			record.Set("variant", variant)
+			record.Set("hash", hash)
+			record.Set("file", htmlversion.File(endpoint.GetString("url"), hash))
+			record.Set("version", 1)
+			record.Set("first_seen", seen)
+			record.Set("last_seen", seen)
+			if err := app.Save(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func init() {
+	m.Register(
+		// Up migration
+		func(app core.App) error {
+
+			jsFilesCollection, err := RegisterJavaScriptFilesCollection(app)
+			if err != nil {
+				return err
+			}
+
+			_, err = RegisterEndpointsCollection(app, jsFilesCollection)
+			if err != nil {
+				return err
+			}
+
+			_, err = RegisterTempEndpointsCollection(app)
+			if err != nil {
+				return err
+			}
+
+			_, err = RegisterFindingsCollection(app, jsFilesCollection)
+			if err != nil {
+				return err
+			}
+
+			return nil
+		},
+
+		// Down migration
+		func(app core.App) error {
+			endpoints, err := app.FindCollectionByNameOrId("endpoints")
+			if err == nil {
+				if err := app.Delete(endpoints); err != nil {
+					return err
+				}
+			}
+
+			jsFiles, err := app.FindCollectionByNameOrId("js_files")
+			if err == nil {
+				if err := app.Delete(jsFiles); err != nil {
+					return err
+				}
+			}
+
+			// Findings
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err == nil {
+				if err := app.Delete(findings); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}, "")
+
+	// Migration to add missing fields to existing collections
+	m.Register(
+		// Up migration - Add missing fields
+		func(app core.App) error {
+
+			return nil
+		},
+
+		// Down migration - Remove added fields
+		func(app core.App) error {
+			// This migration is safe to leave empty as removing fields
+			// could cause data loss, better to leave them
+			return nil
+		}, "")
+
+	// Dead letters for permanently failed jobs
+	m.Register(
+		func(app core.App) error {
+			_, err := RegisterDeadLettersCollection(app)
+			return err
+		},
+		func(app core.App) error {
+			deadLetters, err := app.FindCollectionByNameOrId("dead_letters")
+			if err == nil {
+				return app.Delete(deadLetters)
+			}
+			return nil
+		}, "1755000001_dead_letters.go")
+
+	// Priority lanes for endpoints and JavaScript files
+	m.Register(
+		func(app core.App) error {
+			for _, name := range []string{"tmp_endpoints", "endpoints", "js_files"} {
+				collection, err := app.FindCollectionByNameOrId(name)
+				if err != nil {
+					return err
+				}
+
+				collection.Fields.Add(&core.SelectField{
+					Name:     "priority",
+					Required: false,
+					Values:   pool.PriorityValues,
+				})
+
+				if err := app.Save(collection); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(app core.App) error {
+			for _, name := range []string{"tmp_endpoints", "endpoints", "js_files"} {
+				collection, err := app.FindCollectionByNameOrId(name)
+				if err != nil {
+					continue
+				}
+
+				collection.Fields.RemoveByName("priority")
+				if err := app.Save(collection); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, "1755000002_priority_lanes.go")
+
+	// Distinct status for jobs that ran out of time
+	m.Register(
+		func(app core.App) error {
+			return setStatusValues(app, pool.StatusValues)
+		},
+		func(app core.App) error {
+			return setStatusValues(app, []string{pool.StatusPending, pool.StatusProcessing, pool.StatusProcessed, pool.StatusFailed})
+		}, "1755000003_timeout_status.go")
+
+	// Trace of every stage execution
+	m.Register(
+		func(app core.App) error {
+			_, err := RegisterJobRunsCollection(app)
+			return err
+		},
+		func(app core.App) error {
+			jobRuns, err := app.FindCollectionByNameOrId("job_runs")
+			if err == nil {
+				return app.Delete(jobRuns)
+			}
+			return nil
+		}, "1755000004_job_runs.go")
+
+	// Indexes of the lookups made for every record on large targets
+	m.Register(
+		func(app core.App) error {
+			return updateQueryIndexes(app, true)
+		},
+		func(app core.App) error {
+			return updateQueryIndexes(app, false)
+		}, "1755000005_query_indexes.go")
+
+	// Re-crawl schedules
+	m.Register(
+		func(app core.App) error {
+			endpoints, err := app.FindCollectionByNameOrId("endpoints")
+			if err != nil {
+				return err
+			}
+			_, err = RegisterSchedulesCollection(app, endpoints)
+			return err
+		},
+		func(app core.App) error {
+			schedules, err := app.FindCollectionByNameOrId("schedules")
+			if err == nil {
+				return app.Delete(schedules)
+			}
+			return nil
+		}, "1755000006_schedules.go")
+
+	// Content history of script URLs
+	m.Register(
+		func(app core.App) error {
+			jsFiles, err := app.FindCollectionByNameOrId("js_files")
+			if err != nil {
+				return err
+			}
+			versions, err := RegisterJSFileVersionsCollection(app, jsFiles)
+			if err != nil {
+				return err
+			}
+			return backfillJSFileVersions(app, versions)
+		},
+		func(app core.App) error {
+			versions, err := app.FindCollectionByNameOrId("js_file_versions")
+			if err == nil {
+				return app.Delete(versions)
+			}
+			return nil
+		}, "1755000007_js_file_versions.go")
+
+	// Lineage of successive builds of a bundle
+	m.Register(
+		func(app core.App) error {
+			jsFiles, err := app.FindCollectionByNameOrId("js_files")
+			if err != nil {
+				return err
+			}
+
+			jsFiles.Fields.Add(
+				&core.TextField{
+					Name:     "url_pattern",
+					Required: false,
+					Max:      50000,
+				},
+				&core.TextField{
+					Name:     "fuzzy_hash",
+					Required: false,
+					Max:      64,
+				},
+				&core.TextField{
+					Name:     "lineage_id",
+					Required: false,
+					Max:      64,
+				},
+				&core.RelationField{
+					Name:         "previous_version",
+					Required:     false,
+					CollectionId: jsFiles.Id,
+				},
+			)
+			jsFiles.AddIndex("idx_js_files_url_pattern", false, "url_pattern", "")
+			jsFiles.AddIndex("idx_js_files_lineage_id", false, "lineage_id", "")
+
+			return app.Save(jsFiles)
+		},
+		func(app core.App) error {
+			jsFiles, err := app.FindCollectionByNameOrId("js_files")
+			if err != nil {
+				return nil
+			}
+
+			jsFiles.RemoveIndex("idx_js_files_url_pattern")
+			jsFiles.RemoveIndex("idx_js_files_lineage_id")
+			for _, name := range []string{"url_pattern", "fuzzy_hash", "lineage_id", "previous_version"} {
+				jsFiles.Fields.RemoveByName(name)
+			}
+			return app.Save(jsFiles)
+		}, "1755000008_lineage.go")
+
+	// Fingerprints of findings, to tell new findings from ones seen in earlier builds.
+	// Existing findings are fingerprinted at startup, once their scripts have a lineage.
+	m.Register(
+		func(app core.App) error {
+			jsFiles, err := app.FindCollectionByNameOrId("js_files")
+			if err != nil {
+				return err
+			}
+			if _, err := RegisterFindingFingerprintsCollection(app, jsFiles); err != nil {
+				return err
+			}
+
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err != nil {
+				return err
+			}
+			findings.Fields.Add(&core.TextField{
+				Name:     "fingerprint",
+				Required: false,
+				Max:      64,
+			})
+			findings.AddIndex("idx_findings_fingerprint", false, "fingerprint", "")
+			return app.Save(findings)
+		},
+		func(app core.App) error {
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err == nil {
+				findings.RemoveIndex("idx_findings_fingerprint")
+				findings.Fields.RemoveByName("fingerprint")
+				if err := app.Save(findings); err != nil {
+					return err
+				}
+			}
+
+			fingerprints, err := app.FindCollectionByNameOrId("finding_fingerprints")
+			if err == nil {
+				return app.Delete(fingerprints)
+			}
+			return nil
+		}, "1755000009_finding_fingerprints.go")
+
+	// Watched endpoints and the changes found between two checks
+	m.Register(
+		func(app core.App) error {
+			endpoints, err := app.FindCollectionByNameOrId("endpoints")
+			if err != nil {
+				return err
+			}
+			monitors, err := RegisterMonitorsCollection(app, endpoints)
+			if err != nil {
+				return err
+			}
+			_, err = RegisterChangesCollection(app, endpoints, monitors)
+			return err
+		},
+		func(app core.App) error {
+			for _, name := range []string{"changes", "monitors"} {
+				collection, err := app.FindCollectionByNameOrId(name)
+				if err != nil {
+					continue
+				}
+				if err := app.Delete(collection); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, "1755000010_monitors.go")
+
+	// Structural history of the pages of endpoints. Pages submitted again for a known URL
+	// are matched to their endpoint by url.
+	m.Register(
+		func(app core.App) error {
+			endpoints, err := app.FindCollectionByNameOrId("endpoints")
+			if err != nil {
+				return err
+			}
+			endpoints.AddIndex("idx_endpoints_url", false, "url", "")
+			if err := app.Save(endpoints); err != nil {
+				return err
+			}
+
+			versions, err := RegisterEndpointVersionsCollection(app, endpoints)
+			if err != nil {
+				return err
+			}
+			return backfillEndpointVersions(app, versions)
+		},
+		func(app core.App) error {
+			versions, err := app.FindCollectionByNameOrId("endpoint_versions")
+			if err == nil {
+				if err := app.Delete(versions); err != nil {
+					return err
+				}
+			}
+
+			endpoints, err := app.FindCollectionByNameOrId("endpoints")
+			if err == nil {
+				endpoints.RemoveIndex("idx_endpoints_url")
+				return app.Save(endpoints)
+			}
+			return nil
+		}, "1755000011_endpoint_versions.go")
+
+	// Unique findings: findings sharing a category and a normalized value, whatever the
+	// script. Existing findings are keyed at startup with their fingerprints.
+	m.Register(
+		func(app core.App) error {
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err != nil {
+				return err
+			}
+			findings.Fields.Add(&core.TextField{
+				Name:     "unique_key",
+				Required: false,
+				Max:      64,
+			})
+			findings.AddIndex("idx_findings_unique_key", false, "unique_key", "")
+			return app.Save(findings)
+		},
+		func(app core.App) error {
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err == nil {
+				findings.RemoveIndex("idx_findings_unique_key")
+				findings.Fields.RemoveByName("unique_key")
+				return app.Save(findings)
+			}
+			return nil
+		}, "1755000012_unique_findings.go")
+
+	// Triage of findings: status, severity, notes and assignee, with an audit trail. The
+	// latest decision is kept on the fingerprint so re-detected findings inherit it.
+	m.Register(
+		func(app core.App) error {
+			users, err := app.FindCollectionByNameOrId(triage.UsersCollectionName)
+			if err != nil {
+				return err
+			}
+
+			findings, err := app.FindCollectionByNameOrId("findings")
+			if err != nil {
+				return err
+			}
+			findings.Fields.Add(triageFields(users)...)
+			findings.AddIndex("idx_findings_status", false, "status", "")
+			findings.AddIndex("idx_findings_assignee", false, "assignee", "")
+			if err := app.Save(findings); err != nil {
+				return err
+			}
+
+			fingerprints, err := app.FindCollectionByNameOrId("finding_fingerprints")
+			if err != nil {
+				return err
+			}
+			fingerprints.Fields.Add(triageFields(users)...)
+			fingerprints.AddIndex("idx_finding_fingerprints_status", false, "status", "")
+			if err := app.Save(fingerprints); err != nil {
+				return err
+			}
+
+			if _, err := RegisterFindingAuditCollection(app, findings, users); err != nil {
+				return err
+			}
+			return backfillTriage(app)
+		},
+		func(app core.App) error {
+			audit, err := app.FindCollectionByNameOrId(triage.AuditCollectionName)
+			if err == nil {
+				if err := app.Delete(audit); err != nil {
+					return err
+				}
+			}
+
+			for name, index := range map[string][]string{
+				"findings":             {"idx_findings_status", "idx_findings_assignee"},
+				"finding_fingerprints": {"idx_finding_fingerprints_status"},
+			} {
+				collection, err := app.FindCollectionByNameOrId(name)
+				if err != nil {
+					continue
+				}
+				for _, indexName := range index {
+					collection.RemoveIndex(indexName)
+				}
+				for _, field := range []string{"status", "severity", "notes", "assignee", "triaged_at"} {
+					collection.Fields.RemoveByName(field)
+				}
+				if err := app.Save(collection); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, "1755000013_finding_triage.go")
+
+	// Load and settle timing of the pages of every extraction run
+	m.Register(
+		func(app core.App) error {
+			jobRuns, err := app.FindCollectionByNameOrId("job_runs")
+			if err != nil {
+				return err
+			}
+			jobRuns.Fields.Add(&core.JSONField{
+				Name:     "pages",
+				Required: false,
+				MaxSize:  1024 * 1024,
+			})
+			return app.Save(jobRuns)
+		},
+		func(app core.App) error {
+			jobRuns, err := app.FindCollectionByNameOrId("job_runs")
+			if err == nil {
+				jobRuns.Fields.RemoveByName("pages")
+				return app.Save(jobRuns)
+			}
+			return nil
+		}, "1755000014_page_timing.go")
+
+	// Version numbers of a script URL are unique, so workers racing to add a version of the
+	// same URL cannot both number it. Versions numbered twice before are renumbered first.
+	m.Register(
+		func(app core.App) error {
+			if err := renumberVersions(app, "js_file_versions", "url"); err != nil {
+				return err
+			}
+			versions, err := app.FindCollectionByNameOrId("js_file_versions")
+			if err != nil {
+				return err
+			}
+			versions.AddIndex("idx_js_file_versions_url_version", true, "url, version", "")
+			return app.Save(versions)
+		},
+		func(app core.App) error {
+			versions, err := app.FindCollectionByNameOrId("js_file_versions")
+			if err == nil {
+				versions.RemoveIndex("idx_js_file_versions_url_version")
+				return app.Save(versions)
+			}
+			return nil
+		}, "1755000015_js_file_version_numbers.go")
+
+	// Version numbers of a page variant are unique as well
+	m.Register(
+		func(app core.App) error {
+			if err := renumberVersions(app, "endpoint_versions", "endpoint, variant"); err != nil {
+				return err
+			}
+			versions, err := app.FindCollectionByNameOrId("endpoint_versions")
+			if err != nil {
+				return err
+			}
+			versions.AddIndex("idx_endpoint_versions_endpoint_version", true, "endpoint, variant, version", "")
+			return app.Save(versions)
+		},
+		func(app core.App) error {
+			versions, err := app.FindCollectionByNameOrId("endpoint_versions")
+			if err == nil {
+				versions.RemoveIndex("idx_endpoint_versions_endpoint_version")
+				return app.Save(versions)
+			}
+			return nil
+		}, "1755000016_endpoint_version_numbers.go")
+}
+
+// queryIndexes maps every collection to its lookup indexes (index name to indexed columns)
+var queryIndexes = map[string]map[string]string{
+	"js_files": {
+		"idx_js_files_url":       "url",       // Deduplication of scripts and chunks
+		"idx_js_files_hash":      "hash",      // Deduplication of scripts by content
+		"idx_js_files_parent_id": "parent_id", // Chunks of a script
+	},
+	"endpoints": {
+		"idx_endpoints_hash": "hash", // Deduplication of pages in the tmp_endpoints hook
+	},
+	"findings": {
+		"idx_findings_js_file": "js_file",
+	},
+	"dead_letters": {
+		"idx_dead_letters_record": "record_id, stage, status",
+	},
+}
+
+// updateQueryIndexes adds (or removes) the lookup indexes and one index per stage status field
+func updateQueryIndexes(app core.App, add bool) error {
+	for name, indexes := range queryIndexes {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			return err
+		}
+
+		for indexName, columns := range indexes {
+			if add {
+				collection.AddIndex(indexName, false, columns, "")
+			} else {
+				collection.RemoveIndex(indexName)
+			}
+		}
+		if fields, ok := stageStatusFields[collection.Name]; ok {
+			for _, field := range fields {
+				if add {
+					collection.AddIndex(pool.StatusIndexName(collection.Name, field), false, field, "")
+				} else {
+					collection.RemoveIndex(pool.StatusIndexName(collection.Name, field))
+				}
+			}
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageStatusFields lists the *_status select fields of every collection processed by the stages
+var stageStatusFields = map[string][]string{
+	"endpoints": {"extraction_status", "prettify_status"},
+	"js_files":  {"dechunker_status", "prettify_status", "analysis_status", "sourcemap_status"},
+}
+
+// setStatusValues replaces the allowed values of every stage status field
+func setStatusValues(app core.App, values []string) error {
+	for name, fields := range stageStatusFields {
+		collection, err := app.FindCollectionByNameOrId(name)
+		if err != nil {
+			return err
+		}
+
+		for _, fieldName := range fields {
+			if field, ok := collection.Fields.GetByName(fieldName).(*core.SelectField); ok {
+				field.Values = values
+			}
+		}
+
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/workers/monitor"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// registerMonitorHooks validates the monitors and takes their first snapshot, whether
+// they are created through the monitor routes or the records API
+func registerMonitorHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate(monitor.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		if err := monitor.Validate(e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate(monitor.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetDateTime("created_at").IsZero() {
+			e.Record.Set("created_at", time.Now())
+		}
+		e.Record.Set("updated_at", time.Now())
+		if e.Record.GetString("state") == "" {
+			e.Record.Set("state", monitor.StateIdle)
+		}
+		monitor.Baseline(e.App, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(monitor.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		e.Record.Set("updated_at", time.Now())
+		return e.Next()
+	})
+}
+
+// monitorBody is the request body used to watch an endpoint or change its monitor.
+// Omitted fields keep their current value.
+type monitorBody struct {
+	Endpoint *string `json:"endpoint"`
+	Interval *int    `json:"interval"` // Minutes between two checks
+	Enabled  *bool   `json:"enabled"`
+}
+
+// apply copies the fields of the body to the monitor record
+func (b monitorBody) apply(app *pocketbase.PocketBase, record *core.Record) error {
+	if b.Endpoint != nil {
+		if _, err := app.FindRecordById("endpoints", *b.Endpoint); err != nil {
+			return errors.New("endpoint not found")
+		}
+		record.Set("endpoint", *b.Endpoint)
+	}
+	if b.Interval != nil {
+		record.Set("interval", *b.Interval)
+	}
+	if b.Enabled != nil {
+		record.Set("enabled", *b.Enabled)
+	}
+	return monitor.Validate(record)
+}
+
+// registerMonitorRoutes registers the routes used to watch endpoints and read their changes
+func registerMonitorRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/monitors", func(c *core.RequestEvent) error {
+		page, perPage := parsePagination(c)
+		records, err := app.FindRecordsByFilter(monitor.CollectionName, "id != ''", "created_at", perPage, (page-1)*perPage)
+		if err != nil {
+			return c.InternalServerError("Failed to list monitors", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":    page,
+			"perPage": perPage,
+			"items":   records,
+		})
+	})
+
+	se.Router.GET("/api/monitors/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(monitor.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Monitor not found", err)
+		}
+		return c.JSON(http.StatusOK, record)
+	})
+
+	// Watch an endpoint. Watching an endpoint again updates its monitor.
+	se.Router.POST("/api/monitors", func(c *core.RequestEvent) error {
+		var body monitorBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if body.Endpoint == nil || body.Interval == nil {
+			return c.BadRequestError("An endpoint and an interval are required", nil)
+		}
+		if body.Enabled == nil {
+			enabled := true
+			body.Enabled = &enabled
+		}
+
+		record, err := app.FindFirstRecordByFilter(monitor.CollectionName, "endpoint = {:endpoint}", dbx.Params{"endpoint": *body.Endpoint})
+		if err != nil {
+			collection, err := app.FindCollectionByNameOrId(monitor.CollectionName)
+			if err != nil {
+				return c.InternalServerError("Failed to find monitors collection", err)
+			}
+			record = core.NewRecord(collection)
+		}
+		if err := body.apply(app, record); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		if err := app.Save(record); err != nil {
+			return c.BadRequestError("Failed to save monitor", err)
+		}
+
+		return c.JSON(http.StatusOK, record)
+	})
+
+	se.Router.PATCH("/api/monitors/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(monitor.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Monitor not found", err)
+		}
+
+		var body monitorBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if err := body.apply(app, record); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		if err := app.Save(record); err != nil {
+			return c.BadRequestError("Failed to update monitor", err)
+		}
+
+		return c.JSON(http.StatusOK, record)
+	})
+
+	// Stop watching an endpoint. Its changes are kept.
+	se.Router.DELETE("/api/monitors/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(monitor.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Monitor not found", err)
+		}
+
+		if err := app.Delete(record); err != nil {
+			return c.InternalServerError("Failed to delete monitor", err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	// Re-extract the endpoint now, without waiting for the interval. The comparison
+	// happens once the endpoint and its scripts went through the pipeline.
+	se.Router.POST("/api/monitors/{id}/check", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(monitor.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Monitor not found", err)
+		}
+
+		err = monitor.Check(app, record)
+		if errors.Is(err, monitor.ErrChecking) {
+			return c.Error(http.StatusConflict, err.Error(), nil)
+		}
+		if err != nil {
+			return c.InternalServerError("Failed to check monitor", err)
+		}
+
+		return c.JSON(http.StatusOK, record)
+	})
+
+	// Changes, newest first. endpoint, monitor and since=<date> filter.
+	se.Router.GET("/api/changes", func(c *core.RequestEvent) error {
+		query := c.Request.URL.Query()
+		page, perPage := parsePagination(c)
+
+		var conditions []dbx.Expression
+		if endpoint := query.Get("endpoint"); endpoint != "" {
+			conditions = append(conditions, dbx.HashExp{"endpoint": endpoint})
+		}
+		if monitorID := query.Get("monitor"); monitorID != "" {
+			conditions = append(conditions, dbx.HashExp{"monitor": monitorID})
+		}
+		if value := query.Get("since"); value != "" {
+			since, err := types.ParseDateTime(value)
+			if err != nil || since.IsZero() {
+				return c.BadRequestError("Invalid since date", err)
+			}
+			conditions = append(conditions, dbx.NewExp("detected_at > {:since}", dbx.Params{"since": since.String()}))
+		}
+
+		records := []*core.Record{}
+		recordQuery := app.RecordQuery(monitor.ChangesCollectionName)
+		if len(conditions) > 0 {
+			recordQuery.AndWhere(dbx.And(conditions...))
+		}
+		err := recordQuery.
+			OrderBy("detected_at DESC").
+			Limit(int64(perPage)).
+			Offset(int64((page - 1) * perPage)).
+			All(&records)
+		if err != nil {
+			return c.InternalServerError("Failed to list changes", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":    page,
+			"perPage": perPage,
+			"items":   records,
+		})
+	})
+
+	se.Router.GET("/api/changes/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(monitor.ChangesCollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Change not found", err)
+		}
+		return c.JSON(http.StatusOK, record)
+	})
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"net/http"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/notify"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerNotificationRoutes registers the routes showing and testing the notification channels
+func registerNotificationRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/notifications", func(c *core.RequestEvent) error {
+		channels := notify.Channels()
+		return c.JSON(http.StatusOK, map[string]any{
+			"enabled":  channels != nil,
+			"channels": channels,
+			"rules":    config.GlobalConfig.Notifications.Rules,
+		})
+	})
+
+	// Send a test message to a channel, without batching or rate limit
+	se.Router.POST("/api/notifications/test", func(c *core.RequestEvent) error {
+		var body struct {
+			Channel string `json:"channel"`
+		}
+		if err := c.BindBody(&body); err != nil || body.Channel == "" {
+			return c.BadRequestError("A channel is required", err)
+		}
+
+		if err := notify.Test(c.Request.Context(), body.Channel); err != nil {
+			return c.BadRequestError("Failed to send test notification: "+err.Error(), err)
+		}
+		return c.JSON(http.StatusOK, map[string]any{"sent": true})
+	})
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/dechunker"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+	"github.com/jsh-team/jshunter/internal/workers/prettify"
+	"github.com/jsh-team/jshunter/internal/workers/sourcemap"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// loadPipeline registers the built-in stages and loads the configured stage graph
+func loadPipeline() error {
+	pipeline.RegisterBuiltin("endpoints", "extraction", "extraction", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		return extractionWorkerPool.SubmitJob(extraction.ExtractionJob{App: app, Record: record}, priority)
+	})
+
+	pipeline.RegisterBuiltin("endpoints", "prettify", "prettify", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		filePath, err := storage.GetHTMLFilePath(record.GetString("url"), record.GetString("hash"))
+		if err != nil {
+			return fmt.Errorf("failed to get HTML file path: %w", err)
+		}
+		job := prettify.PrettifyJob{App: app, Record: record, FilePath: filePath, Type: "html"}
+		if err := prettifyWorkerPool.SubmitJob(job, priority); err != nil {
+			return err
+		}
+
+		// The mobile version of the page is prettified alongside the desktop one
+		if mobileHash := record.GetString("mobile_hash"); mobileHash != "" {
+			mobileFilePath, err := storage.GetHTMLFilePath(record.GetString("url"), mobileHash)
+			if err != nil {
+				return fmt.Errorf("failed to get mobile HTML file path: %w", err)
+			}
+			job.FilePath = mobileFilePath
+			return prettifyWorkerPool.SubmitJob(job, priority)
+		}
+		return nil
+	})
+
+	pipeline.RegisterBuiltin("js_files", "prettify", "prettify", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		filePath, err := storage.GetJSFilePath(record.GetString("url"), record.GetString("hash"))
+		if err != nil {
+			return fmt.Errorf("failed to get JS file path: %w", err)
+		}
+		return prettifyWorkerPool.SubmitJob(prettify.PrettifyJob{App: app, Record: record, FilePath: filePath, Type: "js"}, priority)
+	})
+
+	pipeline.RegisterBuiltin("js_files", "sourcemap", "sourcemap", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		return sourcemapWorkerPool.SubmitJob(sourcemap.SourcemapJob{App: app, Record: record}, priority)
+	})
+
+	pipeline.RegisterBuiltin("js_files", "analysis", "analysis", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		return analysisWorkerPool.SubmitJob(analysis.AnalysisJob{App: app, Record: record}, priority)
+	})
+
+	pipeline.RegisterBuiltin("js_files", "dechunker", "dechunker", func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		return dechunkerWorkerPool.SubmitJob(dechunker.DechunkerJob{App: app, Record: record}, priority)
+	})
+
+	return pipeline.Load(config.GetPipeline())
+}
+
+// registerPipelineRoutes exposes the active stage graph
+func registerPipelineRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/pipeline", func(c *core.RequestEvent) error {
+		return c.JSON(200, pipeline.Stages())
+	})
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"net/http"
+
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerPoolRoutes registers the runtime controls for the stage worker pools
+func registerPoolRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/pools", func(c *core.RequestEvent) error {
+		stats := []pool.Stats{}
+		for _, controller := range pool.All() {
+			stats = append(stats, controller.Stats())
+		}
+		return c.JSON(http.StatusOK, stats)
+	})
+
+	se.Router.GET("/api/pools/{stage}", func(c *core.RequestEvent) error {
+		controller, err := pool.Get(c.Request.PathValue("stage"))
+		if err != nil {
+			return c.NotFoundError("Unknown stage", err)
+		}
+		return c.JSON(http.StatusOK, controller.Stats())
+	})
+
+	se.Router.POST("/api/pools/{stage}/pause", func(c *core.RequestEvent) error {
+		controller, err := pool.Get(c.Request.PathValue("stage"))
+		if err != nil {
+			return c.NotFoundError("Unknown stage", err)
+		}
+		controller.Pause()
+		return c.JSON(http.StatusOK, controller.Stats())
+	})
+
+	se.Router.POST("/api/pools/{stage}/resume", func(c *core.RequestEvent) error {
+		controller, err := pool.Get(c.Request.PathValue("stage"))
+		if err != nil {
+			return c.NotFoundError("Unknown stage", err)
+		}
+		controller.Resume()
+		return c.JSON(http.StatusOK, controller.Stats())
+	})
+
+	se.Router.POST("/api/pools/{stage}/resize", func(c *core.RequestEvent) error {
+		controller, err := pool.Get(c.Request.PathValue("stage"))
+		if err != nil {
+			return c.NotFoundError("Unknown stage", err)
+		}
+
+		body := struct {
+			Workers int `json:"workers"`
+		}{}
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+
+		if err := controller.Resize(body.Workers); err != nil {
+			return c.BadRequestError("Failed to resize pool", err)
+		}
+		return c.JSON(http.StatusOK, controller.Stats())
+	})
+
+	se.Router.POST("/api/pools/{stage}/drain", func(c *core.RequestEvent) error {
+		controller, err := pool.Get(c.Request.PathValue("stage"))
+		if err != nil {
+			return c.NotFoundError("Unknown stage", err)
+		}
+
+		drained := controller.Drain()
+		return c.JSON(http.StatusOK, map[string]any{
+			"drained": drained,
+			"pool":    controller.Stats(),
+		})
+	})
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// registerPriorityRoutes registers the route used to change the priority of queued work
+func registerPriorityRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.PATCH("/api/priority/{collection}/{id}", func(c *core.RequestEvent) error {
+		collection := c.Request.PathValue("collection")
+		if collection != "endpoints" && collection != "js_files" {
+			return c.BadRequestError("Priority can only be set on endpoints and js_files", nil)
+		}
+
+		body := struct {
+			Priority string `json:"priority"`
+		}{}
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+
+		priority, err := pool.ParsePriority(body.Priority)
+		if err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+
+		record, err := app.FindRecordById(collection, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Record not found", err)
+		}
+
+		moved, err := setRecordPriority(app, record, priority)
+		if err != nil {
+			return c.InternalServerError("Failed to update priority", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"id":       record.Id,
+			"priority": priority.String(),
+			"moved":    moved,
+		})
+	})
+}
+
+// setRecordPriority stores the new priority on the record and moves its queued jobs
+// to the matching lane in every stage. It returns how many queued jobs were moved.
+func setRecordPriority(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) (int, error) {
+	record.Set("priority", priority.String())
+
+	// Skip hooks: changing the priority must not re-trigger any stage
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		return 0, fmt.Errorf("failed to save priority: %w", err)
+	}
+
+	moved := 0
+	for _, controller := range pool.All() {
+		moved += controller.SetPriority(record.Id, priority)
+	}
+
+	return moved, nil
+}
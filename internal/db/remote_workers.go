@@ -0,0 +1,132 @@
+package db
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/remote"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// remoteResultBodyLimit is the maximum size of an uploaded extraction or analysis result
+const remoteResultBodyLimit = 256 << 20
+
+// coordinator hands jobs to remote workers
+var coordinator *remote.Coordinator
+
+// isRemoteWorkerRequest reports whether the request targets the remote worker API with a valid token
+func isRemoteWorkerRequest(e *core.RequestEvent) bool {
+	return strings.HasPrefix(e.Request.URL.Path, "/api/workers/") && validWorkerToken(e)
+}
+
+// validWorkerToken checks the bearer token against the configured worker token
+func validWorkerToken(e *core.RequestEvent) bool {
+	if config.WorkerToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(config.WorkerToken)) == 1
+}
+
+// requireWorkerToken rejects remote worker calls without a valid token
+func requireWorkerToken(e *core.RequestEvent) error {
+	if config.WorkerToken == "" {
+		return e.ForbiddenError("Remote workers are disabled, start the server with --worker-token", nil)
+	}
+	if !validWorkerToken(e) {
+		return e.UnauthorizedError("Invalid worker token", nil)
+	}
+	return e.Next()
+}
+
+// leaseError maps coordinator errors to HTTP errors
+func leaseError(c *core.RequestEvent, err error) error {
+	if errors.Is(err, remote.ErrUnknownLease) {
+		return c.Error(http.StatusConflict, err.Error(), nil)
+	}
+	return c.BadRequestError(err.Error(), nil)
+}
+
+// registerRemoteWorkerRoutes registers the lease API used by `jshunter worker`
+func registerRemoteWorkerRoutes(se *core.ServeEvent) {
+	se.Router.GET("/api/workers", func(c *core.RequestEvent) error {
+		return c.JSON(http.StatusOK, coordinator.Workers())
+	})
+
+	workers := se.Router.Group("/api/workers")
+	workers.BindFunc(requireWorkerToken)
+
+	workers.POST("/lease", func(c *core.RequestEvent) error {
+		var req remote.LeaseRequest
+		if err := c.BindBody(&req); err != nil {
+			return c.BadRequestError("Invalid lease request", err)
+		}
+
+		leases, err := coordinator.Lease(req)
+		if err != nil {
+			return c.BadRequestError(err.Error(), nil)
+		}
+		if leases == nil {
+			leases = []remote.Lease{}
+		}
+		return c.JSON(http.StatusOK, leases)
+	})
+
+	workers.POST("/leases/{id}/heartbeat", func(c *core.RequestEvent) error {
+		var req remote.HeartbeatRequest
+		if err := c.BindBody(&req); err != nil {
+			return c.BadRequestError("Invalid heartbeat", err)
+		}
+
+		lease, err := coordinator.Heartbeat(c.Request.PathValue("id"), req.WorkerID)
+		if err != nil {
+			return leaseError(c, err)
+		}
+		return c.JSON(http.StatusOK, lease)
+	})
+
+	workers.GET("/leases/{id}/input", func(c *core.RequestEvent) error {
+		path, err := coordinator.InputPath(c.Request.PathValue("id"), c.Request.URL.Query().Get("worker_id"))
+		if err != nil {
+			return leaseError(c, err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return c.NotFoundError("Input file not found", err)
+		}
+		defer file.Close()
+
+		return c.Stream(http.StatusOK, "application/javascript", file)
+	})
+
+	workers.POST("/leases/{id}/complete", func(c *core.RequestEvent) error {
+		var req remote.CompleteRequest
+		if err := c.BindBody(&req); err != nil {
+			return c.BadRequestError("Invalid result", err)
+		}
+
+		if err := coordinator.Complete(c.Request.PathValue("id"), req); err != nil {
+			return leaseError(c, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	}).Bind(apis.BodyLimit(remoteResultBodyLimit))
+
+	workers.POST("/leases/{id}/fail", func(c *core.RequestEvent) error {
+		var req remote.FailRequest
+		if err := c.BindBody(&req); err != nil {
+			return c.BadRequestError("Invalid failure report", err)
+		}
+
+		if err := coordinator.Fail(c.Request.PathValue("id"), req); err != nil {
+			return leaseError(c, err)
+		}
+		return c.NoContent(http.StatusNoContent)
+	})
+}
@@ -1,21 +1,30 @@
 package db
 
 import (
+	"strconv"
+
 	"github.com/jsh-team/jshunter/internal/config"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
 func RegisterRoutes(app *pocketbase.PocketBase) {
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
 
 		se.Router.BindFunc(func(e *core.RequestEvent) error {
-			if e.RealIP() != "127.0.0.1" {
+			// Only remote workers holding the worker token may call from another machine
+			if e.RealIP() != "127.0.0.1" && !isRemoteWorkerRequest(e) {
 				return e.UnauthorizedError("Unauthorized", nil)
 			}
 			return e.Next()
 		})
+		se.Router.BindFunc(rejectWhileShuttingDown)
 		se.Router.GET("/api/config", func(c *core.RequestEvent) error {
 			data := map[string]interface{}{
 				"target":      config.Target,
@@ -24,6 +33,43 @@ func RegisterRoutes(app *pocketbase.PocketBase) {
 			return c.JSON(200, data)
 		})
 
+		registerHealthRoutes(se)
+		registerDeadLetterRoutes(app, se)
+		registerPoolRoutes(se)
+		registerPriorityRoutes(app, se)
+		registerPipelineRoutes(se)
+		registerJobRunRoutes(app, se)
+		registerEventRoutes(se)
+		registerScheduleRoutes(app, se)
+		registerVersionRoutes(app, se)
+		registerEndpointVersionRoutes(app, se)
+		registerLineageRoutes(app, se)
+		registerDiffRoutes(app, se)
+		registerFindingRoutes(app, se)
+		registerMonitorRoutes(app, se)
+		registerNotificationRoutes(se)
+		registerRemoteWorkerRoutes(se)
+
 		return se.Next()
 	})
 }
+
+// parsePagination reads the page and perPage query parameters with sane defaults
+func parsePagination(c *core.RequestEvent) (int, int) {
+	query := c.Request.URL.Query()
+
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err := strconv.Atoi(query.Get("perPage"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	return page, perPage
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/workers/schedule"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// scheduleState is a schedule with the state of its cron job
+type scheduleState struct {
+	Schedule   *core.Record `json:"schedule"`
+	Registered bool         `json:"registered"`
+	Running    bool         `json:"running"`
+	NextRunAt  *time.Time   `json:"next_run_at"`
+}
+
+// newScheduleState reads the cron state of a schedule
+func newScheduleState(app *pocketbase.PocketBase, record *core.Record) scheduleState {
+	state := scheduleState{
+		Schedule:   record,
+		Registered: schedule.IsRegistered(app, record.Id),
+		Running:    schedule.IsRunning(record.Id),
+	}
+	if record.GetBool("enabled") {
+		if next, ok := schedule.NextRun(record.GetString("cron"), time.Now()); ok {
+			state.NextRunAt = &next
+		}
+	}
+	return state
+}
+
+// registerScheduleHooks validates the schedules and keeps their cron jobs in sync,
+// whether they are changed through the schedule routes or the records API
+func registerScheduleHooks(app *pocketbase.PocketBase) {
+	app.OnRecordValidate(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		if err := schedule.Validate(e.Record.GetString("cron")); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetDateTime("created_at").IsZero() {
+			e.Record.Set("created_at", time.Now())
+		}
+		e.Record.Set("updated_at", time.Now())
+		return e.Next()
+	})
+
+	app.OnRecordUpdate(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		e.Record.Set("updated_at", time.Now())
+		return e.Next()
+	})
+
+	app.OnRecordAfterCreateSuccess(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		schedule.Sync(app, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		schedule.Sync(app, e.Record)
+		return e.Next()
+	})
+
+	app.OnRecordAfterDeleteSuccess(schedule.CollectionName).BindFunc(func(e *core.RecordEvent) error {
+		schedule.Remove(app, e.Record.Id)
+		return e.Next()
+	})
+}
+
+// scheduleBody is the request body used to create or update a schedule.
+// Omitted fields keep their current value.
+type scheduleBody struct {
+	Name     *string `json:"name"`
+	Cron     *string `json:"cron"`
+	Endpoint *string `json:"endpoint"` // Empty for every endpoint of the target
+	Enabled  *bool   `json:"enabled"`
+}
+
+// apply copies the fields of the body to the schedule record
+func (b scheduleBody) apply(app *pocketbase.PocketBase, record *core.Record) error {
+	if b.Name != nil {
+		record.Set("name", *b.Name)
+	}
+	if b.Cron != nil {
+		if err := schedule.Validate(*b.Cron); err != nil {
+			return err
+		}
+		record.Set("cron", strings.TrimSpace(*b.Cron))
+	}
+	if b.Endpoint != nil {
+		if *b.Endpoint != "" {
+			if _, err := app.FindRecordById("endpoints", *b.Endpoint); err != nil {
+				return errors.New("endpoint not found")
+			}
+		}
+		record.Set("endpoint", *b.Endpoint)
+	}
+	if b.Enabled != nil {
+		record.Set("enabled", *b.Enabled)
+	}
+	return nil
+}
+
+// registerScheduleRoutes registers the routes used to manage the re-crawl schedules
+func registerScheduleRoutes(app *pocketbase.PocketBase, se *core.ServeEvent) {
+	se.Router.GET("/api/schedules", func(c *core.RequestEvent) error {
+		page, perPage := parsePagination(c)
+		records, err := app.FindRecordsByFilter(schedule.CollectionName, "id != ''", "created_at", perPage, (page-1)*perPage)
+		if err != nil {
+			return c.InternalServerError("Failed to list schedules", err)
+		}
+
+		items := make([]scheduleState, 0, len(records))
+		for _, record := range records {
+			items = append(items, newScheduleState(app, record))
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"page":    page,
+			"perPage": perPage,
+			"items":   items,
+		})
+	})
+
+	se.Router.GET("/api/schedules/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(schedule.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Schedule not found", err)
+		}
+		return c.JSON(http.StatusOK, newScheduleState(app, record))
+	})
+
+	se.Router.POST("/api/schedules", func(c *core.RequestEvent) error {
+		var body scheduleBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if body.Cron == nil {
+			return c.BadRequestError("A cron expression is required", nil)
+		}
+		if body.Enabled == nil {
+			enabled := true
+			body.Enabled = &enabled
+		}
+
+		collection, err := app.FindCollectionByNameOrId(schedule.CollectionName)
+		if err != nil {
+			return c.InternalServerError("Failed to find schedules collection", err)
+		}
+		record := core.NewRecord(collection)
+		if err := body.apply(app, record); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		if err := app.Save(record); err != nil {
+			return c.BadRequestError("Failed to create schedule", err)
+		}
+
+		return c.JSON(http.StatusOK, newScheduleState(app, record))
+	})
+
+	se.Router.PATCH("/api/schedules/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(schedule.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Schedule not found", err)
+		}
+
+		var body scheduleBody
+		if err := c.BindBody(&body); err != nil {
+			return c.BadRequestError("Invalid request body", err)
+		}
+		if err := body.apply(app, record); err != nil {
+			return c.BadRequestError(err.Error(), err)
+		}
+		if err := app.Save(record); err != nil {
+			return c.BadRequestError("Failed to update schedule", err)
+		}
+
+		return c.JSON(http.StatusOK, newScheduleState(app, record))
+	})
+
+	se.Router.DELETE("/api/schedules/{id}", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(schedule.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Schedule not found", err)
+		}
+
+		if err := app.Delete(record); err != nil {
+			return c.InternalServerError("Failed to delete schedule", err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	// Run a schedule now, without waiting for its next cron tick
+	se.Router.POST("/api/schedules/{id}/run", func(c *core.RequestEvent) error {
+		record, err := app.FindRecordById(schedule.CollectionName, c.Request.PathValue("id"))
+		if err != nil {
+			return c.NotFoundError("Schedule not found", err)
+		}
+
+		result, err := schedule.Run(app, record)
+		if errors.Is(err, schedule.ErrRunning) {
+			return c.Error(http.StatusConflict, err.Error(), nil)
+		}
+		if err != nil {
+			return c.InternalServerError("Failed to run schedule", err)
+		}
+
+		return c.JSON(http.StatusOK, map[string]any{
+			"queued":   result.Queued,
+			"skipped":  result.Skipped,
+			"failed":   result.Failed,
+			"schedule": newScheduleState(app, record),
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/events"
+	"github.com/jsh-team/jshunter/internal/notify"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// shuttingDown is set once the server starts draining and no longer accepts new work
+var shuttingDown atomic.Bool
+
+// gracefulShutdown stops every stage pool, waiting up to config.ShutdownTimeout for
+// in-flight jobs, and puts every unfinished record back to pending so the next start
+// recovers it. A second interrupt signal force-quits the process.
+func gracefulShutdown(app core.App) {
+	shuttingDown.Store(true)
+	if coordinator != nil {
+		coordinator.Stop()
+	}
+	// Event streams would otherwise keep the HTTP server from closing
+	events.Default.Close()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalChan)
+	go func() {
+		if _, ok := <-signalChan; ok {
+			logger.Info("Forced shutdown, unfinished records will be recovered on the next start")
+			os.Exit(1)
+		}
+	}()
+
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	logger.Info("Shutting down, waiting up to %v for in-flight jobs (press Ctrl-C again to force quit)", timeout)
+
+	// Stop every pool in parallel so they share the same deadline
+	var wg sync.WaitGroup
+	for _, controller := range pool.All() {
+		wg.Add(1)
+		go func(controller pool.Controller) {
+			defer wg.Done()
+			if !controller.Shutdown(timeout) {
+				logger.Info("Cancelled in-flight %s jobs after %v", controller.Name(), timeout)
+			}
+		}(controller)
+	}
+	wg.Wait()
+
+	extraction.CloseBrowsers()
+	notify.Stop()
+	resetProcessingRecords(app)
+	logger.Info("Shutdown complete")
+}
+
+// resetProcessingRecords puts every record left in processing back to pending
+func resetProcessingRecords(app core.App) {
+	for _, stage := range pipeline.Stages() {
+		records, err := app.FindAllRecords(stage.Collection, dbx.HashExp{stage.StatusField: pool.StatusProcessing})
+		if err != nil {
+			logger.Error("Error finding unfinished %s records in %s: %v", stage.StatusField, stage.Collection, err)
+			continue
+		}
+
+		for _, record := range records {
+			pool.ResetStatus(app, record, stage.StatusField)
+		}
+		if len(records) > 0 {
+			logger.Info("Reset %d unfinished %s records in %s to pending", len(records), stage.StatusField, stage.Collection)
+		}
+	}
+}
+
+// rejectWhileShuttingDown refuses requests that could create new work once the server is draining
+func rejectWhileShuttingDown(e *core.RequestEvent) error {
+	if shuttingDown.Load() && e.Request.Method != http.MethodGet {
+		return e.Error(http.StatusServiceUnavailable, "Server is shutting down", nil)
+	}
+	return e.Next()
+}
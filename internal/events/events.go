@@ -0,0 +1,227 @@
+package events
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+)
+
+// Event types
+const (
+	EndpointQueued     = "endpoint.queued"
+	ExtractionFinished = "extraction.finished"
+	JSFileCreated      = "js_file.created"
+	ChunkDiscovered    = "chunk.discovered"
+	SourcemapRecovered = "sourcemap.recovered"
+	FindingCreated     = "finding.created"
+	ChangeDetected     = "change.detected"
+)
+
+// Types lists every event type
+var Types = []string{EndpointQueued, ExtractionFinished, JSFileCreated, ChunkDiscovered, SourcemapRecovered, FindingCreated, ChangeDetected}
+
+// bufferSize is how many past events are kept for clients resuming after a disconnect
+const bufferSize = 10000
+
+// subscriberBuffer is how many events may wait for a slow client before it is disconnected
+const subscriberBuffer = 256
+
+// Event is a pipeline event. IDs are "<epoch>-<sequence>" where the epoch changes on every start.
+type Event struct {
+	ID         string         `json:"id"`
+	Type       string         `json:"type"`
+	Time       time.Time      `json:"time"`
+	Target     string         `json:"target"`
+	Domain     string         `json:"domain,omitempty"`
+	Collection string         `json:"collection,omitempty"`
+	RecordID   string         `json:"record_id,omitempty"`
+	URL        string         `json:"url,omitempty"`
+	Data       map[string]any `json:"data,omitempty"`
+
+	seq uint64
+}
+
+// Filter selects events by target, domain and type. Empty lists match everything.
+// A domain also matches its subdomains.
+type Filter struct {
+	Targets []string
+	Domains []string
+	Types   []string
+}
+
+// Match reports whether the event passes the filter
+func (f Filter) Match(event Event) bool {
+	if len(f.Targets) > 0 && !slices.Contains(f.Targets, event.Target) {
+		return false
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+	if len(f.Domains) > 0 {
+		for _, domain := range f.Domains {
+			if event.Domain == domain || strings.HasSuffix(event.Domain, "."+domain) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Subscription receives the events published after it was created
+type Subscription struct {
+	C <-chan Event
+
+	ch     chan Event
+	filter Filter
+}
+
+// Bus keeps the recent events in a ring buffer and fans new events out to subscribers
+type Bus struct {
+	epoch string
+
+	mu          sync.Mutex
+	seq         uint64
+	buffer      []Event // Fixed size once full, the oldest event is at head
+	head        int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// Default is the bus of the running server
+var Default = NewBus()
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixMilli(), 10),
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns an ID to the event, stores it and sends it to the matching subscribers.
+// Subscribers that cannot keep up are disconnected; they can resume with their last event ID.
+func (b *Bus) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.seq++
+	event.seq = b.seq
+	event.ID = fmt.Sprintf("%s-%d", b.epoch, b.seq)
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Target == "" {
+		event.Target = config.Target
+	}
+	if event.Domain == "" {
+		event.Domain = Domain(event.URL)
+	}
+
+	if len(b.buffer) < bufferSize {
+		b.buffer = append(b.buffer, event)
+	} else {
+		b.buffer[b.head] = event
+		b.head = (b.head + 1) % bufferSize
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Match(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// Subscribe returns the buffered events after lastEventID that match the filter and a
+// subscription for the following ones. An empty lastEventID returns no backlog; an ID of
+// a previous run returns the whole buffer.
+func (b *Bus) Subscribe(filter Filter, lastEventID string) ([]Event, *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+	if b.closed {
+		close(ch)
+		return nil, sub
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return nil, sub
+	}
+
+	var after uint64
+	if epoch, seq, ok := strings.Cut(lastEventID, "-"); ok && epoch == b.epoch {
+		after, _ = strconv.ParseUint(seq, 10, 64)
+	}
+
+	var backlog []Event
+	for i := range b.buffer {
+		event := b.buffer[(b.head+i)%len(b.buffer)]
+		if event.seq > after && filter.Match(event) {
+			backlog = append(backlog, event)
+		}
+	}
+	return backlog, sub
+}
+
+// Unsubscribe stops the delivery of events to the subscription
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Close disconnects every subscriber and drops further events
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Closed reports whether the bus was closed
+func (b *Bus) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// Publish sends an event on the default bus
+func Publish(event Event) {
+	Default.Publish(event)
+}
+
+// Domain returns the host name of a URL
+func Domain(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
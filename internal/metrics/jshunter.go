@@ -0,0 +1,13 @@
+package metrics
+
+// Metrics updated by the stages. Pool gauges are read from the pool registry at scrape time.
+var (
+	JobsTotal       = NewCounter("jshunter_jobs_total", "Stage executions by final status.", "stage", "status")
+	JobDuration     = NewHistogram("jshunter_job_duration_seconds", "Duration of stage executions in seconds.", DurationBuckets, "stage")
+	BrowserLaunches = NewCounter("jshunter_browser_launches_total", "Headless browsers launched for extraction.")
+	BrowserRecycles = NewCounter("jshunter_browser_recycles_total", "Pooled browsers shut down by reason.", "reason")
+	BrowserPages    = NewCounter("jshunter_browser_pages_total", "Pages opened in pooled browsers.")
+	FetchRequests   = NewCounter("jshunter_fetch_requests_total", "HTTP requests made by the asset fetcher by status code.", "method", "code")
+	StoredBytes     = NewCounter("jshunter_stored_bytes_total", "Bytes written to the file storage.", "kind")
+	Findings        = NewCounter("jshunter_findings_total", "Findings saved by category.", "category")
+)
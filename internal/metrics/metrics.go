@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector writes its samples in the Prometheus text exposition format
+type Collector interface {
+	Write(w io.Writer)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Collector
+)
+
+// Register adds a collector to the output of WriteText
+func Register(collector Collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, collector)
+}
+
+// WriteText writes every registered collector in registration order
+func WriteText(w io.Writer) {
+	registryMu.RLock()
+	collectors := make([]Collector, len(registry))
+	copy(collectors, registry)
+	registryMu.RUnlock()
+
+	for _, collector := range collectors {
+		collector.Write(w)
+	}
+}
+
+// Counter is a monotonically increasing value per label set
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	Register(c)
+	return c
+}
+
+// Inc adds one to the counter of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter of the label values. Negative values are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+
+	key := formatLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Write implements Collector
+func (c *Counter) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// Histogram counts observations in cumulative buckets per label set
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 // One per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+// DurationBuckets are the default buckets of job duration histograms, in seconds
+var DurationBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// NewHistogram creates and registers a histogram with the given upper bounds
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	h := &Histogram{name: name, help: help, labels: labels, buckets: sorted, series: make(map[string]*histogramSeries)}
+	Register(h)
+	return h
+}
+
+// Observe records a value for the label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := formatLabels(h.labels, labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{labelValues: padLabels(h.labels, labelValues), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.count++
+	series.sum += v
+}
+
+// Write implements Collector
+func (h *Histogram) Write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	names := append(append([]string{}, h.labels...), "le")
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		values := append(append([]string{}, series.labelValues...), "")
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			values[len(values)-1] = formatValue(bound)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), cumulative)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(names, values), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key, formatValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key, series.count)
+	}
+}
+
+// GaugeFunc reads its values when the metrics are scraped
+type GaugeFunc struct {
+	name   string
+	help   string
+	labels []string
+	read   func(set func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc creates and registers a gauge whose samples are produced by read at scrape time
+func NewGaugeFunc(name string, help string, labels []string, read func(set func(v float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, labels: labels, read: read}
+	Register(g)
+	return g
+}
+
+// Write implements Collector
+func (g *GaugeFunc) Write(w io.Writer) {
+	values := make(map[string]float64)
+	g.read(func(v float64, labelValues ...string) {
+		values[formatLabels(g.labels, labelValues)] = v
+	})
+
+	writeHeader(w, g.name, g.help, "gauge")
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, key, formatValue(values[key]))
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// formatLabels renders a label set as {a="x",b="y"}. Missing values are left empty.
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	escaper := strings.NewReplacer("\\", `\\`, "\n", `\n`, `"`, `\"`)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts[i] = name + `="` + escaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// padLabels copies the label values, one per label name
+func padLabels(names []string, values []string) []string {
+	padded := make([]string, len(names))
+	copy(padded, values)
+	return padded
+}
+
+// formatValue renders a sample value
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,425 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/events"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultBatchWindow = 60 * time.Second
+	defaultMaxBatch    = 50
+
+	// maxPending bounds the events kept per channel while it waits; later ones are only counted
+	maxPending = 1000
+
+	// rateWindow is the period of the max_per_hour limit of a channel
+	rateWindow = time.Hour
+
+	// stopTimeout bounds the delivery of the last batches on shutdown
+	stopTimeout = 10 * time.Second
+)
+
+// Batch is one message sent to a channel
+type Batch struct {
+	Target  string         `json:"target"`
+	Channel string         `json:"channel"`
+	SentAt  time.Time      `json:"sent_at"`
+	Events  []events.Event `json:"events"`
+	Omitted int            `json:"omitted"` // Matched events left out once maxPending were waiting
+}
+
+// Stats are the delivery counters of a channel since the server started
+type Stats struct {
+	Name       string     `json:"name"`
+	Type       string     `json:"type"`
+	Sent       int        `json:"sent"`    // Messages delivered
+	Failed     int        `json:"failed"`  // Messages that could not be delivered
+	Events     int        `json:"events"`  // Events delivered
+	Pending    int        `json:"pending"` // Events waiting for the next message
+	LastSentAt *time.Time `json:"last_sent_at"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+// sender delivers a batch to a channel
+type sender func(ctx context.Context, batch Batch) error
+
+// channel batches the events of one destination and enforces its rate limit
+type channel struct {
+	config config.ChannelConfig
+	send   sender
+	window time.Duration
+
+	mu      sync.Mutex
+	pending []events.Event
+	keys    map[string]bool // Pending findings by fingerprint, so a finding repeated in a file is sent once
+	omitted int
+	timer   *time.Timer
+	sentAt  []time.Time // Messages sent within the rate window
+	stats   Stats
+}
+
+// Notifier sends the events matching the notification rules to their channels
+type Notifier struct {
+	rules    []config.NotificationRuleConfig
+	channels map[string]*channel
+	order    []string // Channel names in configuration order
+
+	sub  *events.Subscription
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+var (
+	mu      sync.Mutex
+	current *Notifier
+)
+
+// Validate checks the channels and rules of the notification config
+func Validate(cfg config.NotificationsConfig) error {
+	names := make(map[string]bool, len(cfg.Channels))
+	for _, ch := range cfg.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("notification channel without a name")
+		}
+		if names[ch.Name] {
+			return fmt.Errorf("duplicate notification channel %q", ch.Name)
+		}
+		names[ch.Name] = true
+
+		switch ch.Type {
+		case config.ChannelWebhook, config.ChannelSlack, config.ChannelDiscord:
+			if ch.URL == "" {
+				return fmt.Errorf("notification channel %q needs a url", ch.Name)
+			}
+		case config.ChannelEmail:
+			if len(ch.To) == 0 {
+				return fmt.Errorf("notification channel %q needs at least one recipient", ch.Name)
+			}
+		default:
+			return fmt.Errorf("notification channel %q has unknown type %q", ch.Name, ch.Type)
+		}
+	}
+
+	for _, rule := range cfg.Rules {
+		if len(rule.Channels) == 0 {
+			return fmt.Errorf("notification rule %q has no channel", rule.Name)
+		}
+		for _, name := range rule.Channels {
+			if !names[name] {
+				return fmt.Errorf("notification rule %q uses unknown channel %q", rule.Name, name)
+			}
+		}
+		for _, eventType := range rule.Events {
+			if !slices.Contains(events.Types, eventType) {
+				return fmt.Errorf("notification rule %q uses unknown event %q", rule.Name, eventType)
+			}
+		}
+		if rule.MinSeverity != "" && !slices.Contains(config.Severities, rule.MinSeverity) {
+			return fmt.Errorf("notification rule %q has unknown severity %q, use one of %v", rule.Name, rule.MinSeverity, config.Severities)
+		}
+	}
+	return nil
+}
+
+// Start validates the config and starts sending notifications. Without rules it does nothing.
+func Start(app core.App, cfg config.NotificationsConfig) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	if len(cfg.Rules) == 0 {
+		return nil
+	}
+
+	window := time.Duration(cfg.BatchWindow) * time.Second
+	if window <= 0 {
+		window = defaultBatchWindow
+	}
+	maxBatch := cfg.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = defaultMaxBatch
+	}
+
+	n := &Notifier{
+		rules:    cfg.Rules,
+		channels: make(map[string]*channel, len(cfg.Channels)),
+		done:     make(chan struct{}),
+	}
+	for _, ch := range cfg.Channels {
+		n.channels[ch.Name] = &channel{
+			config: ch,
+			send:   newSender(app, ch, maxBatch),
+			window: window,
+			keys:   make(map[string]bool),
+			stats:  Stats{Name: ch.Name, Type: ch.Type},
+		}
+		n.order = append(n.order, ch.Name)
+	}
+
+	var types []string
+	for _, rule := range cfg.Rules {
+		types = append(types, ruleEvents(rule)...)
+	}
+	_, n.sub = events.Default.Subscribe(events.Filter{Types: types}, "")
+
+	n.wg.Add(1)
+	go n.run(types)
+
+	mu.Lock()
+	current = n
+	mu.Unlock()
+
+	logger.Info("Notifications enabled: %d rules, %d channels", len(cfg.Rules), len(cfg.Channels))
+	return nil
+}
+
+// Stop stops matching events and sends what is still pending, ignoring the rate limits
+func Stop() {
+	mu.Lock()
+	n := current
+	current = nil
+	mu.Unlock()
+	if n == nil {
+		return
+	}
+
+	close(n.done)
+	n.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	for _, name := range n.order {
+		n.channels[name].flush(ctx, true)
+	}
+}
+
+// Channels returns the delivery counters of every channel, nil when notifications are off
+func Channels() []Stats {
+	mu.Lock()
+	n := current
+	mu.Unlock()
+	if n == nil {
+		return nil
+	}
+
+	stats := make([]Stats, 0, len(n.order))
+	for _, name := range n.order {
+		ch := n.channels[name]
+		ch.mu.Lock()
+		s := ch.stats
+		s.Pending = len(ch.pending) + ch.omitted
+		ch.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Test sends a message to a channel right away, without batching or rate limit
+func Test(ctx context.Context, name string) error {
+	mu.Lock()
+	n := current
+	mu.Unlock()
+	if n == nil {
+		return fmt.Errorf("notifications are not enabled")
+	}
+	ch, ok := n.channels[name]
+	if !ok {
+		return fmt.Errorf("unknown notification channel %q", name)
+	}
+
+	return ch.send(ctx, Batch{
+		Target:  config.Target,
+		Channel: name,
+		SentAt:  time.Now(),
+		Events: []events.Event{{
+			Type:   "test",
+			Time:   time.Now(),
+			Target: config.Target,
+			Data:   map[string]any{"message": "Test notification from JSHunter"},
+		}},
+	})
+}
+
+// run dispatches the events of the subscription. A subscription dropped for being slow is
+// resumed from its last event, so a burst of findings is not lost.
+func (n *Notifier) run(types []string) {
+	defer n.wg.Done()
+	defer func() {
+		events.Default.Unsubscribe(n.sub)
+	}()
+
+	lastID := ""
+	for {
+		select {
+		case event, ok := <-n.sub.C:
+			if !ok {
+				select {
+				case <-n.done:
+					return
+				default:
+				}
+				// The bus closes on shutdown, Stop sends what is pending
+				if events.Default.Closed() {
+					return
+				}
+				var backlog []events.Event
+				backlog, n.sub = events.Default.Subscribe(events.Filter{Types: types}, lastID)
+				for _, event := range backlog {
+					n.dispatch(event)
+					lastID = event.ID
+				}
+				continue
+			}
+			n.dispatch(event)
+			lastID = event.ID
+		case <-n.done:
+			return
+		}
+	}
+}
+
+// dispatch adds the event to the channels of every rule it matches, once per channel
+func (n *Notifier) dispatch(event events.Event) {
+	added := make(map[string]bool)
+	for _, rule := range n.rules {
+		if !Match(rule, event) {
+			continue
+		}
+		for _, name := range rule.Channels {
+			if added[name] {
+				continue
+			}
+			added[name] = true
+			n.channels[name].add(event)
+		}
+	}
+}
+
+// ruleEvents returns the event types of a rule, finding.created by default
+func ruleEvents(rule config.NotificationRuleConfig) []string {
+	if len(rule.Events) == 0 {
+		return []string{events.FindingCreated}
+	}
+	return rule.Events
+}
+
+// Match reports whether an event passes a rule. Categories, types, severity and repeats
+// only apply to findings; domains apply to every event.
+func Match(rule config.NotificationRuleConfig, event events.Event) bool {
+	if !slices.Contains(ruleEvents(rule), event.Type) {
+		return false
+	}
+	if !(events.Filter{Domains: rule.Domains}).Match(event) {
+		return false
+	}
+	if event.Type != events.FindingCreated {
+		return true
+	}
+
+	category, _ := event.Data["category"].(string)
+	if len(rule.Categories) > 0 && !slices.Contains(rule.Categories, category) {
+		return false
+	}
+	findingType, _ := event.Data["type"].(string)
+	if len(rule.Types) > 0 && !slices.Contains(rule.Types, findingType) {
+		return false
+	}
+	if rule.MinSeverity != "" {
+		severity, _ := event.Data["severity"].(string)
+		if slices.Index(config.Severities, severity) < slices.Index(config.Severities, rule.MinSeverity) {
+			return false
+		}
+	}
+	if isNew, ok := event.Data["new"].(bool); ok && !isNew && !rule.IncludeRepeats {
+		return false
+	}
+	return true
+}
+
+// add queues an event and starts the batch window when it is the first one
+func (c *channel) add(event events.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if fingerprint, _ := event.Data["fingerprint"].(string); fingerprint != "" {
+		if c.keys[fingerprint] {
+			return
+		}
+		c.keys[fingerprint] = true
+	}
+
+	if len(c.pending) < maxPending {
+		c.pending = append(c.pending, event)
+	} else {
+		c.omitted++
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, func() {
+			c.flush(context.Background(), false)
+		})
+	}
+}
+
+// flush sends the pending events as one message. While the rate limit is reached, the
+// events keep piling up in the batch and the flush is retried once a slot frees up.
+func (c *channel) flush(ctx context.Context, force bool) {
+	c.mu.Lock()
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if len(c.pending) == 0 && c.omitted == 0 {
+		c.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	c.sentAt = slices.DeleteFunc(c.sentAt, func(sent time.Time) bool {
+		return now.Sub(sent) >= rateWindow
+	})
+	if !force && c.config.MaxPerHour > 0 && len(c.sentAt) >= c.config.MaxPerHour {
+		wait := c.sentAt[0].Add(rateWindow).Sub(now)
+		c.timer = time.AfterFunc(wait, func() {
+			c.flush(context.Background(), false)
+		})
+		c.mu.Unlock()
+		return
+	}
+
+	batch := Batch{
+		Target:  config.Target,
+		Channel: c.config.Name,
+		SentAt:  now,
+		Events:  c.pending,
+		Omitted: c.omitted,
+	}
+
+	c.pending = nil
+	c.keys = make(map[string]bool)
+	c.omitted = 0
+	c.sentAt = append(c.sentAt, now)
+	c.mu.Unlock()
+
+	err := c.send(ctx, batch)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.stats.Failed++
+		c.stats.LastError = err.Error()
+		logger.Error("Failed to send notification to %s: %v", c.config.Name, err)
+		return
+	}
+	c.stats.Sent++
+	c.stats.Events += len(batch.Events) + batch.Omitted
+	c.stats.LastSentAt = &now
+	c.stats.LastError = ""
+}
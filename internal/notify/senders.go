@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/events"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+const (
+	// sendAttempts is how many times a webhook is tried before the message is given up
+	sendAttempts = 3
+	// retryDelay is the wait before the second attempt, doubled on every retry
+	retryDelay = 2 * time.Second
+
+	// maxValueLength truncates long finding values in chat and email messages
+	maxValueLength = 200
+	// discordMaxContent is the length limit of a Discord message, in characters
+	discordMaxContent = 2000
+)
+
+// Headers of the generic webhook. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the channel secret.
+const (
+	TimestampHeader = "X-JSHunter-Timestamp"
+	SignatureHeader = "X-JSHunter-Signature"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// newSender returns the delivery function of a channel. Chat and email messages list at
+// most maxBatch events; the generic webhook gets all of them.
+func newSender(app core.App, ch config.ChannelConfig, maxBatch int) sender {
+	switch ch.Type {
+	case config.ChannelSlack:
+		return func(ctx context.Context, batch Batch) error {
+			return postJSON(ctx, ch.URL, map[string]string{"text": formatText(batch, true, maxBatch)}, nil)
+		}
+	case config.ChannelDiscord:
+		return func(ctx context.Context, batch Batch) error {
+			content := formatText(batch, true, maxBatch)
+			// The limit counts characters, cut on one so no character is split
+			if runes := []rune(content); len(runes) > discordMaxContent {
+				content = string(runes[:discordMaxContent-3]) + "..."
+			}
+			return postJSON(ctx, ch.URL, map[string]string{"content": content}, nil)
+		}
+	case config.ChannelEmail:
+		return func(ctx context.Context, batch Batch) error {
+			return sendEmail(app, ch, batch, maxBatch)
+		}
+	default:
+		return func(ctx context.Context, batch Batch) error {
+			return postJSON(ctx, ch.URL, batch, []byte(ch.Secret))
+		}
+	}
+}
+
+// Sign returns the signature of a generic webhook body
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postJSON posts the payload, signed when a secret is given, retrying failed attempts
+func postJSON(ctx context.Context, url string, payload any, secret []byte) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		err = post(ctx, url, body, secret)
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// post sends one request
+func post(ctx context.Context, url string, body []byte, secret []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "JSHunter")
+	if len(secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// sendEmail sends the batch with the mailer of the target, configured in its PocketBase settings
+func sendEmail(app core.App, ch config.ChannelConfig, batch Batch, maxBatch int) error {
+	to := make([]mail.Address, 0, len(ch.To))
+	for _, address := range ch.To {
+		parsed, err := mail.ParseAddress(address)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", address, err)
+		}
+		to = append(to, *parsed)
+	}
+
+	meta := app.Settings().Meta
+	return app.NewMailClient().Send(&mailer.Message{
+		From:    mail.Address{Name: meta.SenderName, Address: meta.SenderAddress},
+		To:      to,
+		Subject: subject(batch),
+		Text:    formatText(batch, false, maxBatch),
+	})
+}
+
+// subject summarizes a batch in one line
+func subject(batch Batch) string {
+	total := len(batch.Events) + batch.Omitted
+	if total == 1 {
+		return fmt.Sprintf("[JSHunter] %s: %s", batch.Target, describe(batch.Events[0], false))
+	}
+	return fmt.Sprintf("[JSHunter] %s: %d %s", batch.Target, total, plural(total, "event"))
+}
+
+// formatText renders the first maxBatch events of a batch, one per line, with Markdown for chat channels
+func formatText(batch Batch, markdown bool, maxBatch int) string {
+	total := len(batch.Events) + batch.Omitted
+	listed := batch.Events[:min(len(batch.Events), maxBatch)]
+
+	var out strings.Builder
+	title := fmt.Sprintf("JSHunter - %s: %d %s", batch.Target, total, plural(total, "event"))
+	if markdown {
+		title = "*" + title + "*"
+	}
+	out.WriteString(title + "\n")
+
+	for _, event := range listed {
+		out.WriteString("- " + describe(event, markdown) + "\n")
+	}
+	if more := total - len(listed); more > 0 {
+		fmt.Fprintf(&out, "...and %d more\n", more)
+	}
+	return out.String()
+}
+
+// plural adds an s to the word unless count is 1
+func plural(count int, word string) string {
+	if count == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// describe renders one event
+func describe(event events.Event, markdown bool) string {
+	code := func(value string) string {
+		if len(value) > maxValueLength {
+			value = value[:maxValueLength] + "..."
+		}
+		if markdown {
+			return "`" + strings.ReplaceAll(value, "`", "'") + "`"
+		}
+		return value
+	}
+	str := func(key string) string {
+		value, _ := event.Data[key].(string)
+		return value
+	}
+	num := func(key string) int {
+		switch value := event.Data[key].(type) {
+		case int:
+			return value
+		case float64:
+			return int(value)
+		}
+		return 0
+	}
+
+	switch event.Type {
+	case events.FindingCreated:
+		return fmt.Sprintf("[%s] %s/%s %s in %s", str("severity"), str("category"), str("type"), code(str("value")), event.URL)
+	case events.ChangeDetected:
+		return fmt.Sprintf("Change on %s: %d new scripts, %d removed scripts, %d new findings",
+			event.URL, num("new_scripts"), num("removed_scripts"), num("new_findings"))
+	case "test":
+		return str("message")
+	default:
+		if event.URL != "" {
+			return fmt.Sprintf("%s %s", event.Type, event.URL)
+		}
+		return event.Type
+	}
+}
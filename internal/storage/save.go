@@ -2,6 +2,7 @@ package storage
 
 import (
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/metrics"
 	"github.com/jsh-team/jshunter/internal/utils/filesystem"
 	"github.com/jsh-team/jshunter/internal/utils/hash"
 	"github.com/jsh-team/jshunter/internal/utils/html"
@@ -41,10 +42,11 @@ func SaveJSFile(url string, content string) string {
 
 	// Write JS file if it doesn't exist
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+		if err := filesystem.WriteFileAtomic(fullPath, []byte(content), 0644); err != nil {
 			logger.Error("Failed to write JS file %s: %v", fullPath, err)
 			return ""
 		}
+		metrics.StoredBytes.Add(float64(len(content)), "js")
 	}
 
 	return contentHash
@@ -86,10 +88,11 @@ func SaveHTMLFile(url string, content string) string {
 	}
 
 	// Write HTML file
-	if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+	if err := filesystem.WriteFileAtomic(fullPath, []byte(content), 0644); err != nil {
 		logger.Error("Failed to write HTML file %s: %v", fullPath, err)
 		return ""
 	}
+	metrics.StoredBytes.Add(float64(len(content)), "html")
 
 	return hash
 }
@@ -0,0 +1,338 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultContext is the number of unchanged lines shown around every change
+const DefaultContext = 3
+
+// Options controls how two texts are compared
+type Options struct {
+	IgnoreWhitespace bool // Lines differing only in whitespace are equal
+	Context          int  // Unchanged lines around every change
+}
+
+// Result is the line diff of two texts
+type Result struct {
+	Unified string `json:"unified"` // Unified diff, empty when the texts are equal
+	Added   int    `json:"added"`   // Lines only in the new text
+	Removed int    `json:"removed"` // Lines only in the old text
+}
+
+// op is one line of the edit script
+type op struct {
+	kind byte // ' ', '-' or '+'
+	a, b int  // Line index in the old and new text
+}
+
+// Unified compares two texts line by line with the Myers algorithm and returns a unified
+// diff labelled with the given names
+func Unified(oldName string, newName string, oldText string, newText string, opts Options) Result {
+	a, b := splitLines(oldText), splitLines(newText)
+	script := compareLines(a, b, opts.IgnoreWhitespace)
+
+	result := Result{}
+	for _, line := range script {
+		switch line.kind {
+		case '+':
+			result.Added++
+		case '-':
+			result.Removed++
+		}
+	}
+	if result.Added == 0 && result.Removed == 0 {
+		return result
+	}
+
+	context := opts.Context
+	if context < 0 {
+		context = DefaultContext
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	writeHunks(&out, script, a, b, context)
+	result.Unified = out.String()
+	return result
+}
+
+// splitLines splits a text in lines without their line terminators
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// stripWhitespace removes every whitespace character of a line
+func stripWhitespace(line string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, line)
+}
+
+// compareLines returns the edit script turning a into b
+func compareLines(a []string, b []string, ignoreWhitespace bool) []op {
+	// Lines are compared through integer IDs, equal lines sharing the same ID
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			if ignoreWhitespace {
+				line = stripWhitespace(line)
+			}
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+
+	aIDs, bIDs := intern(a), intern(b)
+	removed := make([]bool, len(a))
+	added := make([]bool, len(b))
+
+	// Lines found in only one text are changes whatever the rest: leaving them out keeps
+	// the edit script minimal and makes completely rewritten files cheap to compare
+	inA := make(map[int]bool, len(aIDs))
+	for _, id := range aIDs {
+		inA[id] = true
+	}
+	inB := make(map[int]bool, len(bIDs))
+	for _, id := range bIDs {
+		inB[id] = true
+	}
+	var aKept, bKept []int // Indexes of the lines compared by the differ
+	for i, id := range aIDs {
+		if inB[id] {
+			aKept = append(aKept, i)
+		} else {
+			removed[i] = true
+		}
+	}
+	for j, id := range bIDs {
+		if inA[id] {
+			bKept = append(bKept, j)
+		} else {
+			added[j] = true
+		}
+	}
+
+	d := &differ{
+		a:       make([]int, len(aKept)),
+		b:       make([]int, len(bKept)),
+		removed: make([]bool, len(aKept)),
+		added:   make([]bool, len(bKept)),
+	}
+	for i, index := range aKept {
+		d.a[i] = aIDs[index]
+	}
+	for j, index := range bKept {
+		d.b[j] = bIDs[index]
+	}
+	d.compare(0, len(d.a), 0, len(d.b))
+	for i, index := range aKept {
+		removed[index] = removed[index] || d.removed[i]
+	}
+	for j, index := range bKept {
+		added[index] = added[index] || d.added[j]
+	}
+
+	// Within a change, removed lines come before added lines
+	script := make([]op, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && removed[i]:
+			script = append(script, op{kind: '-', a: i, b: j})
+			i++
+		case j < len(b) && added[j]:
+			script = append(script, op{kind: '+', a: i, b: j})
+			j++
+		default:
+			script = append(script, op{kind: ' ', a: i, b: j})
+			i++
+			j++
+		}
+	}
+	return script
+}
+
+// differ finds a shortest edit script in linear space by recursively splitting
+// the problem on the middle snake (Myers, "An O(ND) Difference Algorithm", 4b)
+type differ struct {
+	a, b           []int
+	removed, added []bool
+}
+
+// compare marks the lines of a[aLo:aHi] and b[bLo:bHi] that are removed or added
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.removed[i] = true
+		}
+	default:
+		x, y := d.split(aLo, aHi, bLo, bHi)
+		if (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+			// No progress possible: replace the whole range
+			for i := aLo; i < aHi; i++ {
+				d.removed[i] = true
+			}
+			for j := bLo; j < bHi; j++ {
+				d.added[j] = true
+			}
+			return
+		}
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aHi, y, bHi)
+	}
+}
+
+// split returns a point of a shortest edit path of the two ranges, found where the paths
+// searched from the start and from the end overlap
+func (d *differ) split(aLo, aHi, bLo, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	limit := (n + m + 1) / 2
+	offset := limit + 1
+
+	// forward[k] is the furthest x reached on diagonal k = x - y from the start;
+	// backward[k] the same from the end, in reversed coordinates
+	forward := make([]int, 2*limit+3)
+	backward := make([]int, 2*limit+3)
+
+	for step := 0; step <= limit; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			if odd && k >= delta-(step-1) && k <= delta+(step-1) && x+backward[offset+delta-k] >= n {
+				return aLo + x, bLo + y
+			}
+		}
+
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			if !odd && k >= delta-step && k <= delta+step && x+forward[offset+delta-k] >= n {
+				return aHi - x, bHi - y
+			}
+		}
+	}
+
+	// Unreachable for a valid input: the paths always overlap within the limit
+	return aLo, bLo
+}
+
+// writeHunks writes the changes of the edit script with their surrounding context
+func writeHunks(out *strings.Builder, script []op, a []string, b []string, context int) {
+	for start := 0; start < len(script); {
+		// Find the next change
+		for start < len(script) && script[start].kind == ' ' {
+			start++
+		}
+		if start == len(script) {
+			return
+		}
+
+		// Extend the hunk while the next change is close enough to share context
+		end := start
+		for i := start; i < len(script); i++ {
+			if script[i].kind == ' ' {
+				continue
+			}
+			if i-end > 2*context {
+				break
+			}
+			end = i + 1
+		}
+
+		first := max(start-context, 0)
+		last := min(end+context, len(script))
+
+		oldCount, newCount := 0, 0
+		for _, line := range script[first:last] {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(script[first].a, oldCount), hunkRange(script[first].b, newCount))
+
+		for _, line := range script[first:last] {
+			switch line.kind {
+			case '-':
+				fmt.Fprintf(out, "-%s\n", a[line.a])
+			case '+':
+				fmt.Fprintf(out, "+%s\n", b[line.b])
+			default:
+				fmt.Fprintf(out, " %s\n", b[line.b])
+			}
+		}
+
+		start = last
+	}
+}
+
+// hunkRange formats the start line and length of a hunk side; an empty side starts
+// at the line before it, as in GNU diff
+func hunkRange(start int, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
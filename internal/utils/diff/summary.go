@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// minLiteralLength skips the short string literals that carry no information ("", "a", "px")
+const minLiteralLength = 3
+
+var (
+	// stringLiteral matches single, double and backtick quoted JavaScript strings
+	stringLiteral = regexp.MustCompile("\"(?:[^\"\\\\\\n]|\\\\.)*\"|'(?:[^'\\\\\\n]|\\\\.)*'|`(?:[^`\\\\]|\\\\.)*`")
+	// absoluteURL matches http(s) and protocol relative URLs anywhere in the code
+	absoluteURL = regexp.MustCompile("(?:https?:)?//[A-Za-z0-9.-]+\\.[A-Za-z]{2,}(?::\\d+)?(?:/[^\\s\"'`<>()\\\\]*)?")
+)
+
+// Changes lists the items only in the old or only in the new text
+type Changes struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Summary lists the string literals and URLs added and removed between two scripts
+type Summary struct {
+	Strings Changes `json:"strings"`
+	URLs    Changes `json:"urls"`
+}
+
+// Summarize compares the string literals and URLs of two scripts. Paths in string
+// literals ("/api/v2/users") count as URLs.
+func Summarize(oldText string, newText string) Summary {
+	oldStrings, oldURLs := literals(oldText)
+	newStrings, newURLs := literals(newText)
+	return Summary{
+		Strings: compareSets(oldStrings, newStrings),
+		URLs:    compareSets(oldURLs, newURLs),
+	}
+}
+
+// literals returns the distinct string literals and URLs of a script
+func literals(text string) (map[string]bool, map[string]bool) {
+	strs := make(map[string]bool)
+	urls := make(map[string]bool)
+
+	for _, match := range stringLiteral.FindAllString(text, -1) {
+		value := match[1 : len(match)-1]
+		if len(value) < minLiteralLength {
+			continue
+		}
+		strs[value] = true
+		if strings.HasPrefix(value, "/") && !strings.HasPrefix(value, "//") && strings.ContainsFunc(value, isLetter) && !strings.ContainsAny(value, " \t\n") {
+			urls[value] = true
+		}
+	}
+	for _, match := range absoluteURL.FindAllString(text, -1) {
+		urls[match] = true
+	}
+
+	return strs, urls
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// compareSets returns the sorted items only in newSet (added) and only in oldSet (removed)
+func compareSets(oldSet map[string]bool, newSet map[string]bool) Changes {
+	changes := Changes{Added: []string{}, Removed: []string{}}
+	for item := range newSet {
+		if !oldSet[item] {
+			changes.Added = append(changes.Added, item)
+		}
+	}
+	for item := range oldSet {
+		if !newSet[item] {
+			changes.Removed = append(changes.Removed, item)
+		}
+	}
+	slices.Sort(changes.Added)
+	slices.Sort(changes.Removed)
+	return changes
+}
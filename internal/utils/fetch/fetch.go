@@ -8,9 +8,12 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/jsh-team/jshunter/internal/metrics"
+
 	"go.uber.org/ratelimit"
 )
 
@@ -100,6 +103,7 @@ func (s *assetFetcherImpl) Request(ctx context.Context, url string, method strin
 	req.Header.Set("accept-encoding", "gzip")
 
 	resp, err := s.client.Do(req)
+	recordRequest(method, resp)
 
 	if err != nil {
 		return "", false, nil
@@ -155,6 +159,7 @@ func (s *assetFetcherImpl) RequestWithContentType(ctx context.Context, url strin
 	req.Header.Set("accept-encoding", "gzip")
 
 	resp, err := s.client.Do(req)
+	recordRequest(method, resp)
 
 	if err != nil {
 		return "", "", false, nil
@@ -195,3 +200,12 @@ func (s *assetFetcherImpl) RequestWithContentType(ctx context.Context, url strin
 
 	return string(body), contentType, resp.StatusCode == http.StatusOK, nil
 }
+
+// recordRequest counts a request by method and status code ("error" when no response was received)
+func recordRequest(method string, resp *http.Response) {
+	code := "error"
+	if resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metrics.FetchRequests.Inc(method, code)
+}
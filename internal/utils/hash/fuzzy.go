@@ -0,0 +1,78 @@
+package hash
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// fuzzyShingle is how many consecutive tokens make up one feature of the fuzzy hash
+const fuzzyShingle = 3
+
+// fuzzyMinToken drops shorter tokens, mostly minified identifiers renamed on every build
+const fuzzyMinToken = 3
+
+// GenerateFuzzyHash returns a 64-bit simhash of the content as 16 hex characters. Similar
+// contents get hashes that differ in few bits, so two builds of the same bundle stay close
+// even when the minifier renames identifiers. It returns "" for content without tokens.
+func GenerateFuzzyHash(content string) string {
+	tokens := strings.FieldsFunc(content, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '$'
+	})
+
+	var kept []string
+	for _, token := range tokens {
+		if len(token) >= fuzzyMinToken {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == 0 {
+		return ""
+	}
+
+	shingle := min(fuzzyShingle, len(kept))
+	var weights [64]int
+	for i := 0; i+shingle <= len(kept); i++ {
+		hasher := fnv.New64a()
+		for _, token := range kept[i : i+shingle] {
+			hasher.Write([]byte(token))
+			hasher.Write([]byte{0})
+		}
+		sum := hasher.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var simhash uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			simhash |= 1 << bit
+		}
+	}
+	return fmt.Sprintf("%016x", simhash)
+}
+
+// FuzzySimilarity compares two fuzzy hashes and returns 1 for identical hashes down to 0
+// for hashes differing in every bit. Invalid or empty hashes have a similarity of 0.
+func FuzzySimilarity(a string, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	x, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0
+	}
+	y, err := strconv.ParseUint(b, 16, 64)
+	if err != nil {
+		return 0
+	}
+	return 1 - float64(bits.OnesCount64(x^y))/64
+}
@@ -12,42 +12,71 @@ import (
 
 // GenerateHTMLHash normalizes an HTML string and returns a SHA-256 hash of the meaningful content.
 func GenerateHTMLHash(htmlContent string) (string, error) {
+	normalized, err := NormalizeHTML(htmlContent)
+	if err != nil {
+		return "", err
+	}
+
+	// Generate SHA-256 hash
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// dynamicText matches text that changes on every load of a page
+var dynamicText = []*regexp.Regexp{
+	regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`), // UUIDs
+	regexp.MustCompile(`\d{4}-\d{2}-\d{2}T?\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2})?`),     // ISO dates
+	regexp.MustCompile(`nonce-[0-9a-f]+`),                                              // WordPress nonces
+}
+
+// NormalizeHTML returns the structure of a page the structural hash is computed from: the
+// element tree without comments, inline scripts, styles or meta tags, only the href, src
+// and action attributes, dynamic text such as UUIDs and dates removed and whitespace
+// collapsed. New links, forms and script tags change it; a new nonce does not.
+func NormalizeHTML(htmlContent string) (string, error) {
 	// Parse HTML into a goquery document
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(htmlContent))
 	if err != nil {
 		return "", err
 	}
 
-	// Remove comments
-	doc.Find("comment").Remove()
-
-	// Remove dynamic elements: scripts, styles, and meta tags
-	doc.Find("script, style, meta").Remove()
+	// Remove dynamic elements: inline scripts, styles, and meta tags. External scripts
+	// are kept for their src.
+	doc.Find("script:not([src]), style, meta").Remove()
 
 	// Remove all attributes except essential ones (e.g., keep href, src for functionality)
 	doc.Find("*").Each(func(i int, s *goquery.Selection) {
 		attrs := s.Nodes[0].Attr
 		s.Nodes[0].Attr = nil // Clear all attributes
 		for _, attr := range attrs {
-			// Keep only essential attributes like href, src
-			if attr.Key == "href" || attr.Key == "src" {
+			// Keep only essential attributes like href, src and the target of forms
+			if attr.Key == "href" || attr.Key == "src" || attr.Key == "action" {
 				s.SetAttr(attr.Key, attr.Val)
 			}
 		}
 	})
 
-	// Normalize text content (optional: remove dynamic text like dates or nonces)
-	doc.Find("*").Each(func(i int, s *goquery.Selection) {
-		text := s.Text()
-		// Remove common WordPress dynamic patterns (e.g., nonces, timestamps)
-		text = regexp.MustCompile(`[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`).ReplaceAllString(text, "") // UUIDs
-		text = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T?\d{2}:\d{2}:\d{2}(Z|[+-]\d{2}:\d{2})?`).ReplaceAllString(text, "")     // ISO dates
-		text = regexp.MustCompile(`nonce-[0-9a-f]+`).ReplaceAllString(text, "")                                              // WordPress nonces
-		s.Nodes[0].FirstChild = &html.Node{
-			Type: html.TextNode,
-			Data: text,
+	// Remove comments and normalize text content (remove dynamic text like dates or nonces)
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; {
+			next := child.NextSibling
+			switch child.Type {
+			case html.CommentNode:
+				node.RemoveChild(child)
+			case html.TextNode:
+				for _, pattern := range dynamicText {
+					child.Data = pattern.ReplaceAllString(child.Data, "")
+				}
+			default:
+				walk(child)
+			}
+			child = next
 		}
-	})
+	}
+	for _, node := range doc.Nodes {
+		walk(node)
+	}
 
 	// Get normalized HTML
 	normalized, err := doc.Html()
@@ -56,9 +85,11 @@ func GenerateHTMLHash(htmlContent string) (string, error) {
 	}
 
 	// Normalize whitespace: collapse multiple spaces, remove newlines
-	normalized = strings.Join(strings.Fields(strings.TrimSpace(normalized)), " ")
+	return strings.Join(strings.Fields(strings.TrimSpace(normalized)), " "), nil
+}
 
-	// Generate SHA-256 hash
-	hash := sha256.Sum256([]byte(normalized))
-	return hex.EncodeToString(hash[:]), nil
+// SplitTags puts every tag of a normalized page on its own line, so two pages can be
+// compared line by line
+func SplitTags(normalized string) string {
+	return strings.TrimPrefix(strings.ReplaceAll(normalized, "<", "\n<"), "\n")
 }
@@ -1,84 +1,234 @@
 package logger
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 )
 
-func logger() zerolog.Logger {
-	// Customize ConsoleWriter
-	consoleWriter := zerolog.ConsoleWriter{
-		Out:        os.Stderr,
-		TimeFormat: time.RFC3339, // Custom time format
+// Output formats
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+// Options configures the process logger
+type Options struct {
+	Level      string // debug, info, warn, error
+	Format     string // console or json
+	File       string // Log file written in addition to stderr, disabled when empty
+	MaxSizeMB  int    // Size at which the log file is rotated
+	MaxBackups int    // Number of rotated log files kept
+	NoColor    bool   // Disable ANSI colours on the console
+}
+
+// Fields are attached to every line of a Logger
+type Fields map[string]any
+
+// Logger writes log lines carrying a fixed set of fields
+type Logger struct {
+	fields Fields
+}
+
+type contextKey struct{}
+
+var (
+	base    atomic.Pointer[zerolog.Logger]
+	logFile io.Closer
+)
+
+func init() {
+	l := newZerolog(consoleWriter(os.Stderr, false), zerolog.InfoLevel)
+	base.Store(&l)
+}
+
+// Configure replaces the process logger. It is called once the command line is parsed;
+// until then lines go to stderr at info level.
+func Configure(opts Options) error {
+	level := zerolog.InfoLevel
+	if opts.Level != "" {
+		parsed, err := zerolog.ParseLevel(strings.ToLower(opts.Level))
+		if err != nil || parsed == zerolog.NoLevel {
+			return fmt.Errorf("invalid log level %q (use debug, info, warn or error)", opts.Level)
+		}
+		level = parsed
+	}
+
+	var stderr io.Writer
+	switch opts.Format {
+	case "", FormatConsole:
+		stderr = consoleWriter(os.Stderr, opts.NoColor)
+	case FormatJSON:
+		stderr = os.Stderr
+	default:
+		return fmt.Errorf("invalid log format %q (use console or json)", opts.Format)
 	}
-	consoleWriter.FormatLevel = func(i interface{}) string {
+
+	writer := stderr
+	if opts.File != "" {
+		file, err := NewRotatingFile(opts.File, opts.MaxSizeMB, opts.MaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+
+		var fileWriter io.Writer = file
+		if opts.Format != FormatJSON {
+			fileWriter = consoleWriter(file, true)
+		}
+		writer = zerolog.MultiLevelWriter(stderr, fileWriter)
+
+		if logFile != nil {
+			logFile.Close()
+		}
+		logFile = file
+	}
+
+	l := newZerolog(writer, level)
+	base.Store(&l)
+	return nil
+}
+
+// newZerolog builds a logger writing to w from the given level
+func newZerolog(w io.Writer, level zerolog.Level) zerolog.Logger {
+	return zerolog.New(w).
+		Level(level).
+		With().
+		Timestamp().
+		Logger()
+}
+
+// consoleWriter formats lines for humans
+func consoleWriter(out io.Writer, noColor bool) zerolog.ConsoleWriter {
+	writer := zerolog.ConsoleWriter{
+		Out:        out,
+		NoColor:    noColor,
+		TimeFormat: time.RFC3339,
+	}
+	writer.FormatLevel = func(i interface{}) string {
+		level := fmt.Sprintf("[%s]", strings.ToUpper(fmt.Sprint(i)))
+		if noColor {
+			return level
+		}
 		switch i {
 		case "info":
-			return "\033[32m[INFO]\033[0m" // Green
+			return "\033[32m" + level + "\033[0m" // Green
 		case "error":
-			return "\033[31m[ERROR]\033[0m" // Red
+			return "\033[31m" + level + "\033[0m" // Red
 		case "debug":
-			return "\033[36m[DEBUG]\033[0m" // Cyan
+			return "\033[36m" + level + "\033[0m" // Cyan
 		case "warn":
-			return "\033[33m[WARN]\033[0m" // Yellow
+			return "\033[33m" + level + "\033[0m" // Yellow
 		case "fatal":
-			return "\033[35m[FATAL]\033[0m" // Magenta
+			return "\033[35m" + level + "\033[0m" // Magenta
 		default:
-			return fmt.Sprintf("[%s]", i)
+			return level
 		}
 	}
-	consoleWriter.FormatMessage = func(i interface{}) string {
+	writer.FormatMessage = func(i interface{}) string {
 		return fmt.Sprintf("%s", i)
 	}
-	consoleWriter.FormatFieldName = func(i interface{}) string {
+	writer.FormatFieldName = func(i interface{}) string {
+		if noColor {
+			return fmt.Sprintf("%s:", i)
+		}
 		return fmt.Sprintf("\033[1m%s:\033[0m", i) // Bold field names
 	}
-	consoleWriter.FormatFieldValue = func(i interface{}) string {
+	writer.FormatFieldValue = func(i interface{}) string {
 		return fmt.Sprintf("%v", i)
 	}
+	return writer
+}
 
-	return zerolog.New(consoleWriter).
-		Level(zerolog.InfoLevel).
-		With().
-		Timestamp().
-		Logger()
+// With returns a logger attaching the fields to every line
+func With(fields Fields) Logger {
+	return Logger{fields: fields}
 }
 
-func Info(message string, args ...interface{}) {
-	logger := logger()
-	if len(args) == 0 {
-		logger.Info().Msg(message)
-	} else {
-		logger.Info().Msgf(message, args...)
+// With returns a logger with the fields added to those of l
+func (l Logger) With(fields Fields) Logger {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
 	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return Logger{fields: merged}
 }
 
-func Error(message string, args ...interface{}) {
-	logger := logger()
-	if len(args) == 0 {
-		logger.Error().Msg(message)
-	} else {
-		logger.Error().Msgf(message, args...)
+// NewContext returns a context carrying the logger
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger of the context, or a logger without fields
+func FromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return l
 	}
+	return Logger{}
 }
 
-func Fatal(message string, args ...interface{}) {
-	logger := logger()
+// log writes a line at the given level
+func (l Logger) log(level zerolog.Level, message string, args []interface{}) {
+	event := base.Load().WithLevel(level)
+	if event == nil {
+		return
+	}
+	if len(l.fields) > 0 {
+		event = event.Fields(map[string]interface{}(l.fields))
+	}
 	if len(args) == 0 {
-		logger.Fatal().Msg(message)
+		event.Msg(message)
 	} else {
-		logger.Fatal().Msgf(message, args...)
+		event.Msgf(message, args...)
 	}
 }
 
+func (l Logger) Info(message string, args ...interface{}) {
+	l.log(zerolog.InfoLevel, message, args)
+}
+
+func (l Logger) Warn(message string, args ...interface{}) {
+	l.log(zerolog.WarnLevel, message, args)
+}
+
+func (l Logger) Error(message string, args ...interface{}) {
+	l.log(zerolog.ErrorLevel, message, args)
+}
+
+func (l Logger) Debug(message string, args ...interface{}) {
+	l.log(zerolog.DebugLevel, message, args)
+}
+
+// Fatal logs the message and exits the process
+func (l Logger) Fatal(message string, args ...interface{}) {
+	l.log(zerolog.FatalLevel, message, args)
+	os.Exit(1)
+}
+
+func Info(message string, args ...interface{}) {
+	Logger{}.Info(message, args...)
+}
+
+func Warn(message string, args ...interface{}) {
+	Logger{}.Warn(message, args...)
+}
+
+func Error(message string, args ...interface{}) {
+	Logger{}.Error(message, args...)
+}
+
+func Fatal(message string, args ...interface{}) {
+	Logger{}.Fatal(message, args...)
+}
+
 func Debug(message string, args ...interface{}) {
-	logger := logger()
-	if len(args) == 0 {
-		logger.Debug().Msg(message)
-	} else {
-		logger.Debug().Msgf(message, args...)
-	}
+	Logger{}.Debug(message, args...)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/url"
+	"path"
+	"regexp"
 	"strings"
 )
 
@@ -128,3 +130,98 @@ func NormalizeURL(scriptURL, baseURL string) string {
 	}
 	return scriptURL
 }
+
+// hashLikeToken matches the alphanumeric runs of a path that may be a build hash
+var hashLikeToken = regexp.MustCompile(`[A-Za-z0-9]+`)
+
+// isHashLike reports whether a token of a file name looks like a content hash or build ID
+// rather than a name: hex with a digit and at least 5 characters (main.3f2a1.js), mixed
+// letters and digits of 8 characters or more (base36/base64 hashes) or a long number.
+func isHashLike(token string) bool {
+	hasDigit, hasLetter, isHex := false, false, true
+	for _, r := range token {
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F'):
+			hasLetter = true
+		default:
+			hasLetter = true
+			isHex = false
+		}
+	}
+
+	switch {
+	case !hasDigit:
+		return false
+	case !hasLetter:
+		return len(token) >= 8
+	case isHex:
+		return len(token) >= 5
+	default:
+		return len(token) >= 8
+	}
+}
+
+// URLPattern normalises a script URL so successive builds of the same bundle share it:
+// the query string and fragment are dropped, the host is lowercased and every
+// hash-like token of the path is replaced by "*" (main.3f2a1.js becomes main.*.js).
+func URLPattern(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	segments := strings.Split(parsedURL.Path, "/")
+	for i, segment := range segments {
+		segments[i] = hashLikeToken.ReplaceAllStringFunc(segment, func(token string) string {
+			if isHashLike(token) {
+				return "*"
+			}
+			return token
+		})
+	}
+
+	return strings.ToLower(parsedURL.Scheme) + "://" + strings.ToLower(parsedURL.Host) + strings.Join(segments, "/")
+}
+
+// hashSeparators are the characters joining a build hash to the rest of a file name
+const hashSeparators = ".-_~"
+
+// NormalizedPath returns the path of a script URL without its build hashes, so successive
+// builds of the same bundle share it: /static/js/main.3f2a1.js becomes static/js/main.js.
+// Every hash-like token is dropped with the separator before it; a segment that is only
+// a hash (3f2a1b9c.js) is kept as is. The query string and fragment are ignored.
+func NormalizedPath(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parsedURL.Path, "/") {
+		if segment == "" {
+			continue
+		}
+
+		var out strings.Builder
+		last := 0
+		for _, bounds := range hashLikeToken.FindAllStringIndex(segment, -1) {
+			start, end := bounds[0], bounds[1]
+			if !isHashLike(segment[start:end]) {
+				continue
+			}
+			out.WriteString(strings.TrimRight(segment[last:start], hashSeparators))
+			last = end
+		}
+		out.WriteString(segment[last:])
+
+		// Nothing but the extension left: the hash is the name
+		name := strings.TrimLeft(out.String(), hashSeparators)
+		if name == "" || "."+name == path.Ext(segment) {
+			name = segment
+		}
+		segments = append(segments, name)
+	}
+	return strings.Join(segments, "/")
+}
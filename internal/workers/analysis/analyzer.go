@@ -1,9 +1,11 @@
 package analysis
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
 	"os"
 	"os/exec"
 )
@@ -99,16 +101,20 @@ func NewNodeJSAnalyzer() (*NodeJSAnalyzer, error) {
 	}, nil
 }
 
-// AnalyzeFile performs analysis on a JavaScript file using the Node.js analyzer
-func (n *NodeJSAnalyzer) AnalyzeFile(filePath string) ([]Finding, error) {
+// AnalyzeFile performs analysis on a JavaScript file using the Node.js analyzer.
+// The analyzer process is killed when ctx is done.
+func (n *NodeJSAnalyzer) AnalyzeFile(ctx context.Context, filePath string) ([]Finding, error) {
 	// Check if the file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("file does not exist: %s", filePath)
 	}
 
 	// Run the Node.js analyzer with the file path
-	cmd := exec.Command(n.analyzerPath, filePath)
-	output, err := cmd.Output()
+	cmd := exec.CommandContext(ctx, n.analyzerPath, filePath)
+	output, err := jobrun.Output(ctx, cmd)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("Node.js analyzer interrupted: %w", ctx.Err())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to run Node.js analyzer: %w", err)
 	}
@@ -253,11 +259,11 @@ func (n *NodeJSAnalyzer) convertToFindings(result NodeJSAnalyzerResult) []Findin
 }
 
 // AnalyzeFile is the main entry point for analyzing a JavaScript file
-func AnalyzeFile(filePath string) ([]Finding, error) {
+func AnalyzeFile(ctx context.Context, filePath string) ([]Finding, error) {
 	analyzer, err := NewNodeJSAnalyzer()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create analyzer: %w", err)
 	}
 
-	return analyzer.AnalyzeFile(filePath)
+	return analyzer.AnalyzeFile(ctx, filePath)
 }
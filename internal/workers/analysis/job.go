@@ -1,18 +1,30 @@
 package analysis
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/jsh-team/jshunter/internal/metrics"
 	"github.com/jsh-team/jshunter/internal/storage"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+	"github.com/jsh-team/jshunter/internal/workers/triage"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 // processJob processes a single analysis job
-func (p *AnalysisWorkerPool) processJob(workerID int, job AnalysisJob) {
+func (p *AnalysisWorkerPool) processJob(ctx context.Context, workerID int, job AnalysisJob) {
+	run := jobrun.Start(job.App, "analysis", job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+	log := run.Logger()
+
 	startTime := time.Now()
 	errorCount := 0
 	jsFileRecord := job.Record
@@ -22,10 +34,9 @@ func (p *AnalysisWorkerPool) processJob(workerID int, job AnalysisJob) {
 	fileURL := jsFileRecord.GetString("url")
 	if bodyHash == "" || fileURL == "" {
 		errorCount++
-		logger.Error("Analysis Worker %d failed: missing hash or URL for record %s", workerID, jsFileRecord.Id)
-		jsFileRecord.Set("analysis_status", "failed")
-		job.App.Save(jsFileRecord)
-		logger.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Analysis Worker %d failed: missing hash or URL for record %s", workerID, jsFileRecord.Id)
+		markFailed(ctx, job, "", fmt.Errorf("missing hash or URL"))
+		log.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
@@ -33,46 +44,72 @@ func (p *AnalysisWorkerPool) processJob(workerID int, job AnalysisJob) {
 	fullPath, err := storage.GetJSFilePath(fileURL, bodyHash)
 	if err != nil {
 		errorCount++
-		logger.Error("Analysis Worker %d failed to get file path for %s: %v", workerID, fileURL, err)
-		jsFileRecord.Set("analysis_status", "failed")
-		job.App.Save(jsFileRecord)
-		logger.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Analysis Worker %d failed to get file path for %s: %v", workerID, fileURL, err)
+		markFailed(ctx, job, "", err)
+		log.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
 	// Analyze JavaScript file directly using the integrated analyzer
-	findings, err := AnalyzeFile(fullPath)
+	findings, err := AnalyzeFile(ctx, fullPath)
 	if err != nil {
 		errorCount++
-		logger.Error("Analysis Worker %d failed to analyze file %s: %v", workerID, fullPath, err)
-		jsFileRecord.Set("analysis_status", "failed")
-		job.App.Save(jsFileRecord)
-		logger.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Analysis Worker %d failed to analyze file %s: %v", workerID, fullPath, err)
+		markFailed(ctx, job, fullPath, err)
+		log.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
-	// Save findings to database
-	_, err = p.saveFindings(job.App, jsFileRecord.Id, findings)
-	if err != nil {
+	// Save findings and final status to database
+	if err := Complete(job.App, jsFileRecord, findings); err != nil {
 		errorCount++
-		logger.Error("Analysis Worker %d failed to save findings for %s: %v", workerID, jsFileRecord.GetString("url"), err)
-		jsFileRecord.Set("analysis_status", "failed")
-		job.App.Save(jsFileRecord)
-		logger.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Analysis Worker %d failed to save results for %s: %v", workerID, jsFileRecord.GetString("url"), err)
+		markFailed(ctx, job, fullPath, err)
+		log.Info("Analysis worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
-	// Update final status
+}
+
+// Complete saves the findings of a JavaScript file and marks its analysis as processed
+func Complete(app *pocketbase.PocketBase, jsFileRecord *core.Record, findings []Finding) error {
+	if _, err := SaveFindings(app, jsFileRecord.Id, findings); err != nil {
+		return err
+	}
+
 	jsFileRecord.Set("analysis_status", "processed")
-	if err := job.App.Save(jsFileRecord); err != nil {
-		errorCount++
-		logger.Error("Analysis Worker %d failed to save final record for %s: %v", workerID, jsFileRecord.GetString("url"), err)
+	return app.Save(jsFileRecord)
+}
+
+// markFailed sets the failure status of the analysis job and stores it in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job AnalysisJob, inputPath string, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	Fail(job.App, job.Record, status, inputPath, err)
+}
+
+// Fail sets the given failure status on a JavaScript file and stores it in the dead letters
+// collection, unless the status is pending (the job was only interrupted)
+func Fail(app *pocketbase.PocketBase, jsFileRecord *core.Record, status string, inputPath string, err error) {
+	jsFileRecord.Set("analysis_status", status)
+	app.Save(jsFileRecord)
+	if status == pool.StatusPending {
+		return
 	}
 
+	deadletter.Record(app, deadletter.Entry{
+		Stage:      "analysis",
+		Collection: "js_files",
+		RecordID:   jsFileRecord.Id,
+		URL:        jsFileRecord.GetString("url"),
+		InputPath:  inputPath,
+		Err:        err,
+	})
 }
 
-// saveFindings saves analysis findings to the database
-func (p *AnalysisWorkerPool) saveFindings(app *pocketbase.PocketBase, jsFileID string, findings []Finding) (int, error) {
+// SaveFindings saves analysis findings to the database
+func SaveFindings(app *pocketbase.PocketBase, jsFileID string, findings []Finding) (int, error) {
 	if len(findings) == 0 {
 		return 0, nil
 	}
@@ -82,26 +119,61 @@ func (p *AnalysisWorkerPool) saveFindings(app *pocketbase.PocketBase, jsFileID s
 		return 0, fmt.Errorf("error fetching findings collection: %w", err)
 	}
 
+	// The fingerprint scope is the lineage of the file
+	jsFile, _ := app.FindRecordById("js_files", jsFileID)
+
 	savedCount := 0
+	categories := make([]string, 0, len(findings))
 	now := time.Now()
 
-	for _, finding := range findings {
-		// Create finding record
-		newRecord := core.NewRecord(findingsCollection)
-		newRecord.Set("type", finding.Type)
-		newRecord.Set("line", finding.Line)
-		newRecord.Set("column", finding.Column)
-		newRecord.Set("value", finding.Value)
-		newRecord.Set("js_file", jsFileID)
-		newRecord.Set("metadata", finding.Data)
-		newRecord.Set("created_at", now)
-
-		if err := app.Save(newRecord); err != nil {
-			// Log error but continue with other findings
-			logger.Error("Error saving finding: %v", err)
-			continue
+	// One transaction for all findings of the file instead of one commit per row
+	err = app.RunInTransaction(func(txApp core.App) error {
+		tracker, err := fingerprint.NewTracker(txApp)
+		if err != nil {
+			return err
 		}
-		savedCount++
+
+		for _, finding := range findings {
+			category, _ := finding.Data["finding_category"].(string)
+
+			// Create finding record
+			newRecord := core.NewRecord(findingsCollection)
+			newRecord.Set("type", finding.Type)
+			newRecord.Set("line", finding.Line)
+			newRecord.Set("column", finding.Column)
+			newRecord.Set("value", finding.Value)
+			newRecord.Set("js_file", jsFileID)
+			newRecord.Set("metadata", finding.Data)
+			newRecord.Set("created_at", now)
+
+			key := fingerprint.Compute(category, finding.Type, finding.Value, fingerprint.Scope(jsFile))
+			newRecord.Set("fingerprint", key)
+			newRecord.Set("unique_key", fingerprint.Key(category, finding.Value))
+
+			// A finding detected again starts from the last triage decision on it
+			newRecord.Set("status", triage.StatusNew)
+			newRecord.Set("severity", Severity(category, finding.Data))
+			triage.Inherit(newRecord, tracker.Find(key))
+
+			if err := txApp.Save(newRecord); err != nil {
+				// Log error but continue with other findings
+				logger.Error("Error saving finding: %v", err)
+				continue
+			}
+			if _, err := tracker.Observe(category, finding.Type, finding.Value, jsFile, now); err != nil {
+				logger.Error("Error tracking finding: %v", err)
+			}
+			savedCount++
+			categories = append(categories, category)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error saving findings: %w", err)
+	}
+
+	for _, category := range categories {
+		metrics.Findings.Inc(category)
 	}
 
 	return savedCount, nil
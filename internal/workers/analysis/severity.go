@@ -0,0 +1,28 @@
+package analysis
+
+import (
+	"slices"
+
+	"github.com/jsh-team/jshunter/internal/config"
+)
+
+// categorySeverity is the severity of the findings of each analyzer category
+var categorySeverity = map[string]string{
+	"domxss":  "high",
+	"httpapi": "medium",
+	"graphql": "medium",
+	"url":     "low",
+	"event":   "info",
+}
+
+// Severity returns the severity of a finding: the security_risk set by the analyzer when
+// there is one, otherwise the severity of its category
+func Severity(category string, data map[string]any) string {
+	if risk, _ := data["security_risk"].(string); slices.Contains(config.Severities, risk) {
+		return risk
+	}
+	if severity, ok := categorySeverity[category]; ok {
+		return severity
+	}
+	return "info"
+}
@@ -1,8 +1,7 @@
 package analysis
 
 import (
-	"context"
-	"sync"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -16,11 +15,5 @@ type AnalysisJob struct {
 
 // AnalysisWorkerPool manages a pool of workers for JavaScript analysis
 type AnalysisWorkerPool struct {
-	workers   int
-	jobQueue  chan AnalysisJob
-	workerWg  sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-	isRunning bool
-	mu        sync.RWMutex
+	*pool.Pool[AnalysisJob]
 }
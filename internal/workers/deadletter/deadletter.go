@@ -0,0 +1,95 @@
+package deadletter
+
+import (
+	"errors"
+	"os/exec"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollectionName is the name of the collection storing permanently failed jobs
+const CollectionName = "dead_letters"
+
+// Dead letter statuses
+const (
+	StatusOpen     = "open"
+	StatusRequeued = "requeued"
+)
+
+// maxStderrSize limits how much of an external binary's stderr is stored
+const maxStderrSize = 64 * 1024
+
+// Entry describes a job that a stage gave up on
+type Entry struct {
+	Stage      string // "extraction", "prettify", "sourcemap", "analysis", "dechunker"
+	Collection string // Collection of the failed record ("endpoints", "js_files")
+	RecordID   string
+	URL        string
+	InputPath  string // File the stage was working on, if any
+	Err        error
+}
+
+// Record stores a dead letter for the failed job. If an open dead letter already
+// exists for the same stage and record, its error details and attempt counter are updated.
+func Record(app core.App, entry Entry) {
+	if app == nil || entry.RecordID == "" {
+		return
+	}
+
+	collection, err := app.FindCollectionByNameOrId(CollectionName)
+	if err != nil {
+		logger.Error("Failed to find dead letters collection: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	record, _ := app.FindFirstRecordByFilter(
+		CollectionName,
+		"stage = {:stage} && record_id = {:record_id} && status = {:status}",
+		dbx.Params{"stage": entry.Stage, "record_id": entry.RecordID, "status": StatusOpen},
+	)
+	if record == nil {
+		record = core.NewRecord(collection)
+		record.Set("stage", entry.Stage)
+		record.Set("record_collection", entry.Collection)
+		record.Set("record_id", entry.RecordID)
+		record.Set("status", StatusOpen)
+		record.Set("attempts", 0)
+		record.Set("created_at", now)
+	}
+
+	errorMessage := "unknown error"
+	if entry.Err != nil {
+		errorMessage = entry.Err.Error()
+	}
+
+	record.Set("url", entry.URL)
+	record.Set("input_path", entry.InputPath)
+	record.Set("error", errorMessage)
+	record.Set("stderr", Stderr(entry.Err))
+	record.Set("attempts", record.GetInt("attempts")+1)
+	record.Set("updated_at", now)
+
+	if err := app.Save(record); err != nil {
+		logger.Error("Failed to save dead letter for %s %s: %v", entry.Stage, entry.RecordID, err)
+	}
+}
+
+// Stderr returns the stderr captured from an external binary, if err wraps an *exec.ExitError
+func Stderr(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return ""
+	}
+
+	stderr := exitErr.Stderr
+	if len(stderr) > maxStderrSize {
+		stderr = stderr[len(stderr)-maxStderrSize:]
+	}
+	return string(stderr)
+}
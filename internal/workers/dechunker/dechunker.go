@@ -2,12 +2,14 @@ package dechunker
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
 )
 
 // Dechunker wraps the dechunker executable
@@ -33,16 +35,20 @@ func NewDechunker() (*Dechunker, error) {
 	}, nil
 }
 
-// ExtractChunks performs chunk extraction on a JavaScript file using the dechunker
-func (d *Dechunker) ExtractChunks(filePath string, baseURL string) ([]ChunkURL, error) {
+// ExtractChunks performs chunk extraction on a JavaScript file using the dechunker.
+// The dechunker process is killed when ctx is done.
+func (d *Dechunker) ExtractChunks(ctx context.Context, filePath string, baseURL string) ([]ChunkURL, error) {
 	// Check if the file exists
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return nil, fmt.Errorf("file does not exist: %s", filePath)
 	}
 
 	// Run the dechunker with the file path and base URL
-	cmd := exec.Command(d.dechunkerPath, filePath, "--url", baseURL)
-	output, err := cmd.Output()
+	cmd := exec.CommandContext(ctx, d.dechunkerPath, filePath, "--url", baseURL)
+	output, err := jobrun.Output(ctx, cmd)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("dechunker interrupted: %w", ctx.Err())
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to run dechunker: %w", err)
 	}
@@ -74,11 +80,11 @@ func (d *Dechunker) ExtractChunks(filePath string, baseURL string) ([]ChunkURL,
 }
 
 // ExtractChunksFromFile is the main entry point for extracting chunks from a JavaScript file
-func ExtractChunksFromFile(filePath string, baseURL string) ([]ChunkURL, error) {
+func ExtractChunksFromFile(ctx context.Context, filePath string, baseURL string) ([]ChunkURL, error) {
 	dechunker, err := NewDechunker()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create dechunker: %w", err)
 	}
 
-	return dechunker.ExtractChunks(filePath, baseURL)
+	return dechunker.ExtractChunks(ctx, filePath, baseURL)
 }
@@ -8,14 +8,25 @@ import (
 
 	"github.com/jsh-team/jshunter/internal/storage"
 	"github.com/jsh-team/jshunter/internal/utils/fetch"
+	"github.com/jsh-team/jshunter/internal/utils/hash"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/jsversion"
+	"github.com/jsh-team/jshunter/internal/workers/lineage"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 // processJob processes a single dechunker job
-func (p *DechunkerWorkerPool) processJob(workerID int, job DechunkerJob) {
+func (p *DechunkerWorkerPool) processJob(ctx context.Context, workerID int, job DechunkerJob) {
+	run := jobrun.Start(job.App, "dechunker", job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+	log := run.Logger()
+
 	errorCount := 0
 	jsFileRecord := job.Record
 
@@ -24,9 +35,8 @@ func (p *DechunkerWorkerPool) processJob(workerID int, job DechunkerJob) {
 	fileURL := jsFileRecord.GetString("url")
 	if bodyHash == "" || fileURL == "" {
 		errorCount++
-		logger.Error("Dechunker Worker %d failed: missing hash or URL for record %s", workerID, jsFileRecord.Id)
-		jsFileRecord.Set("dechunker_status", "failed")
-		job.App.Save(jsFileRecord)
+		log.Error("Dechunker Worker %d failed: missing hash or URL for record %s", workerID, jsFileRecord.Id)
+		markFailed(ctx, job, "", fmt.Errorf("missing hash or URL"))
 		return
 	}
 
@@ -34,34 +44,35 @@ func (p *DechunkerWorkerPool) processJob(workerID int, job DechunkerJob) {
 	fullPath, err := storage.GetJSFilePath(fileURL, bodyHash)
 	if err != nil {
 		errorCount++
-		logger.Error("Dechunker Worker %d failed to get file path for %s: %v", workerID, fileURL, err)
-		jsFileRecord.Set("dechunker_status", "failed")
-		job.App.Save(jsFileRecord)
+		log.Error("Dechunker Worker %d failed to get file path for %s: %v", workerID, fileURL, err)
+		markFailed(ctx, job, "", err)
 		return
 	}
 
 	// Extract chunks from JavaScript file
-	chunkURLs, err := ExtractChunksFromFile(fullPath, fileURL)
+	chunkURLs, err := ExtractChunksFromFile(ctx, fullPath, fileURL)
 	if err != nil {
 		errorCount++
-		logger.Error("Dechunker Worker %d failed to extract chunks from file %s: %v", workerID, fullPath, err)
-		jsFileRecord.Set("dechunker_status", "failed")
-		job.App.Save(jsFileRecord)
+		log.Error("Dechunker Worker %d failed to extract chunks from file %s: %v", workerID, fullPath, err)
+		markFailed(ctx, job, fullPath, err)
 		return
 	}
 
 	// Process chunk URLs - fetch and save as JS files
 	if len(chunkURLs) > 0 {
-		logger.Info("Found %d potential chunk URLs for %s", len(chunkURLs), fileURL)
+		log.Info("Found %d potential chunk URLs for %s", len(chunkURLs), fileURL)
 		jsFileRecord.Set("has_chunks", true)
 		job.App.Save(jsFileRecord)
-		err = p.fetchAndSaveChunks(job.App, jsFileRecord.Id, chunkURLs)
+		err = p.fetchAndSaveChunks(ctx, job.App, jsFileRecord.Id, pool.RecordPriority(jsFileRecord).Lower(), chunkURLs)
 		if err != nil {
 			errorCount++
-			logger.Error("Dechunker Worker %d failed to fetch and save chunks for %s: %v", workerID, jsFileRecord.GetString("url"), err)
+			log.Error("Dechunker Worker %d failed to fetch and save chunks for %s: %v", workerID, jsFileRecord.GetString("url"), err)
+		}
+		// A timeout or a shutdown left chunks unfetched: the job is not done
+		if ctx.Err() != nil {
+			markFailed(ctx, job, fullPath, err)
+			return
 		}
-
-		// Set has_chunks flag if we found any chunks
 	}
 
 	// Always mark as processed (even if no chunks found)
@@ -69,12 +80,33 @@ func (p *DechunkerWorkerPool) processJob(workerID int, job DechunkerJob) {
 	jsFileRecord.Set("last_modified", time.Now())
 	if err := job.App.Save(jsFileRecord); err != nil {
 		errorCount++
-		logger.Error("Dechunker Worker %d failed to save final record for %s: %v", workerID, jsFileRecord.GetString("url"), err)
+		log.Error("Dechunker Worker %d failed to save final record for %s: %v", workerID, jsFileRecord.GetString("url"), err)
 	}
 }
 
+// markFailed sets the failure status of the dechunker job and stores it in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job DechunkerJob, inputPath string, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	job.Record.Set("dechunker_status", status)
+	job.App.Save(job.Record)
+	if status == pool.StatusPending {
+		return
+	}
+
+	deadletter.Record(job.App, deadletter.Entry{
+		Stage:      "dechunker",
+		Collection: "js_files",
+		RecordID:   job.Record.Id,
+		URL:        job.Record.GetString("url"),
+		InputPath:  inputPath,
+		Err:        err,
+	})
+}
+
 // fetchAndSaveChunks fetches chunk URLs and saves them as JS files
-func (p *DechunkerWorkerPool) fetchAndSaveChunks(app *pocketbase.PocketBase, parentJSFileID string, chunkURLs []ChunkURL) error {
+func (p *DechunkerWorkerPool) fetchAndSaveChunks(ctx context.Context, app *pocketbase.PocketBase, parentJSFileID string, priority pool.Priority, chunkURLs []ChunkURL) error {
 	if len(chunkURLs) == 0 {
 		return nil
 	}
@@ -87,64 +119,100 @@ func (p *DechunkerWorkerPool) fetchAndSaveChunks(app *pocketbase.PocketBase, par
 	// Create rate-limited fetcher
 	fetcher := fetch.NewAssetFetcher()
 	now := time.Now()
+	var chunkRecords []*core.Record
+	seen := make(map[string]bool)
+
+	seenHashes := make(map[string]bool)
 
 	for _, chunkURL := range chunkURLs {
 		// Use the URL directly from the binary (already resolved)
 		absoluteURL := chunkURL.URL
-
-		// Check if this chunk already exists in the database (by URL)
-		existingRecord, err := app.FindFirstRecordByFilter(
-			"js_files",
-			"url = {:url}",
-			map[string]any{"url": absoluteURL},
-		)
-		if err == nil && existingRecord != nil {
+		if seen[absoluteURL] {
 			continue
 		}
-		// Fetch chunk content with rate limiting
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		content, contentType, success, err := fetcher.RateLimitedGetWithContentType(ctx, absoluteURL)
+		seen[absoluteURL] = true
+
+		// Fetch chunk content with rate limiting; chunks fetched so far are still saved when interrupted
+		if ctx.Err() != nil {
+			break
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		content, contentType, success, err := fetcher.RateLimitedGetWithContentType(fetchCtx, absoluteURL)
 		cancel()
 
 		if err != nil || !success {
-			logger.Error("Failed to fetch chunk %s: success=%v, err=%v", absoluteURL, success, err)
+			logger.FromContext(ctx).Error("Failed to fetch chunk %s: success=%v, err=%v", absoluteURL, success, err)
 			continue
 		}
 
 		// Validate content type
 		if !strings.Contains(contentType, "javascript") && !strings.Contains(contentType, "text/plain") {
-			logger.Debug("Skipping chunk %s with incorrect content type: %s", absoluteURL, contentType)
+			logger.FromContext(ctx).Debug("Skipping chunk %s with incorrect content type: %s", absoluteURL, contentType)
 			continue
 		}
 
 		// Content sniffing for HTML
 		if strings.HasPrefix(strings.TrimSpace(content), "<!DOCTYPE html>") || strings.HasPrefix(strings.TrimSpace(content), "<html>") {
-			logger.Debug("Skipping chunk %s because it appears to be HTML", absoluteURL)
+			logger.FromContext(ctx).Debug("Skipping chunk %s because it appears to be HTML", absoluteURL)
 			continue
 		}
 
 		if len(content) == 0 {
-			logger.Error("Failed to fetch chunk %s: empty content", absoluteURL)
+			logger.FromContext(ctx).Error("Failed to fetch chunk %s: empty content", absoluteURL)
+			continue
+		}
+
+		// Chunks are matched by content like scripts: new content at a known URL is a new version
+		contentHash := hash.GenerateSha256Hash(content)
+		existingRecord, err := app.FindFirstRecordByFilter(
+			"js_files",
+			"hash = {:hash}",
+			map[string]any{"hash": contentHash},
+		)
+		if err == nil && existingRecord != nil {
+			jsversion.Observe(app, absoluteURL, contentHash, existingRecord.Id)
+			continue
+		}
+		if seenHashes[contentHash] {
 			continue
 		}
+		seenHashes[contentHash] = true
 
 		// Save content to filesystem
-		hash := storage.SaveJSFile(absoluteURL, content)
+		storage.SaveJSFile(absoluteURL, content)
 		// Create JS file record for the chunk
 		newRecord := core.NewRecord(jsFilesCollection)
 		newRecord.Set("url", absoluteURL)
-		newRecord.Set("hash", hash)
+		newRecord.Set("hash", contentHash)
 		newRecord.Set("parent_id", parentJSFileID)
 		newRecord.Set("type", "chunk")
 		newRecord.Set("has_chunks", false) // Chunks themselves don't have chunks
+		newRecord.Set("priority", priority.String())
 		newRecord.Set("created_at", now)
+		lineage.Assign(app, newRecord, content)
+		chunkRecords = append(chunkRecords, newRecord)
+	}
 
-		if err := app.Save(newRecord); err != nil {
-			logger.Error("Error saving chunk JS file record for %s: %v", absoluteURL, err)
-			continue
+	if len(chunkRecords) > 0 {
+		// All chunks of the file are inserted in one transaction instead of one commit per row
+		var saved []*core.Record
+		err = app.RunInTransaction(func(txApp core.App) error {
+			for _, record := range chunkRecords {
+				if err := txApp.Save(record); err != nil {
+					logger.FromContext(ctx).Error("Error saving chunk JS file record for %s: %v", record.GetString("url"), err)
+					continue
+				}
+				saved = append(saved, record)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range saved {
+			jsversion.Observe(app, record.GetString("url"), record.GetString("hash"), record.Id)
 		}
-
 	}
 
-	return nil
+	return ctx.Err()
 }
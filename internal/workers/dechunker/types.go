@@ -1,8 +1,7 @@
 package dechunker
 
 import (
-	"context"
-	"sync"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -16,13 +15,7 @@ type DechunkerJob struct {
 
 // DechunkerWorkerPool manages a pool of workers for JavaScript chunk extraction
 type DechunkerWorkerPool struct {
-	workers   int
-	jobQueue  chan DechunkerJob
-	workerWg  sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-	isRunning bool
-	mu        sync.RWMutex
+	*pool.Pool[DechunkerJob]
 }
 
 // ChunkURL represents a discovered chunk URL
@@ -0,0 +1,490 @@
+package extraction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/metrics"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/launcher"
+	"github.com/go-rod/rod/lib/proto"
+)
+
+// Reasons a pooled browser is shut down, as counted by metrics.BrowserRecycles
+const (
+	recyclePages  = "pages"
+	recycleMemory = "memory"
+	recycleHealth = "health"
+	recycleIdle   = "idle"
+)
+
+const (
+	// healthInterval is how often the pooled browsers are checked
+	healthInterval = 30 * time.Second
+	// healthTimeout is how long a browser may take to answer a health check
+	healthTimeout = 10 * time.Second
+)
+
+// ErrBrowserPoolClosed is returned when a page is requested after the pool was closed
+var ErrBrowserPoolClosed = errors.New("browser pool closed")
+
+// BrowserPoolOptions configures a browser pool. Zero values disable the matching limit.
+type BrowserPoolOptions struct {
+	PagesPerBrowser int           // Pages open at the same time in one browser process
+	RecycleAfter    int           // Pages served by a browser before it is replaced
+	MaxMemoryMB     int           // Memory of a browser and its renderers above which it is replaced
+	IdleTimeout     time.Duration // Time an unused browser is kept running
+}
+
+// BrowserPool keeps long-lived headless browsers and hands out pages, each in its own
+// incognito context so cookies, storage and cache never leak between endpoints. Browsers
+// are launched on demand, replaced after RecycleAfter pages or above MaxMemoryMB, and
+// dropped when they crash or stop answering health checks.
+type BrowserPool struct {
+	options BrowserPoolOptions
+
+	mutex    sync.Mutex
+	browsers []*pooledBrowser
+	nextID   int
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// pooledBrowser is one browser process of the pool
+type pooledBrowser struct {
+	id       int
+	ready    chan struct{} // Closed once the launch finished, err is set when it failed
+	err      error
+	launcher *launcher.Launcher
+	browser  *rod.Browser
+
+	active   int // Pages open
+	served   int // Pages opened since launch
+	retiring bool
+	lastUsed time.Time
+}
+
+// BrowserPage is a page leased from the pool. Release must be called once it is done with.
+type BrowserPage struct {
+	pool      *BrowserPool
+	browser   *pooledBrowser
+	incognito *rod.Browser
+	Page      *rod.Page
+}
+
+// NewBrowserPool returns a browser pool and starts its health checks
+func NewBrowserPool(options BrowserPoolOptions) *BrowserPool {
+	if options.PagesPerBrowser < 1 {
+		options.PagesPerBrowser = 1
+	}
+	p := &BrowserPool{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go p.monitor()
+	return p
+}
+
+var (
+	defaultBrowserPool      *BrowserPool
+	defaultBrowserPoolMutex sync.Mutex
+)
+
+// Browsers returns the browser pool shared by the extraction jobs of this process,
+// created on first use from the browser settings
+func Browsers() *BrowserPool {
+	defaultBrowserPoolMutex.Lock()
+	defer defaultBrowserPoolMutex.Unlock()
+
+	if defaultBrowserPool == nil {
+		defaultBrowserPool = NewBrowserPool(BrowserPoolOptions{
+			PagesPerBrowser: config.BrowserPagesPerProcess,
+			RecycleAfter:    config.BrowserRecycleAfter,
+			MaxMemoryMB:     config.BrowserMaxMemoryMB,
+			IdleTimeout:     time.Duration(config.BrowserIdleTimeout) * time.Second,
+		})
+	}
+	return defaultBrowserPool
+}
+
+// BrowserStats returns the stats of the shared browser pool, without starting it
+func BrowserStats() BrowserPoolStats {
+	defaultBrowserPoolMutex.Lock()
+	defer defaultBrowserPoolMutex.Unlock()
+
+	if defaultBrowserPool == nil {
+		return BrowserPoolStats{}
+	}
+	return defaultBrowserPool.Stats()
+}
+
+// CloseBrowsers shuts down the shared browser pool, if it was started
+func CloseBrowsers() {
+	defaultBrowserPoolMutex.Lock()
+	defer defaultBrowserPoolMutex.Unlock()
+
+	if defaultBrowserPool != nil {
+		defaultBrowserPool.Close()
+		defaultBrowserPool = nil
+	}
+}
+
+// Page opens a page in a fresh incognito context of the least busy browser, launching a
+// browser when every running one is full
+func (p *BrowserPool) Page(ctx context.Context) (*BrowserPage, error) {
+	b, err := p.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	incognito, err := b.browser.Incognito()
+	if err != nil {
+		p.release(b, true)
+		return nil, fmt.Errorf("failed to create browser context: %w", err)
+	}
+	page, err := incognito.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		incognito.Close()
+		p.release(b, true)
+		return nil, fmt.Errorf("failed to create page: %w", err)
+	}
+
+	metrics.BrowserPages.Inc()
+	return &BrowserPage{pool: p, browser: b, incognito: incognito, Page: page}, nil
+}
+
+// Release closes the page and its incognito context and gives its slot back to the pool.
+// failed reports that the page failed, in which case the browser is checked right away;
+// Release then reports whether the browser itself was lost.
+func (l *BrowserPage) Release(failed bool) bool {
+	l.Page.Close()
+	l.incognito.Close()
+	return l.pool.release(l.browser, failed)
+}
+
+// acquire reserves a page slot in a browser, waiting for its launch when needed
+func (p *BrowserPool) acquire(ctx context.Context) (*pooledBrowser, error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, ErrBrowserPoolClosed
+	}
+
+	// The least busy browser with a free page slot
+	var selected *pooledBrowser
+	for _, b := range p.browsers {
+		if b.retiring || b.err != nil || b.active >= p.options.PagesPerBrowser {
+			continue
+		}
+		if selected == nil || b.active < selected.active {
+			selected = b
+		}
+	}
+
+	launch := selected == nil
+	if launch {
+		p.nextID++
+		selected = &pooledBrowser{id: p.nextID, ready: make(chan struct{})}
+		p.browsers = append(p.browsers, selected)
+	}
+	selected.active++
+	selected.served++
+	selected.lastUsed = time.Now()
+	if p.options.RecycleAfter > 0 && selected.served >= p.options.RecycleAfter {
+		// Serves its last page, a new browser takes the next ones
+		selected.retiring = true
+		metrics.BrowserRecycles.Inc(recyclePages)
+	}
+	p.mutex.Unlock()
+
+	if launch {
+		l, browser, err := launchBrowser()
+		p.mutex.Lock()
+		selected.launcher, selected.browser, selected.err = l, browser, err
+		p.mutex.Unlock()
+		close(selected.ready)
+	}
+
+	select {
+	case <-selected.ready:
+	case <-ctx.Done():
+		p.release(selected, false)
+		return nil, ctx.Err()
+	}
+	if selected.err != nil {
+		p.release(selected, true)
+		return nil, selected.err
+	}
+	return selected, nil
+}
+
+// release gives a page slot back and shuts the browser down once it is retired and idle.
+// It reports whether a failed page was caused by the browser being lost.
+func (p *BrowserPool) release(b *pooledBrowser, failed bool) bool {
+	lost := false
+	if failed && b.browser != nil && !healthy(b.browser) {
+		logger.Warn("Browser %d stopped responding, replacing it", b.id)
+		p.retire(b, recycleHealth)
+		lost = true
+	}
+
+	p.mutex.Lock()
+	b.active--
+	b.lastUsed = time.Now()
+	idle := b.active == 0 && (b.retiring || b.err != nil)
+	if idle {
+		p.remove(b)
+	}
+	p.mutex.Unlock()
+
+	if idle {
+		closeBrowser(b)
+	}
+	return lost
+}
+
+// retire stops handing out pages of a browser, which is shut down once its pages are released
+func (p *BrowserPool) retire(b *pooledBrowser, reason string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !b.retiring {
+		b.retiring = true
+		metrics.BrowserRecycles.Inc(reason)
+	}
+}
+
+// remove drops a browser from the pool. The caller holds the mutex.
+func (p *BrowserPool) remove(b *pooledBrowser) {
+	for i, candidate := range p.browsers {
+		if candidate == b {
+			p.browsers = append(p.browsers[:i], p.browsers[i+1:]...)
+			return
+		}
+	}
+}
+
+// monitor periodically checks the health and memory of the browsers and shuts down the
+// ones left idle
+func (p *BrowserPool) monitor() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// check runs one round of health, memory and idle checks
+func (p *BrowserPool) check() {
+	p.mutex.Lock()
+	var running []*pooledBrowser
+	for _, b := range p.browsers {
+		select {
+		case <-b.ready:
+			if b.err == nil && !b.retiring {
+				running = append(running, b)
+			}
+		default:
+			// Still launching
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, b := range running {
+		switch {
+		case !healthy(b.browser):
+			logger.Warn("Browser %d failed its health check, replacing it", b.id)
+			p.retire(b, recycleHealth)
+		case p.options.MaxMemoryMB > 0 && processMemoryMB(b.launcher.PID()) > p.options.MaxMemoryMB:
+			logger.Info("Browser %d uses more than %d MB, replacing it", b.id, p.options.MaxMemoryMB)
+			p.retire(b, recycleMemory)
+		}
+	}
+
+	// Shut down the retired and idle browsers without pages
+	var idle []*pooledBrowser
+	p.mutex.Lock()
+	for _, b := range running {
+		if b.active > 0 {
+			continue
+		}
+		if !b.retiring && p.options.IdleTimeout > 0 && time.Since(b.lastUsed) > p.options.IdleTimeout {
+			b.retiring = true
+			metrics.BrowserRecycles.Inc(recycleIdle)
+		}
+		if b.retiring {
+			p.remove(b)
+			idle = append(idle, b)
+		}
+	}
+	p.mutex.Unlock()
+
+	for _, b := range idle {
+		closeBrowser(b)
+	}
+}
+
+// BrowserPoolStats describes the browsers of the pool
+type BrowserPoolStats struct {
+	Browsers int `json:"browsers"` // Running or launching
+	Pages    int `json:"pages"`    // Open pages
+}
+
+// Stats returns the number of browsers and open pages
+func (p *BrowserPool) Stats() BrowserPoolStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stats := BrowserPoolStats{Browsers: len(p.browsers)}
+	for _, b := range p.browsers {
+		stats.Pages += b.active
+	}
+	return stats
+}
+
+// Close stops the health checks and shuts every browser down. Pages still open fail.
+func (p *BrowserPool) Close() {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	browsers := p.browsers
+	p.browsers = nil
+	p.mutex.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	for _, b := range browsers {
+		<-b.ready
+		closeBrowser(b)
+	}
+}
+
+// launchBrowser starts a headless browser and connects to it
+func launchBrowser() (*launcher.Launcher, *rod.Browser, error) {
+	l := launcher.New().
+		Headless(true).
+		NoSandbox(true).
+		Set("disable-extensions").
+		Set("disable-default-apps").
+		Set("disable-dev-shm-usage").
+		Set("disable-gpu").
+		Set("window-size", "1366,768")
+
+	controlURL, err := l.Launch()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to launch browser: %w", err)
+	}
+	metrics.BrowserLaunches.Inc()
+
+	browser := rod.New().ControlURL(controlURL)
+	if err := browser.Connect(); err != nil {
+		l.Kill()
+		return nil, nil, fmt.Errorf("failed to connect to browser: %w", err)
+	}
+	return l, browser, nil
+}
+
+// closeBrowser shuts a browser down and kills its process if it did not exit
+func closeBrowser(b *pooledBrowser) {
+	if b.browser != nil {
+		b.browser.Close()
+	}
+	if b.launcher != nil {
+		b.launcher.Kill()
+		b.launcher.Cleanup()
+	}
+}
+
+// healthy reports whether a browser answers over its debugging connection
+func healthy(browser *rod.Browser) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	_, err := proto.BrowserGetVersion{}.Call(browser.Context(ctx))
+	return err == nil
+}
+
+// processMemoryMB returns the resident memory of a process and its descendants (the
+// renderers of a browser) in MB. It reads /proc and returns 0 where /proc is not available.
+func processMemoryMB(pid int) int {
+	if pid <= 0 {
+		return 0
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+
+	// Parent of every process, to find the descendants of pid
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces, the fields after it do not
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) < 2 {
+			continue
+		}
+		if parent, err := strconv.Atoi(fields[1]); err == nil {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	totalKB := 0
+	queue := []int{pid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = append(queue[1:], children[current]...)
+		totalKB += residentKB(current)
+	}
+	return totalKB / 1024
+}
+
+// residentKB returns the resident memory of a process in KB, read from /proc/<pid>/status
+func residentKB(pid int) int {
+	status, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmRSS:"); ok {
+			fields := strings.Fields(value)
+			if len(fields) > 0 {
+				kb, _ := strconv.Atoi(fields[0])
+				return kb
+			}
+		}
+	}
+	return 0
+}
@@ -10,26 +10,19 @@ import (
 
 	"github.com/jsh-team/jshunter/internal/utils/logger"
 	urlutils "github.com/jsh-team/jshunter/internal/utils/url"
+	"github.com/jsh-team/jshunter/internal/workers/htmlversion"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
 
 	"github.com/go-rod/rod"
-	"github.com/go-rod/rod/lib/launcher"
 	"github.com/go-rod/rod/lib/proto"
 )
 
-// BrowserExtractor provides a clean, focused approach to JavaScript extraction
-type BrowserExtractor struct {
-	browser     *rod.Browser
-	browserURL  string
-	mutex       sync.RWMutex
-	timeout     time.Duration
-	pageTimeout time.Duration
-}
-
 type ExtractionOptions struct {
 	Headers     map[string]string
 	Mobile      bool
 	Timeout     time.Duration
 	PageTimeout time.Duration
+	Settle      SettleOptions // DefaultSettleOptions when no strategy is set
 }
 
 type JSResource struct {
@@ -39,80 +32,62 @@ type JSResource struct {
 	Source      string `json:"source"` // "network", "dom", "inline"
 }
 
-// NewBrowserExtractor creates a new browser extractor
-func NewBrowserExtractor() *BrowserExtractor {
-	return &BrowserExtractor{
-		timeout:     120 * time.Second,
-		pageTimeout: 30 * time.Second,
-	}
-}
+// defaultExtractionTimeout is the timeout of an extraction without one in its options
+const defaultExtractionTimeout = 120 * time.Second
 
-// Initialize sets up the browser instance
-func (e *BrowserExtractor) Initialize() error {
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
+// ExtractJavaScript extracts JavaScript resources from a URL in a page of the pool. The
+// returned bool reports that the extraction failed because the browser was lost, in which
+// case it can be retried on another browser.
+func (p *BrowserPool) ExtractJavaScript(ctx context.Context, url string, options ExtractionOptions) (string, []JSResource, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, extractionTimeout(defaultExtractionTimeout, options))
+	defer cancel()
 
-	if e.browser != nil {
-		return nil
-	}
+	logger.FromContext(ctx).Info("Starting extraction for %s", url)
 
-	launcher := launcher.New().
-		Headless(true).
-		NoSandbox(true).
-		Set("disable-extensions").
-		Set("disable-default-apps").
-		Set("disable-dev-shm-usage").
-		Set("disable-gpu").
-		Set("window-size", "1366,768")
-
-	var err error
-	e.browserURL, err = launcher.Launch()
+	lease, err := p.Page(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to launch browser: %w", err)
-	}
-
-	e.browser = rod.New().ControlURL(e.browserURL)
-	if err := e.browser.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to browser: %w", err)
+		return "", nil, false, err
 	}
 
-	return nil
+	html, resources, err := extractPage(ctx, lease.Page, url, options)
+	// A failure after the job context ended is a timeout, not a browser problem
+	lost := lease.Release(err != nil && ctx.Err() == nil)
+	return html, resources, lost, err
 }
 
-// Close shuts down the browser
-func (e *BrowserExtractor) Close() {
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-
-	if e.browser != nil {
-		e.browser.Close()
-		e.browser = nil
+// extractionTimeout returns the timeout of an extraction: the one of the options, or the default
+func extractionTimeout(defaultTimeout time.Duration, options ExtractionOptions) time.Duration {
+	if options.Timeout > 0 {
+		return options.Timeout
 	}
+	return defaultTimeout
 }
 
-// ExtractJavaScript extracts JavaScript resources from a URL
-func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptions) (string, []JSResource, error) {
-	if err := e.Initialize(); err != nil {
-		return "", nil, fmt.Errorf("failed to initialize browser: %w", err)
+// extractPage loads a URL in a blank page, waits for it to settle and returns its HTML and
+// JavaScript resources. The timing of the page is added to the job run of ctx.
+func extractPage(ctx context.Context, page *rod.Page, url string, options ExtractionOptions) (_ string, _ []JSResource, err error) {
+	if options.Settle.Strategy == "" {
+		options.Settle = DefaultSettleOptions()
 	}
+	network := newNetworkTracker()
 
-	// Set timeout from options
-	timeout := e.timeout
-	if options.Timeout > 0 {
-		timeout = options.Timeout
+	timing := jobrun.PageTiming{
+		URL:      url,
+		Variant:  htmlversion.VariantDesktop,
+		Strategy: options.Settle.Strategy,
 	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	logger.Info("Starting extraction for %s", url)
-
-	// Create new page
-	page, err := e.browser.Page(proto.TargetCreateTarget{})
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to create page: %w", err)
+	if options.Mobile {
+		timing.Variant = htmlversion.VariantMobile
 	}
-	defer page.Close()
+	startTime := time.Now()
+	defer func() {
+		timing.TotalMS = time.Since(startTime).Milliseconds()
+		timing.Requests = network.total()
+		if err != nil {
+			timing.Error = err.Error()
+		}
+		jobrun.FromContext(ctx).AddPages(timing)
+	}()
 
 	// Set mobile viewport if requested
 	if options.Mobile {
@@ -122,7 +97,7 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 			DeviceScaleFactor: 3,
 			Mobile:            true,
 		}); err != nil {
-			logger.Error("Failed to set mobile viewport: %v", err)
+			logger.FromContext(ctx).Error("Failed to set mobile viewport: %v", err)
 		}
 	}
 
@@ -134,22 +109,28 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 	router := page.HijackRequests()
 	defer func() {
 		if err := router.Stop(); err != nil {
-			logger.Error("Failed to stop router: %v", err)
+			logger.FromContext(ctx).Error("Failed to stop router: %v", err)
 		}
 	}()
 
 	router.MustAdd("*", func(hijack *rod.Hijack) {
 		requestURL := hijack.Request.URL().String()
 
-		// Don't intercept main page
+		// Don't intercept main page, the browser loads it and the settle check waits for it
 		if requestURL == url {
+			network.document()
 			hijack.ContinueRequest(&proto.FetchContinueRequest{})
 			return
 		}
 
-		// Apply custom headers
+		// In flight until its response is loaded, for the networkidle strategy
+		network.start()
+		defer network.done()
+
+		// Apply custom headers and tie the request to the job context
+		hijack.Request.SetContext(ctx)
 		req := hijack.Request.Req()
-		e.setRequestHeaders(req, options.Headers)
+		setRequestHeaders(req, options.Headers)
 
 		// Load response
 		client := &http.Client{
@@ -164,7 +145,7 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 
 		// Extract JavaScript content
 		contentType := hijack.Response.Headers().Get("Content-Type")
-		if e.isJavaScriptResource(contentType, requestURL) {
+		if isJavaScriptResource(contentType, requestURL) {
 			body := hijack.Response.Body()
 			if len(body) > 0 {
 				resourcesMutex.Lock()
@@ -183,35 +164,49 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 	go router.Run()
 	time.Sleep(100 * time.Millisecond) // Brief delay for router to start
 
+	// From here on every page operation fails once the job context is done
+	page = page.Context(ctx)
+
 	// Set user agent if provided
 	if userAgent, exists := options.Headers["User-Agent"]; exists {
 		if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
 			UserAgent: userAgent,
 		}); err != nil {
-			logger.Error("Failed to set user agent: %v", err)
+			logger.FromContext(ctx).Error("Failed to set user agent: %v", err)
 		}
 	}
 
 	// Navigate to URL
+	navigateStart := time.Now()
 	if err := page.Navigate(url); err != nil {
 		return "", nil, fmt.Errorf("navigation failed: %w", err)
 	}
+	timing.NavigateMS = time.Since(navigateStart).Milliseconds()
 
-	// Wait for initial content to load (no WaitLoad, just time-based)
-	time.Sleep(3 * time.Second)
-
-	// Wait for additional resources
-	time.Sleep(5 * time.Second)
+	// Wait for the page to settle: lazy chunks load after the document
+	settleStart := time.Now()
+	timing.Settled, err = settle(ctx, page, network, options.Settle)
+	timing.SettleMS = time.Since(settleStart).Milliseconds()
+	if err != nil {
+		return "", nil, fmt.Errorf("extraction interrupted: %w", err)
+	}
+	if !timing.Settled {
+		logger.FromContext(ctx).Info("Page %s did not settle (%s) within %v, extracting it anyway", url, options.Settle.Strategy, options.Settle.MaxWait)
+	}
 
 	// Extract HTML content
 	htmlContent, err := page.HTML()
 	if err != nil {
-		logger.Error("Failed to get HTML content: %v", err)
+		logger.FromContext(ctx).Error("Failed to get HTML content: %v", err)
 		htmlContent = ""
 	}
 
+	if ctx.Err() != nil {
+		return "", nil, fmt.Errorf("extraction interrupted: %w", ctx.Err())
+	}
+
 	// Extract DOM scripts
-	domScripts := e.extractDOMScripts(page, ctx, url)
+	domScripts := extractDOMScripts(page, ctx, url)
 	resourcesMutex.Lock()
 	jsResources = append(jsResources, domScripts...)
 	resourcesMutex.Unlock()
@@ -219,13 +214,13 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 	// Extract inline scripts
 	inlineScripts, err := ExtractInlineJavaScript(htmlContent, url)
 	if err != nil {
-		logger.Error("Failed to extract inline scripts: %v", err)
+		logger.FromContext(ctx).Error("Failed to extract inline scripts: %v", err)
 	}
 	resourcesMutex.Lock()
 	for _, script := range inlineScripts {
 		jsURL, err := GenerateInlineJSURL(url, script.Index)
 		if err != nil {
-			logger.Error("Failed to generate inline JS URL: %v", err)
+			logger.FromContext(ctx).Error("Failed to generate inline JS URL: %v", err)
 			continue
 		}
 		jsResources = append(jsResources, JSResource{
@@ -237,12 +232,12 @@ func (e *BrowserExtractor) ExtractJavaScript(url string, options ExtractionOptio
 	}
 	resourcesMutex.Unlock()
 
-	logger.Info("Successfully extracted %d JavaScript resources from %s", len(jsResources), url)
+	logger.FromContext(ctx).Info("Successfully extracted %d JavaScript resources from %s", len(jsResources), url)
 	return htmlContent, jsResources, nil
 }
 
 // setRequestHeaders applies custom headers to HTTP requests
-func (e *BrowserExtractor) setRequestHeaders(req *http.Request, headers map[string]string) {
+func setRequestHeaders(req *http.Request, headers map[string]string) {
 	for key, value := range headers {
 		if value != "" {
 			req.Header.Set(key, value)
@@ -251,7 +246,7 @@ func (e *BrowserExtractor) setRequestHeaders(req *http.Request, headers map[stri
 }
 
 // isJavaScriptResource checks if content type indicates JavaScript
-func (e *BrowserExtractor) isJavaScriptResource(contentType, url string) bool {
+func isJavaScriptResource(contentType, url string) bool {
 	// Exclude JSON explicitly
 	if strings.Contains(strings.ToLower(contentType), "json") ||
 		strings.HasSuffix(strings.ToLower(url), ".json") {
@@ -265,7 +260,7 @@ func (e *BrowserExtractor) isJavaScriptResource(contentType, url string) bool {
 }
 
 // extractDOMScripts extracts external scripts from DOM
-func (e *BrowserExtractor) extractDOMScripts(page *rod.Page, ctx context.Context, baseURL string) []JSResource {
+func extractDOMScripts(page *rod.Page, ctx context.Context, baseURL string) []JSResource {
 	var resources []JSResource
 
 	elements, err := page.Elements("script[src]")
@@ -294,17 +289,15 @@ func (e *BrowserExtractor) extractDOMScripts(page *rod.Page, ctx context.Context
 	return resources
 }
 
-// ExtractJavaScriptFromURL is a convenience function for one-off extractions
-func ExtractJavaScriptFromURL(url string, headers map[string]string) ([]JSResource, error) {
-	extractor := NewBrowserExtractor()
-	defer extractor.Close()
-
+// ExtractJavaScriptFromURL is a convenience function for one-off extractions, run in the
+// shared browser pool
+func ExtractJavaScriptFromURL(ctx context.Context, url string, headers map[string]string) ([]JSResource, error) {
 	options := ExtractionOptions{
 		Headers:     headers,
 		Timeout:     60 * time.Second,
 		PageTimeout: 20 * time.Second,
 	}
 
-	_, jsResources, err := extractor.ExtractJavaScript(url, options)
+	_, jsResources, _, err := Browsers().ExtractJavaScript(ctx, url, options)
 	return jsResources, err
 }
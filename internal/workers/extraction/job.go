@@ -6,10 +6,17 @@ import (
 	"time"
 
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/events"
 	"github.com/jsh-team/jshunter/internal/storage"
 	"github.com/jsh-team/jshunter/internal/utils/db"
 	"github.com/jsh-team/jshunter/internal/utils/hash"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/htmlversion"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/jsversion"
+	"github.com/jsh-team/jshunter/internal/workers/lineage"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -17,69 +24,116 @@ import (
 )
 
 // processJob processes a single extraction job
-func (p *ExtractionWorkerPool) processJob(workerID int, job ExtractionJob) {
+func (p *ExtractionWorkerPool) processJob(ctx context.Context, workerID int, job ExtractionJob) {
+	run := jobrun.Start(job.App, "extraction", job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+	log := run.Logger()
+
 	startTime := time.Now()
 	errorCount := 0
 
-	logger.Info("Extraction Worker %d started processing", workerID)
-
-	// Create job-specific context with timeout
-	jobCtx, cancel := context.WithTimeout(job.Context, time.Duration(config.BrowserWorkerTimeout)*time.Second)
-	defer cancel()
+	log.Info("Extraction Worker %d started processing", workerID)
 
 	// Process desktop extraction
-	html, jsFiles, err := p.processEndpointWithBrowser(jobCtx, job.Record, false)
+	html, jsFiles, err := p.processEndpointWithBrowser(ctx, job.Record, false)
 	if err != nil {
 		errorCount++
-		logger.Error("Extraction Worker %d failed to process endpoint %s: %v", workerID, job.Record.GetString("url"), err)
-		// Mark as failed
-		job.Record.Set("extraction_status", "failed")
-		job.App.Save(job.Record)
-		logger.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Extraction Worker %d failed to process endpoint %s: %v", workerID, job.Record.GetString("url"), err)
+		markFailed(ctx, job, err)
+		log.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
 	// Save desktop results to database
-	if err := p.saveProcessingResults(job.App, job.Record, html, jsFiles, false); err != nil {
+	if err := SaveResults(job.App, job.Record, html, jsFiles, false); err != nil {
 		errorCount++
-		logger.Error("Extraction Worker %d failed to save results for %s: %v", workerID, job.Record.GetString("url"), err)
-		// Mark as failed
-		job.Record.Set("extraction_status", "failed")
-		job.App.Save(job.Record)
-		logger.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Error("Extraction Worker %d failed to save results for %s: %v", workerID, job.Record.GetString("url"), err)
+		markFailed(ctx, job, err)
+		log.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
 	// If mobile extraction is enabled, do mobile extraction too
 	if config.MobileExtractionEnabled {
-		mobileHTML, mobileJSFiles, _ := p.processEndpointWithBrowser(jobCtx, job.Record, true)
+		mobileHTML, mobileJSFiles, err := p.processEndpointWithBrowser(ctx, job.Record, true)
+		if err != nil {
+			errorCount++
+			log.Error("Extraction Worker %d failed to process mobile version of %s: %v", workerID, job.Record.GetString("url"), err)
+			markFailed(ctx, job, err)
+			log.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+			return
+		}
 
-		if err := p.saveProcessingResults(job.App, job.Record, mobileHTML, mobileJSFiles, true); err != nil {
+		if err := SaveResults(job.App, job.Record, mobileHTML, mobileJSFiles, true); err != nil {
 			errorCount++
-			logger.Error("Extraction Worker %d failed to save mobile results for %s: %v", workerID, job.Record.GetString("url"), err)
-			job.Record.Set("extraction_status", "failed")
-			job.App.Save(job.Record)
-			logger.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+			log.Error("Extraction Worker %d failed to save mobile results for %s: %v", workerID, job.Record.GetString("url"), err)
+			markFailed(ctx, job, err)
+			log.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
 			return
 		}
 
 	}
 
 	// Mark as successfully processed
-	job.Record.Set("extraction_status", "processed")
-	if err := job.App.Save(job.Record); err != nil {
+	if err := Complete(job.App, job.Record); err != nil {
 		errorCount++
-		logger.Error("Extraction Worker %d failed to save final record for %s: %v", workerID, job.Record.GetString("url"), err)
+		log.Error("Extraction Worker %d failed to save final record for %s: %v", workerID, job.Record.GetString("url"), err)
+	}
+
+	log.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+}
+
+// Complete marks the extraction of an endpoint as processed and announces how many scripts it found
+func Complete(app *pocketbase.PocketBase, record *core.Record) error {
+	record.Set("extraction_status", "processed")
+	if err := app.Save(record); err != nil {
+		return err
 	}
 
-	logger.Info("Extraction worker finished in %v with %d errors", time.Since(startTime), errorCount)
+	events.Publish(events.Event{
+		Type:       events.ExtractionFinished,
+		Collection: "endpoints",
+		RecordID:   record.Id,
+		URL:        record.GetString("url"),
+		Data:       map[string]any{"scripts": len(record.GetStringSlice("js_files"))},
+	})
+	return nil
+}
+
+// markFailed sets the failure status of the extraction job and stores it in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job ExtractionJob, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	Fail(job.App, job.Record, status, err)
+}
+
+// Fail sets the given failure status on an endpoint and stores it in the dead letters
+// collection, unless the status is pending (the job was only interrupted)
+func Fail(app *pocketbase.PocketBase, record *core.Record, status string, err error) {
+	record.Set("extraction_status", status)
+	app.Save(record)
+	if status == pool.StatusPending {
+		return
+	}
+
+	deadletter.Record(app, deadletter.Entry{
+		Stage:      "extraction",
+		Collection: "endpoints",
+		RecordID:   record.Id,
+		URL:        record.GetString("url"),
+		Err:        err,
+	})
 }
 
 // processEndpointWithBrowser handles the actual browser processing
-func (p *ExtractionWorkerPool) processEndpointWithBrowser(_ context.Context, record *core.Record, isMobile bool) (string, []JSFileResult, error) {
-	endpointURL := record.GetString("url")
+func (p *ExtractionWorkerPool) processEndpointWithBrowser(ctx context.Context, record *core.Record, isMobile bool) (string, []JSFileResult, error) {
+	return ExtractEndpoint(ctx, record.GetString("url"), RecordHeaders(record), isMobile)
+}
 
-	// Extract headers from record
+// RecordHeaders returns the request headers stored on an endpoint record
+func RecordHeaders(record *core.Record) map[string]string {
 	headersMap := make(map[string]string)
 	if rawHeaders := record.Get("request_headers"); rawHeaders != nil {
 		if headers, ok := rawHeaders.(types.JSONRaw); ok {
@@ -88,11 +142,15 @@ func (p *ExtractionWorkerPool) processEndpointWithBrowser(_ context.Context, rec
 			}
 		}
 	}
+	return headersMap
+}
 
-	// Create browser extractor
-	extractor := NewBrowserExtractor()
-	defer extractor.Close()
+// maxBrowserAttempts is how many browsers an extraction is tried in when they crash
+const maxBrowserAttempts = 2
 
+// ExtractEndpoint loads a page in a pooled browser and returns its HTML and JavaScript
+// files. When the browser crashes during the extraction it is retried once in another one.
+func ExtractEndpoint(ctx context.Context, endpointURL string, headersMap map[string]string, isMobile bool) (string, []JSFileResult, error) {
 	// Create browser options
 	browserOptions := ExtractionOptions{
 		Headers:     headersMap,
@@ -102,7 +160,17 @@ func (p *ExtractionWorkerPool) processEndpointWithBrowser(_ context.Context, rec
 	}
 
 	// Extract HTML and JS for the specified version (desktop or mobile)
-	html, loadedJS, err := extractor.ExtractJavaScript(endpointURL, browserOptions)
+	var html string
+	var loadedJS []JSResource
+	var err error
+	for attempt := 1; attempt <= maxBrowserAttempts; attempt++ {
+		var lost bool
+		html, loadedJS, lost, err = Browsers().ExtractJavaScript(ctx, endpointURL, browserOptions)
+		if err == nil || !lost || ctx.Err() != nil {
+			break
+		}
+		logger.FromContext(ctx).Warn("Browser lost while extracting %s (attempt %d/%d): %v", endpointURL, attempt, maxBrowserAttempts, err)
+	}
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to extract HTML: %w", err)
 	}
@@ -131,16 +199,17 @@ func (p *ExtractionWorkerPool) processEndpointWithBrowser(_ context.Context, rec
 	return html, jsFiles, nil
 }
 
-// saveProcessingResults saves the extracted HTML and JavaScript files
-func (p *ExtractionWorkerPool) saveProcessingResults(app *pocketbase.PocketBase, endpointRecord *core.Record, html string, jsFiles []JSFileResult, isMobile bool) error {
+// SaveResults saves the extracted HTML and JavaScript files of an endpoint
+func SaveResults(app *pocketbase.PocketBase, endpointRecord *core.Record, html string, jsFiles []JSFileResult, isMobile bool) error {
 	// Save HTML file and calculate structural hash
 	htmlHash := storage.SaveHTMLFile(endpointRecord.GetString("url"), html)
 	if htmlHash != "" {
+		variant := htmlversion.VariantDesktop
 		if isMobile {
-			endpointRecord.Set("mobile_hash", htmlHash)
-		} else {
-			endpointRecord.Set("hash", htmlHash)
+			variant = htmlversion.VariantMobile
 		}
+		endpointRecord.Set(htmlversion.HashField(variant), htmlHash)
+		htmlversion.Observe(app, endpointRecord, variant, htmlHash)
 	}
 
 	// Save JavaScript files directly
@@ -154,8 +223,9 @@ func (p *ExtractionWorkerPool) saveProcessingResults(app *pocketbase.PocketBase,
 	for _, jsFile := range jsFiles {
 		// Check for duplicates before saving
 		contentHash := hash.GenerateSha256Hash(jsFile.Content)
-		if existingID := checkExistingJSFile(app, jsFile.URL, contentHash); existingID != "" {
+		if existingID := checkExistingJSFile(app, contentHash); existingID != "" {
 			jsFileIDs = append(jsFileIDs, existingID)
+			jsversion.Observe(app, jsFile.URL, contentHash, existingID)
 			continue
 		}
 		storage.SaveJSFile(jsFile.URL, jsFile.Content)
@@ -164,8 +234,15 @@ func (p *ExtractionWorkerPool) saveProcessingResults(app *pocketbase.PocketBase,
 		newRecord.Set("url", jsFile.URL)
 		newRecord.Set("hash", contentHash)
 		newRecord.Set("type", jsFile.Type)
-		app.Save(newRecord)
+		// Scripts are served one lane below the endpoint that loaded them
+		newRecord.Set("priority", pool.RecordPriority(endpointRecord).Lower().String())
+		lineage.Assign(app, newRecord, jsFile.Content)
+		if err := app.Save(newRecord); err != nil {
+			logger.Error("Error saving JS file record for %s: %v", jsFile.URL, err)
+			continue
+		}
 		jsFileIDs = append(jsFileIDs, newRecord.Id)
+		jsversion.Observe(app, jsFile.URL, contentHash, newRecord.Id)
 	}
 
 	// Update endpoint record with file information
@@ -174,11 +251,13 @@ func (p *ExtractionWorkerPool) saveProcessingResults(app *pocketbase.PocketBase,
 	return app.Save(endpointRecord)
 }
 
-func checkExistingJSFile(app *pocketbase.PocketBase, url string, contentHash string) string {
+// checkExistingJSFile returns the js_file already storing this content. Scripts are matched
+// by content only: new content served from a known URL is a new version of that URL.
+func checkExistingJSFile(app *pocketbase.PocketBase, contentHash string) string {
 	existingRecord, err := app.FindFirstRecordByFilter(
 		"js_files",
-		"url = {:url} || hash = {:hash}",
-		map[string]any{"url": url, "hash": contentHash},
+		"hash = {:hash}",
+		map[string]any{"hash": contentHash},
 	)
 	if err == nil && existingRecord != nil {
 		return existingRecord.Id
@@ -0,0 +1,225 @@
+package extraction
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/go-rod/rod"
+)
+
+// Strategies deciding when a page has finished loading and can be extracted
+const (
+	SettleFixed       = "fixed"       // Always wait the maximum wait
+	SettleLoad        = "load"        // Wait for the load event
+	SettleNetworkIdle = "networkidle" // Wait until no request is in flight for the idle time
+	SettleDOM         = "dom"         // Wait until the DOM did not change for the idle time
+	SettleScript      = "script"      // Wait until a JavaScript predicate is true
+)
+
+// SettleStrategies lists the settle strategies
+var SettleStrategies = []string{SettleFixed, SettleLoad, SettleNetworkIdle, SettleDOM, SettleScript}
+
+// settlePollInterval is how often the settle condition of a page is checked
+const settlePollInterval = 100 * time.Millisecond
+
+// SettleOptions configures when a page is considered settled
+type SettleOptions struct {
+	Strategy  string
+	IdleTime  time.Duration // Quiet time of the networkidle and dom strategies
+	MaxWait   time.Duration // The page is extracted after this wait, settled or not
+	Predicate string        // JavaScript expression of the script strategy
+}
+
+// DefaultSettleOptions returns the settle options of the configuration
+func DefaultSettleOptions() SettleOptions {
+	return SettleOptions{
+		Strategy:  config.SettleStrategy,
+		IdleTime:  time.Duration(config.SettleIdleTime) * time.Millisecond,
+		MaxWait:   time.Duration(config.SettleMaxWait) * time.Second,
+		Predicate: config.SettlePredicate,
+	}
+}
+
+// ValidateSettle checks a settle strategy and its predicate
+func ValidateSettle(strategy string, predicate string) error {
+	if !slices.Contains(SettleStrategies, strategy) {
+		return fmt.Errorf("unknown settle strategy %q, use one of %v", strategy, SettleStrategies)
+	}
+	if strategy == SettleScript && strings.TrimSpace(predicate) == "" {
+		return fmt.Errorf("the %s settle strategy needs a predicate", SettleScript)
+	}
+	return nil
+}
+
+// domQuietScript installs a mutation observer on first call and returns the milliseconds
+// since the DOM last changed. A new document starts without the observer.
+const domQuietScript = `() => {
+	if (!window.__jshunterSettle) {
+		window.__jshunterSettle = { last: Date.now() };
+		new MutationObserver(() => { window.__jshunterSettle.last = Date.now(); })
+			.observe(document, { subtree: true, childList: true, attributes: true, characterData: true });
+	}
+	return Date.now() - window.__jshunterSettle.last;
+}`
+
+// networkTracker counts the requests of a page that are in flight, as seen by the hijack
+// router. The quiet time only starts once the document finished loading: until then the
+// main document, which the router does not load itself, counts as in flight.
+type networkTracker struct {
+	mutex        sync.Mutex
+	inFlight     int
+	requests     int
+	loaded       bool
+	lastActivity time.Time
+}
+
+// newNetworkTracker returns a tracker waiting for its document
+func newNetworkTracker() *networkTracker {
+	return &networkTracker{}
+}
+
+// document records the request of the main document
+func (t *networkTracker) document() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.requests++
+	t.lastActivity = time.Now()
+}
+
+// load records the document finishing to load, the quiet time starts from there
+func (t *networkTracker) load() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.loaded = true
+	t.lastActivity = time.Now()
+}
+
+// isLoaded reports whether the document finished loading
+func (t *networkTracker) isLoaded() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.loaded
+}
+
+// start records a request leaving
+func (t *networkTracker) start() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.inFlight++
+	t.requests++
+	t.lastActivity = time.Now()
+}
+
+// done records a request finishing, successfully or not
+func (t *networkTracker) done() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.inFlight--
+	t.lastActivity = time.Now()
+}
+
+// idle reports whether the document loaded and no request was in flight for the given time
+func (t *networkTracker) idle(quiet time.Duration) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.loaded && t.inFlight <= 0 && time.Since(t.lastActivity) >= quiet
+}
+
+// total returns the number of requests seen
+func (t *networkTracker) total() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.requests
+}
+
+// settle waits until the page is settled according to the options, or until the maximum
+// wait (the end of ctx when there is none). It reports whether the page settled; an error
+// is only returned when ctx is done.
+func settle(ctx context.Context, page *rod.Page, network *networkTracker, options SettleOptions) (bool, error) {
+	var waitCtx context.Context
+	var cancel context.CancelFunc
+	if options.MaxWait > 0 {
+		waitCtx, cancel = context.WithTimeout(ctx, options.MaxWait)
+	} else {
+		waitCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	ticker := time.NewTicker(settlePollInterval)
+	defer ticker.Stop()
+
+	reported := false
+	for {
+		done, err := settled(waitCtx, page, network, options)
+		if err != nil && !reported && waitCtx.Err() == nil {
+			// Expected while the page navigates, a broken predicate shows up here as well
+			logger.FromContext(ctx).Debug("Settle check failed: %v", err)
+			reported = true
+		}
+		if done {
+			return true, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			// The fixed strategy settles by waiting
+			return options.Strategy == SettleFixed, nil
+		}
+	}
+}
+
+// settled checks once whether the page is settled
+func settled(ctx context.Context, page *rod.Page, network *networkTracker, options SettleOptions) (bool, error) {
+	switch options.Strategy {
+	case SettleLoad:
+		return documentLoaded(ctx, page)
+
+	case SettleNetworkIdle:
+		if !network.isLoaded() {
+			// Subresources are still being discovered until the document loaded
+			loaded, err := documentLoaded(ctx, page)
+			if err != nil || !loaded {
+				return false, err
+			}
+			network.load()
+		}
+		return network.idle(options.IdleTime), nil
+
+	case SettleDOM:
+		result, err := page.Context(ctx).Eval(domQuietScript)
+		if err != nil {
+			return false, err
+		}
+		return time.Duration(result.Value.Int())*time.Millisecond >= options.IdleTime, nil
+
+	case SettleScript:
+		result, err := page.Context(ctx).Eval(`() => Boolean(` + options.Predicate + `)`)
+		if err != nil {
+			return false, err
+		}
+		return result.Value.Bool(), nil
+	}
+
+	// SettleFixed: only the maximum wait ends it
+	return false, nil
+}
+
+// documentLoaded reports whether the document of the page fired its load event
+func documentLoaded(ctx context.Context, page *rod.Page) (bool, error) {
+	result, err := page.Context(ctx).Eval(`() => document.readyState === "complete"`)
+	if err != nil {
+		return false, err
+	}
+	return result.Value.Bool(), nil
+}
@@ -1,8 +1,7 @@
 package extraction
 
 import (
-	"context"
-	"sync"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -10,25 +9,18 @@ import (
 
 // ExtractionJob represents a job for extracting content from endpoints
 type ExtractionJob struct {
-	App     *pocketbase.PocketBase
-	Record  *core.Record
-	Context context.Context
+	App    *pocketbase.PocketBase
+	Record *core.Record
 }
 
 // ExtractionWorkerPool manages a pool of workers for content extraction
 type ExtractionWorkerPool struct {
-	workers   int
-	jobQueue  chan ExtractionJob
-	workerWg  sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-	isRunning bool
-	mu        sync.RWMutex
+	*pool.Pool[ExtractionJob]
 }
 
 // JSFileResult represents a JavaScript file extracted from an endpoint
 type JSFileResult struct {
-	URL     string
-	Content string
-	Type    string // "normal", "inline", "mobile"
+	URL     string `json:"url"`
+	Content string `json:"content"`
+	Type    string `json:"type"` // "normal", "inline", "mobile"
 }
@@ -0,0 +1,203 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollectionName is the name of the collection storing one entry per distinct finding
+const CollectionName = "finding_fingerprints"
+
+// backfillBatch is the number of findings fingerprinted per transaction by Backfill
+const backfillBatch = 1000
+
+// Normalize returns the value of a finding as compared across builds: surrounding quotes
+// and whitespace are dropped, inner whitespace collapsed and the scheme and host of an
+// absolute URL lowercased
+func Normalize(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if len(value) >= 2 {
+		if first, last := value[0], value[len(value)-1]; first == last && strings.ContainsRune("\"'`", rune(first)) {
+			value = strings.TrimSpace(value[1 : len(value)-1])
+		}
+	}
+
+	if parsed, err := url.Parse(value); err == nil && parsed.Host != "" && (parsed.Scheme == "http" || parsed.Scheme == "https" || strings.HasPrefix(value, "//")) {
+		// Only the scheme and host: re-encoding the path would change the value
+		hostEnd := strings.Index(value, "//") + 2
+		if end := strings.IndexAny(value[hostEnd:], "/?#"); end >= 0 {
+			hostEnd += end
+		} else {
+			hostEnd = len(value)
+		}
+		value = strings.ToLower(value[:hostEnd]) + value[hostEnd:]
+	}
+	return value
+}
+
+// Scope returns what a finding belongs to: the lineage of its script, so the same finding
+// in every build of a bundle shares one fingerprint, or the script URL before the lineage
+// is known
+func Scope(jsFile *core.Record) string {
+	if jsFile == nil {
+		return ""
+	}
+	if lineageID := jsFile.GetString("lineage_id"); lineageID != "" {
+		return "lineage:" + lineageID
+	}
+	return "url:" + jsFile.GetString("url")
+}
+
+// Compute returns the fingerprint of a finding
+func Compute(category string, findingType string, value string, scope string) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{category, findingType, Normalize(value), scope}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tracker records the findings of one transaction in the fingerprints collection, keeping
+// the records it already loaded so repeated findings cost a single lookup
+type Tracker struct {
+	app        core.App
+	collection *core.Collection
+	records    map[string]*core.Record
+}
+
+// NewTracker returns a tracker saving through app, usually a transaction
+func NewTracker(app core.App) (*Tracker, error) {
+	collection, err := app.FindCollectionByNameOrId(CollectionName)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracker{app: app, collection: collection, records: make(map[string]*core.Record)}, nil
+}
+
+// Find returns the record of a fingerprint, or nil when the finding was never seen
+func (t *Tracker) Find(fingerprint string) *core.Record {
+	if record, ok := t.records[fingerprint]; ok {
+		return record
+	}
+	record, err := t.app.FindFirstRecordByFilter(CollectionName, "fingerprint = {:fingerprint}", dbx.Params{"fingerprint": fingerprint})
+	if err != nil {
+		return nil
+	}
+	t.records[fingerprint] = record
+	return record
+}
+
+// Observe records an occurrence of a finding seen at the given time in a js_file and
+// returns its fingerprint. The first occurrence sets first_seen; later ones move
+// last_seen forward and count the occurrence.
+func (t *Tracker) Observe(category string, findingType string, value string, jsFile *core.Record, seen time.Time) (string, error) {
+	scope := Scope(jsFile)
+	fingerprint := Compute(category, findingType, value, scope)
+
+	record := t.Find(fingerprint)
+	if record == nil {
+		record = core.NewRecord(t.collection)
+		record.Set("fingerprint", fingerprint)
+		record.Set("category", category)
+		record.Set("type", findingType)
+		record.Set("value", Normalize(value))
+		record.Set("scope", scope)
+		record.Set("first_seen", seen)
+		record.Set("occurrences", 0)
+		if jsFile != nil {
+			record.Set("first_js_file", jsFile.Id)
+		}
+		t.records[fingerprint] = record
+	}
+
+	// Backfilled findings are not seen in order
+	if firstSeen := record.GetDateTime("first_seen"); !firstSeen.IsZero() && seen.Before(firstSeen.Time()) {
+		record.Set("first_seen", seen)
+		if jsFile != nil {
+			record.Set("first_js_file", jsFile.Id)
+		}
+	}
+	if lastSeen := record.GetDateTime("last_seen"); lastSeen.IsZero() || !seen.Before(lastSeen.Time()) {
+		record.Set("last_seen", seen)
+		if jsFile != nil {
+			record.Set("last_js_file", jsFile.Id)
+		}
+	}
+	record.Set("occurrences", record.GetInt("occurrences")+1)
+
+	if err := t.app.Save(record); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// Backfill fingerprints and keys the findings stored before fingerprints or unique keys
+// were tracked, in batches so a large target does not hold one long transaction
+func Backfill(app core.App) {
+	startTime := time.Now()
+	total := 0
+	jsFiles := make(map[string]*core.Record)
+
+	for {
+		findings, err := app.FindRecordsByFilter("findings", "fingerprint = '' || unique_key = ''", "created_at", backfillBatch, 0)
+		if err != nil {
+			logger.Error("Failed to find findings without fingerprint: %v", err)
+			return
+		}
+		if len(findings) == 0 {
+			break
+		}
+
+		err = app.RunInTransaction(func(txApp core.App) error {
+			tracker, err := NewTracker(txApp)
+			if err != nil {
+				return err
+			}
+
+			for _, finding := range findings {
+				jsFileID := finding.GetString("js_file")
+				jsFile, ok := jsFiles[jsFileID]
+				if !ok && jsFileID != "" {
+					jsFile, _ = txApp.FindRecordById("js_files", jsFileID)
+					jsFiles[jsFileID] = jsFile
+				}
+
+				var category string
+				var metadata map[string]any
+				if err := finding.UnmarshalJSONField("metadata", &metadata); err == nil {
+					category, _ = metadata["finding_category"].(string)
+				}
+
+				// Findings fingerprinted before unique keys existed are already counted
+				if finding.GetString("fingerprint") == "" {
+					fingerprint, err := tracker.Observe(category, finding.GetString("type"), finding.GetString("value"), jsFile, finding.GetDateTime("created_at").Time())
+					if err != nil {
+						return err
+					}
+					finding.Set("fingerprint", fingerprint)
+				}
+				finding.Set("unique_key", Key(category, finding.GetString("value")))
+
+				// Skip hooks: a fingerprint is not a new finding
+				if err := txApp.UnsafeWithoutHooks().Save(finding); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error("Failed to fingerprint findings: %v", err)
+			return
+		}
+		total += len(findings)
+	}
+
+	if total > 0 {
+		logger.Info("Fingerprinted %d findings in %v", total, time.Since(startTime))
+	}
+}
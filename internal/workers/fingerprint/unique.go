@@ -0,0 +1,95 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+)
+
+// Key returns the key of a unique finding: its category and normalized value, whatever the
+// type, script or target it was found in. The same API base URL hard-coded in dozens of
+// chunks is one unique finding.
+func Key(category string, value string) string {
+	sum := sha256.Sum256([]byte(category + "\x00" + Normalize(value)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Unique is the aggregate of every finding sharing a key
+type Unique struct {
+	Key         string   `db:"unique_key" json:"key"`
+	Category    string   `db:"category" json:"category"`
+	Value       string   `db:"value" json:"value"`
+	RawTypes    string   `db:"types" json:"-"`
+	Types       []string `db:"-" json:"types"`
+	Occurrences int      `db:"occurrences" json:"occurrences"`
+	Files       int      `db:"files" json:"files"` // Distinct js_files
+	FirstSeen   string   `db:"first_seen" json:"first_seen"`
+	LastSeen    string   `db:"last_seen" json:"last_seen"`
+}
+
+// UniqueFilter selects unique findings. Empty fields match everything.
+type UniqueFilter struct {
+	Key            string
+	Category       string
+	Type           string
+	Search         string // Part of the value
+	MinOccurrences int
+}
+
+// categoryColumn extracts the category of a finding from its metadata
+const categoryColumn = "COALESCE(json_extract(metadata, '$.finding_category'), '')"
+
+// UniqueQuery returns the query grouping the findings by key, most frequent first.
+// Findings stored before keys existed are left out until Backfill keyed them.
+func UniqueQuery(db dbx.Builder, filter UniqueFilter) *dbx.SelectQuery {
+	query := db.Select(
+		"unique_key",
+		"MIN("+categoryColumn+") AS category",
+		"MIN(value) AS value",
+		"GROUP_CONCAT(DISTINCT type) AS types",
+		"COUNT(*) AS occurrences",
+		"COUNT(DISTINCT js_file) AS files",
+		"MIN(created_at) AS first_seen",
+		"MAX(created_at) AS last_seen",
+	).
+		From("findings").
+		Where(dbx.NewExp("unique_key != ''")).
+		GroupBy("unique_key").
+		OrderBy("occurrences DESC", "unique_key")
+
+	if filter.Key != "" {
+		query.AndWhere(dbx.HashExp{"unique_key": filter.Key})
+	}
+	if filter.Category != "" {
+		query.AndWhere(dbx.NewExp(categoryColumn+" = {:category}", dbx.Params{"category": filter.Category}))
+	}
+	if filter.Type != "" {
+		query.AndWhere(dbx.HashExp{"type": filter.Type})
+	}
+	if filter.Search != "" {
+		query.AndWhere(dbx.Like("value", filter.Search))
+	}
+	if filter.MinOccurrences > 1 {
+		query.Having(dbx.NewExp("COUNT(*) >= {:min}", dbx.Params{"min": filter.MinOccurrences}))
+	}
+	return query
+}
+
+// CountUnique returns how many unique findings a query built by UniqueQuery returns,
+// without its limit and offset
+func CountUnique(db dbx.Builder, query *dbx.SelectQuery) (int, error) {
+	built := query.Limit(-1).Offset(-1).Build()
+	var total int
+	err := db.NewQuery("SELECT COUNT(*) FROM (" + built.SQL() + ")").Bind(built.Params()).Row(&total)
+	return total, err
+}
+
+// Tidy fills the fields of unique findings that are not read from the database
+func Tidy(uniques []Unique) {
+	for i := range uniques {
+		uniques[i].Value = Normalize(uniques[i].Value)
+		uniques[i].Types = strings.Split(uniques[i].RawTypes, ",")
+	}
+}
@@ -0,0 +1,442 @@
+// Package gitsnapshot mirrors the scripts of the target into a git repository in its storage
+// directory, so its history can be read with git log, blame and bisect. Every extraction run
+// becomes one commit once the pipeline is done with it: the prettified scripts of the
+// endpoints and the sources recovered from their sourcemaps, organised by domain and
+// normalized path so the successive builds of a bundle are the same file.
+package gitsnapshot
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/filesystem"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	urlutils "github.com/jsh-team/jshunter/internal/utils/url"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/monitor"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// jobID is the cron job looking for extraction runs to commit every minute
+const jobID = "jshunter_git_snapshot"
+
+// settleTimeout is how long a run waits for the pipeline before what it has is committed
+const settleTimeout = 6 * time.Hour
+
+// sourcesSuffix is added to the path of a script to get the directory of its recovered sources
+const sourcesSuffix = ".sources"
+
+// Limits of the commit message
+const (
+	maxListed      = 200
+	maxValueLength = 200
+)
+
+// ticking makes sure a slow commit is never overlapped by the next tick
+var ticking sync.Mutex
+
+// run is the last extraction of an endpoint not committed yet
+type run struct {
+	endpoint   *core.Record
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// Start creates the repository and registers the cron job committing the extraction
+// runs. It does nothing unless git snapshots are enabled.
+func Start(app *pocketbase.PocketBase) error {
+	if !config.GitSnapshotsEnabled {
+		return nil
+	}
+	if err := Init(); err != nil {
+		return err
+	}
+	logger.Info("Git snapshots enabled in %s", Dir())
+	return app.Cron().Add(jobID, "* * * * *", func() {
+		Tick(app)
+	})
+}
+
+// Tick commits the extraction runs finished since the last commit. The runs are committed
+// together once no endpoint is being extracted and all of them went through the pipeline,
+// or once the oldest one waited settleTimeout.
+func Tick(app *pocketbase.PocketBase) {
+	if !ticking.TryLock() {
+		return
+	}
+	defer ticking.Unlock()
+
+	if err := Commit(app, false); err != nil {
+		logger.Error("Failed to commit git snapshot: %v", err)
+	}
+}
+
+// Commit commits the extraction runs finished since the last commit. Unless force is set,
+// it waits for the pipeline as described in Tick.
+func Commit(app core.App, force bool) error {
+	s, err := loadState()
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot state: %w", err)
+	}
+
+	runs, err := pendingRuns(app, s.Since)
+	if err != nil || len(runs) == 0 {
+		return err
+	}
+
+	if !force && time.Since(runs[0].finishedAt) < settleTimeout && !quiet(app, runs) {
+		return nil
+	}
+
+	t := newTree()
+	paths := make(map[string][]string, len(runs))
+	var scripts []*core.Record
+	for _, r := range runs {
+		jsFiles, err := monitor.Scripts(app, r.endpoint)
+		if err != nil {
+			return err
+		}
+		paths[r.endpoint.Id] = t.write(jsFiles)
+		scripts = append(scripts, jsFiles...)
+	}
+
+	// Files of these endpoints that no endpoint has anymore are removed from the tree
+	kept := make(map[string]bool)
+	for id, written := range s.Paths {
+		if _, replaced := paths[id]; replaced {
+			continue
+		}
+		for _, p := range written {
+			kept[p] = true
+		}
+	}
+	for _, written := range paths {
+		for _, p := range written {
+			kept[p] = true
+		}
+	}
+	for id := range paths {
+		for _, p := range s.Paths[id] {
+			if !kept[p] {
+				if err := remove(p); err != nil {
+					return err
+				}
+			}
+		}
+		s.Paths[id] = paths[id]
+	}
+
+	findings, err := newFindings(app, scripts, runs[0].startedAt)
+	if err != nil {
+		return err
+	}
+
+	committed, err := commit(message(runs, findings))
+	if err != nil {
+		return err
+	}
+
+	s.Since = runs[len(runs)-1].finishedAt
+	if err := saveState(s); err != nil {
+		return fmt.Errorf("failed to save snapshot state: %w", err)
+	}
+
+	if committed {
+		logger.Info("Git snapshot of %d %s committed with %d new findings", len(runs), plural(len(runs), "endpoint"), len(findings))
+	}
+	return nil
+}
+
+// pendingRuns returns the last successful extraction of every endpoint extracted after
+// since, oldest first
+func pendingRuns(app core.App, since time.Time) ([]run, error) {
+	records := []*core.Record{}
+	err := app.RecordQuery(jobrun.CollectionName).
+		AndWhere(dbx.HashExp{"stage": "extraction", "record_collection": "endpoints", "status": pool.StatusProcessed}).
+		AndWhere(dbx.NewExp("finished_at > {:since}", dbx.Params{"since": dateTime(since)})).
+		OrderBy("finished_at ASC").
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	byEndpoint := make(map[string]int)
+	var runs []run
+	for _, record := range records {
+		endpointID := record.GetString("record_id")
+		if i, ok := byEndpoint[endpointID]; ok {
+			runs[i].finishedAt = record.GetDateTime("finished_at").Time()
+			continue
+		}
+		endpoint, err := app.FindRecordById("endpoints", endpointID)
+		if err != nil {
+			continue
+		}
+		byEndpoint[endpointID] = len(runs)
+		runs = append(runs, run{
+			endpoint:   endpoint,
+			startedAt:  record.GetDateTime("started_at").Time(),
+			finishedAt: record.GetDateTime("finished_at").Time(),
+		})
+	}
+
+	slices.SortStableFunc(runs, func(a, b run) int {
+		return a.finishedAt.Compare(b.finishedAt)
+	})
+	return runs, nil
+}
+
+// quiet reports whether no endpoint is waiting for its extraction and the endpoints of
+// the runs went through the whole pipeline. Failed and timed out stages count as finished,
+// so one broken script does not hold the commit back.
+func quiet(app core.App, runs []run) bool {
+	extracting, err := app.CountRecords("endpoints", dbx.In("extraction_status", pool.StatusPending, pool.StatusProcessing))
+	if err != nil || extracting > 0 {
+		return false
+	}
+	for _, r := range runs {
+		if !monitor.Settled(app, r.endpoint) {
+			return false
+		}
+	}
+	return true
+}
+
+// tree tracks the files written for one commit
+type tree struct {
+	owners map[string]string   // Script URL of every path written
+	copied map[string][]string // Paths written for every script, by id
+}
+
+func newTree() *tree {
+	return &tree{owners: make(map[string]string), copied: make(map[string][]string)}
+}
+
+// write copies the stored scripts and their recovered sources into the tree and returns
+// the paths written. Scripts of different URLs sharing a normalized path are told apart by
+// their hash. A script that cannot be copied is left out of the snapshot.
+func (t *tree) write(jsFiles []*core.Record) []string {
+	slices.SortFunc(jsFiles, func(a, b *core.Record) int {
+		return strings.Compare(a.GetString("url"), b.GetString("url"))
+	})
+
+	var written []string
+	for _, jsFile := range jsFiles {
+		if paths, ok := t.copied[jsFile.Id]; ok {
+			written = append(written, paths...)
+			continue
+		}
+		paths := t.copy(jsFile)
+		t.copied[jsFile.Id] = paths
+		written = append(written, paths...)
+	}
+	return written
+}
+
+// copy writes one script and its sources into the tree
+func (t *tree) copy(jsFile *core.Record) []string {
+	url, hash := jsFile.GetString("url"), jsFile.GetString("hash")
+	treePath, err := TreePath(url)
+	if err != nil {
+		logger.Debug("Skipping script %s from git snapshot: %v", url, err)
+		return nil
+	}
+	if owner, ok := t.owners[treePath]; ok && owner != url {
+		ext := path.Ext(treePath)
+		treePath = strings.TrimSuffix(treePath, ext) + "~" + hash[:min(len(hash), 8)] + ext
+	}
+	t.owners[treePath] = url
+
+	stored, err := storage.GetJSFilePath(url, hash)
+	if err != nil {
+		return nil
+	}
+	content, err := os.ReadFile(stored)
+	if err != nil {
+		logger.Debug("Skipping script %s from git snapshot: %v", url, err)
+		return nil
+	}
+	if err := writeFile(treePath, content); err != nil {
+		logger.Warn("Failed to write %s to git snapshot: %v", url, err)
+		return nil
+	}
+
+	sources, err := copySources(filepath.Join(filepath.Dir(stored), "original"), treePath+sourcesSuffix)
+	if err != nil {
+		logger.Warn("Failed to write the sources of %s to git snapshot: %v", url, err)
+	}
+	return append([]string{treePath}, sources...)
+}
+
+// copySources copies the sources recovered from the sourcemap of a script into the tree
+func copySources(originalDir, treeDir string) ([]string, error) {
+	var written []string
+	err := filepath.WalkDir(originalDir, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(originalDir, fullPath)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(fullPath)
+		if err != nil {
+			return err
+		}
+		treePath := path.Join(treeDir, filepath.ToSlash(rel))
+		if err := writeFile(treePath, content); err != nil {
+			return err
+		}
+		written = append(written, treePath)
+		return nil
+	})
+	return written, err
+}
+
+// writeFile writes a file of the tree unless it already has that content
+func writeFile(treePath string, content []byte) error {
+	fullPath := filepath.Join(Dir(), filepath.FromSlash(treePath))
+	if current, err := os.ReadFile(fullPath); err == nil && string(current) == string(content) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	return filesystem.WriteFileAtomic(fullPath, content, 0644)
+}
+
+// TreePath returns the path of a script in the repository: its domain followed by the
+// normalized path of its URL, so main.3f2a1.js and main.9b8c7.js are the same file
+func TreePath(rawURL string) (string, error) {
+	domain, err := filesystem.ExtractDomain(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	segments := []string{filesystem.CleanPathComponent(strings.ToLower(domain))}
+	for _, segment := range strings.Split(urlutils.NormalizedPath(rawURL), "/") {
+		if cleaned := filesystem.CleanPathComponent(segment); cleaned != "" {
+			segments = append(segments, cleaned)
+		}
+	}
+	if len(segments) == 1 {
+		segments = append(segments, "index.js")
+	}
+
+	// A script must never take the place of the sources directory of another
+	treePath := path.Join(segments...)
+	if strings.HasSuffix(treePath, sourcesSuffix) {
+		treePath += ".js"
+	}
+	return treePath, nil
+}
+
+// newFindings returns the fingerprints of the findings of the scripts first seen since
+// the given time, oldest first
+func newFindings(app core.App, scripts []*core.Record, since time.Time) ([]*core.Record, error) {
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	ids := make([]any, 0, len(scripts))
+	for _, jsFile := range scripts {
+		ids = append(ids, jsFile.Id)
+	}
+
+	var fingerprints []string
+	err := app.DB().Select("fingerprint").Distinct(true).
+		From("findings").
+		Where(dbx.In("js_file", ids...)).
+		AndWhere(dbx.NewExp("fingerprint != ''")).
+		Column(&fingerprints)
+	if err != nil || len(fingerprints) == 0 {
+		return nil, err
+	}
+
+	values := make([]any, 0, len(fingerprints))
+	for _, value := range fingerprints {
+		values = append(values, value)
+	}
+	records := []*core.Record{}
+	err = app.RecordQuery(fingerprint.CollectionName).
+		AndWhere(dbx.In("fingerprint", values...)).
+		AndWhere(dbx.NewExp("first_seen >= {:since}", dbx.Params{"since": dateTime(since)})).
+		OrderBy("first_seen ASC", "category ASC", "type ASC").
+		All(&records)
+	return records, err
+}
+
+// message describes a commit: the endpoint URLs first, then the new findings
+func message(runs []run, findings []*core.Record) string {
+	var out strings.Builder
+	if len(runs) == 1 {
+		fmt.Fprintf(&out, "Extract %s\n\n", runs[0].endpoint.GetString("url"))
+	} else {
+		fmt.Fprintf(&out, "Extract %d endpoints\n\n", len(runs))
+	}
+
+	out.WriteString("Endpoints:\n")
+	for i, r := range runs {
+		if i == maxListed {
+			fmt.Fprintf(&out, "...and %d more\n", len(runs)-maxListed)
+			break
+		}
+		fmt.Fprintf(&out, "- %s\n", r.endpoint.GetString("url"))
+	}
+
+	if len(findings) == 0 {
+		out.WriteString("\nNo new findings\n")
+		return out.String()
+	}
+	fmt.Fprintf(&out, "\nNew findings (%d):\n", len(findings))
+	for i, finding := range findings {
+		if i == maxListed {
+			fmt.Fprintf(&out, "...and %d more\n", len(findings)-maxListed)
+			break
+		}
+		value := strings.Join(strings.Fields(finding.GetString("value")), " ")
+		if len(value) > maxValueLength {
+			value = value[:maxValueLength] + "..."
+		}
+		fmt.Fprintf(&out, "- %s/%s: %s\n", finding.GetString("category"), finding.GetString("type"), value)
+	}
+	return out.String()
+}
+
+// dateTime formats a time the way dates are stored, empty for the zero time
+func dateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	value, _ := types.ParseDateTime(t)
+	return value.String()
+}
+
+// plural adds an s to the word unless count is 1
+func plural(count int, word string) string {
+	if count == 1 {
+		return word
+	}
+	return word + "s"
+}
@@ -0,0 +1,147 @@
+package gitsnapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/filesystem"
+)
+
+const (
+	// dirName is the directory of the repository inside the storage directory
+	dirName = "git"
+	// stateName is the file of the repository state, kept in .git so it is never committed
+	stateName = "jshunter.json"
+
+	// gitTimeout bounds a single git command
+	gitTimeout = 5 * time.Minute
+
+	// Author of the snapshot commits
+	authorName  = "JSHunter"
+	authorEmail = "jshunter@localhost"
+)
+
+// state is what the repository remembers between two commits
+type state struct {
+	// Since is when the newest committed extraction run finished
+	Since time.Time `json:"since"`
+	// Paths are the files of the tree written for each endpoint, relative to the repository
+	Paths map[string][]string `json:"paths"`
+}
+
+// Dir returns the repository of the current target
+func Dir() string {
+	return filepath.Join(config.StorageDir, dirName)
+}
+
+// Init creates the repository of the target unless it exists
+func Init() error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git not found: %w", err)
+	}
+	if _, err := os.Stat(filepath.Join(Dir(), ".git")); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return err
+	}
+	_, err := git("init", "--quiet")
+	return err
+}
+
+// git runs a git command in the repository and returns its output
+func git(args ...string) (string, error) {
+	return gitInput(nil, args...)
+}
+
+// gitInput runs a git command with the given standard input
+func gitInput(stdin []byte, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitTimeout)
+	defer cancel()
+
+	command := args[0]
+	// The author is set here so the repository never depends on the user's git config
+	args = append([]string{"-C", Dir(), "-c", "user.name=" + authorName, "-c", "user.email=" + authorEmail, "-c", "commit.gpgsign=false"}, args...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// commit stages the whole tree and commits it. It reports whether there was anything to commit.
+func commit(message string) (bool, error) {
+	if _, err := git("add", "--all"); err != nil {
+		return false, err
+	}
+	status, err := git("status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+	if _, err := gitInput([]byte(message), "commit", "--quiet", "--file=-"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// loadState reads the repository state, empty when the repository has no commit yet
+func loadState() (state, error) {
+	s := state{Paths: make(map[string][]string)}
+	data, err := os.ReadFile(filepath.Join(Dir(), ".git", stateName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, err
+	}
+	if s.Paths == nil {
+		s.Paths = make(map[string][]string)
+	}
+	return s, nil
+}
+
+// saveState writes the repository state
+func saveState(s state) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return filesystem.WriteFileAtomic(filepath.Join(Dir(), ".git", stateName), data, 0644)
+}
+
+// remove deletes a file of the tree and the directories it leaves empty
+func remove(relPath string) error {
+	fullPath := filepath.Join(Dir(), relPath)
+	if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for dir := filepath.Dir(fullPath); dir != Dir() && strings.HasPrefix(dir, Dir()); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package htmlversion
+
+import (
+	"path/filepath"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/versioning"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollectionName is the name of the collection storing the structural history of endpoint pages
+const CollectionName = "endpoint_versions"
+
+// Variants of a page, as rendered by the desktop and the mobile browser
+const (
+	VariantDesktop = "desktop"
+	VariantMobile  = "mobile"
+)
+
+// Variants lists the page variants
+var Variants = []string{VariantDesktop, VariantMobile}
+
+// HashField returns the endpoint field holding the latest structural hash of a variant
+func HashField(variant string) string {
+	if variant == VariantMobile {
+		return "mobile_hash"
+	}
+	return "hash"
+}
+
+// File returns the path of the stored page of a URL and structural hash, relative to the
+// files directory of the target, or an empty string when the URL has no domain
+func File(url string, hash string) string {
+	filePath, err := storage.GetHTMLFilePath(url, hash)
+	if err != nil {
+		return ""
+	}
+	relPath, err := filepath.Rel(config.GetFilesPath(), filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// Path returns the absolute path of the stored page of a version
+func Path(version *core.Record) string {
+	return filepath.Join(config.GetFilesPath(), filepath.FromSlash(version.GetString("file")))
+}
+
+// Observe records that the page of an endpoint had the given structural hash, as a version
+// of the page variant
+func Observe(app core.App, endpoint *core.Record, variant string, hash string) {
+	if app == nil || endpoint == nil || endpoint.Id == "" || hash == "" {
+		return
+	}
+
+	url := endpoint.GetString("url")
+	err := versioning.Observe(app, CollectionName,
+		dbx.HashExp{"endpoint": endpoint.Id, "variant": variant},
+		hash,
+		map[string]any{"url": url, "file": File(url, hash)},
+	)
+	if err != nil {
+		logger.Error("Failed to record page version of %s with hash %s: %v", url, hash, err)
+	}
+}
+
+// List returns the versions of the page of an endpoint, newest first
+func List(app core.App, endpointID string, variant string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter(
+		CollectionName,
+		"endpoint = {:endpoint} && variant = {:variant}",
+		"-version", 0, 0,
+		dbx.Params{"endpoint": endpointID, "variant": variant},
+	)
+}
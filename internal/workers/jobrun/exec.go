@@ -0,0 +1,161 @@
+package jobrun
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+)
+
+// maxStderrTail is how much of the stderr of a command is kept for error reports
+const maxStderrTail = 64 * 1024
+
+// versionProbeTimeout bounds the `--version` call made on managed binaries
+const versionProbeTimeout = 5 * time.Second
+
+// binaryInfo identifies a binary on disk
+type binaryInfo struct {
+	modTime  time.Time
+	size     int64
+	version  string
+	checksum string
+}
+
+var (
+	binaryCacheMu sync.Mutex
+	binaryCache   = make(map[string]binaryInfo)
+)
+
+// Output runs the command like cmd.Output and attaches its binary, exit code and
+// output sizes to the run of ctx. The tail of stderr is still available on *exec.ExitError.
+func Output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	stderr := &tailWriter{max: maxStderrTail}
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitErr.Stderr = stderr.Bytes()
+	}
+
+	if run := FromContext(ctx); run != nil {
+		command := &Command{
+			Binary:     filepath.Base(cmd.Path),
+			ExitCode:   -1,
+			StdoutSize: stdout.Len(),
+			StderrSize: stderr.size,
+		}
+		if cmd.ProcessState != nil {
+			command.ExitCode = cmd.ProcessState.ExitCode()
+		}
+		command.Version, command.Checksum = describeBinary(cmd.Path)
+		run.SetCommand(command)
+	}
+
+	return stdout.Bytes(), err
+}
+
+// describeBinary returns the version and SHA-256 checksum of a binary. Results are
+// cached until the file changes. Only the binaries installed by jshunter are asked
+// for their version; custom stage commands could do anything with an extra argument.
+func describeBinary(path string) (string, string) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", ""
+	}
+
+	binaryCacheMu.Lock()
+	info, ok := binaryCache[path]
+	binaryCacheMu.Unlock()
+	if ok && info.modTime.Equal(stat.ModTime()) && info.size == stat.Size() {
+		return info.version, info.checksum
+	}
+
+	info = binaryInfo{modTime: stat.ModTime(), size: stat.Size()}
+	info.checksum, _ = fileSHA256(path)
+	if isManagedBinary(path) {
+		info.version = probeVersion(path)
+	}
+
+	binaryCacheMu.Lock()
+	binaryCache[path] = info
+	binaryCacheMu.Unlock()
+
+	return info.version, info.checksum
+}
+
+// isManagedBinary reports whether path is one of the analyzer, prettifier or dechunker binaries
+func isManagedBinary(path string) bool {
+	for _, managed := range []string{config.AnalyzerBinaryPath, config.PrettifierBinaryPath, config.DechunkerBinaryPath} {
+		if managed != "" && managed == path {
+			return true
+		}
+	}
+	return false
+}
+
+// probeVersion asks a binary for its version. Anything but a short single line is ignored.
+func probeVersion(path string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return ""
+	}
+
+	version := strings.TrimSpace(string(output))
+	if version == "" || len(version) > 100 || strings.Contains(version, "\n") {
+		return ""
+	}
+	return version
+}
+
+// fileSHA256 returns the hex SHA-256 checksum of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tailWriter counts everything written to it and keeps the last max bytes
+type tailWriter struct {
+	max  int
+	size int
+	buf  []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.size += len(p)
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > w.max {
+		w.buf = w.buf[len(w.buf)-w.max:]
+	}
+	return len(p), nil
+}
+
+// Bytes returns the kept tail
+func (w *tailWriter) Bytes() []byte {
+	return w.buf
+}
@@ -0,0 +1,237 @@
+package jobrun
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/metrics"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollectionName is the name of the collection storing one entry per stage execution
+const CollectionName = "job_runs"
+
+// maxErrorSize limits how much of a job error is stored
+const maxErrorSize = 50000
+
+// Command describes the last external binary a job ran
+type Command struct {
+	Binary     string `json:"binary"`
+	Version    string `json:"binary_version,omitempty"`
+	Checksum   string `json:"binary_checksum,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	StdoutSize int    `json:"stdout_size"`
+	StderrSize int    `json:"stderr_size"`
+}
+
+// PageTiming describes how a page loaded and settled during an extraction
+type PageTiming struct {
+	URL        string `json:"url"`
+	Variant    string `json:"variant"`  // desktop or mobile
+	Strategy   string `json:"strategy"` // Settle strategy
+	Settled    bool   `json:"settled"`  // False when the page was extracted after the maximum wait
+	NavigateMS int64  `json:"navigate_ms"`
+	SettleMS   int64  `json:"settle_ms"`
+	TotalMS    int64  `json:"total_ms"`
+	Requests   int    `json:"requests"` // Requests made by the page, the document excluded
+	Error      string `json:"error,omitempty"`
+}
+
+// Run traces a single execution of a stage on a record. It is written to the
+// job_runs collection when Finish is called.
+type Run struct {
+	app        core.App
+	stage      string
+	collection string
+	recordID   string
+	url        string
+	workerID   string
+	startedAt  time.Time
+
+	mu       sync.Mutex
+	status   string
+	err      error
+	command  *Command
+	pages    []PageTiming
+	finished bool
+}
+
+type contextKey struct{}
+
+// Start begins tracing a stage execution on the record. A nil app gives a run
+// that collects command details without being stored (used by remote workers).
+func Start(app core.App, stage string, record *core.Record, workerID string) *Run {
+	run := &Run{
+		app:       app,
+		stage:     stage,
+		workerID:  workerID,
+		startedAt: time.Now(),
+	}
+	if record != nil {
+		run.recordID = record.Id
+		run.url = record.GetString("url")
+		if record.Collection() != nil {
+			run.collection = record.Collection().Name
+		}
+	}
+	return run
+}
+
+// LocalWorker returns the worker id stored for a worker of a local pool
+func LocalWorker(workerID int) string {
+	return fmt.Sprintf("local-%d", workerID)
+}
+
+// Logger returns a logger attaching the stage, worker and record of the run to every line
+func (r *Run) Logger() logger.Logger {
+	if r == nil {
+		return logger.Logger{}
+	}
+	return logger.With(logger.Fields{
+		"stage":     r.stage,
+		"worker_id": r.workerID,
+		"record_id": r.recordID,
+		"url":       r.url,
+	})
+}
+
+// NewContext returns a context carrying the run and its logger, so external commands
+// started with Output are attached to the run and log lines carry its fields
+func NewContext(ctx context.Context, run *Run) context.Context {
+	ctx = logger.NewContext(ctx, run.Logger())
+	return context.WithValue(ctx, contextKey{}, run)
+}
+
+// FromContext returns the run of the context, or nil
+func FromContext(ctx context.Context) *Run {
+	run, _ := ctx.Value(contextKey{}).(*Run)
+	return run
+}
+
+// Fail marks the run as failed with the given status
+func (r *Run) Fail(status string, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+	r.err = err
+}
+
+// Command returns the details of the last external command of the run, or nil
+func (r *Run) Command() *Command {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.command
+}
+
+// SetCommand attaches the details of an external command to the run
+func (r *Run) SetCommand(command *Command) {
+	if r == nil || command == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.command = command
+}
+
+// AddPages attaches the timing of pages loaded by the run
+func (r *Run) AddPages(pages ...PageTiming) {
+	if r == nil || len(pages) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pages = append(r.pages, pages...)
+}
+
+// Pages returns the timing of the pages loaded by the run
+func (r *Run) Pages() []PageTiming {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]PageTiming(nil), r.pages...)
+}
+
+// Finish stores the run. Runs that were not marked as failed are stored as processed.
+// Only the first call has an effect.
+func (r *Run) Finish() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if r.finished {
+		r.mu.Unlock()
+		return
+	}
+	r.finished = true
+	status, err, command, pages := r.status, r.err, r.command, r.pages
+	r.mu.Unlock()
+
+	if r.app == nil || r.recordID == "" {
+		return
+	}
+	if status == "" {
+		status = pool.StatusProcessed
+	}
+
+	finishedAt := time.Now()
+	metrics.JobsTotal.Inc(r.stage, status)
+	metrics.JobDuration.Observe(finishedAt.Sub(r.startedAt).Seconds(), r.stage)
+
+	collection, findErr := r.app.FindCollectionByNameOrId(CollectionName)
+	if findErr != nil {
+		logger.Error("Failed to find job runs collection: %v", findErr)
+		return
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("stage", r.stage)
+	record.Set("record_collection", r.collection)
+	record.Set("record_id", r.recordID)
+	record.Set("url", r.url)
+	record.Set("worker_id", r.workerID)
+	record.Set("started_at", r.startedAt)
+	record.Set("finished_at", finishedAt)
+	record.Set("duration_ms", finishedAt.Sub(r.startedAt).Milliseconds())
+	record.Set("status", status)
+	if err != nil {
+		message := err.Error()
+		if len(message) > maxErrorSize {
+			message = message[:maxErrorSize]
+		}
+		record.Set("error", message)
+	}
+	if command != nil {
+		record.Set("binary", command.Binary)
+		record.Set("binary_version", command.Version)
+		record.Set("binary_checksum", command.Checksum)
+		record.Set("exit_code", command.ExitCode)
+		record.Set("stdout_size", command.StdoutSize)
+		record.Set("stderr_size", command.StderrSize)
+	}
+	if len(pages) > 0 {
+		record.Set("pages", pages)
+	}
+
+	if saveErr := r.app.Save(record); saveErr != nil {
+		logger.Error("Failed to save %s job run for %s: %v", r.stage, r.recordID, saveErr)
+	}
+}
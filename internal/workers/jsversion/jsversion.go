@@ -0,0 +1,30 @@
+package jsversion
+
+import (
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/versioning"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CollectionName is the name of the collection storing the content history of script URLs
+const CollectionName = "js_file_versions"
+
+// Observe records that the script at url was served with the content of the given hash,
+// stored in the js_file record jsFileID, as a version of the URL
+func Observe(app core.App, url string, contentHash string, jsFileID string) {
+	if app == nil || url == "" || contentHash == "" {
+		return
+	}
+
+	err := versioning.Observe(app, CollectionName, dbx.HashExp{"url": url}, contentHash, map[string]any{"js_file": jsFileID})
+	if err != nil {
+		logger.Error("Failed to record version of %s with hash %s: %v", url, contentHash, err)
+	}
+}
+
+// List returns the versions of a URL, newest first
+func List(app core.App, url string) ([]*core.Record, error) {
+	return app.FindRecordsByFilter(CollectionName, "url = {:url}", "-version", 0, 0, dbx.Params{"url": url})
+}
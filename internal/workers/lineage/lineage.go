@@ -0,0 +1,169 @@
+package lineage
+
+import (
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/hash"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	urlutils "github.com/jsh-team/jshunter/internal/utils/url"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Similarity thresholds of the fuzzy hashes
+const (
+	// A script whose URL matches the pattern of an earlier one needs only a loose match
+	patternThreshold = 0.75
+	// A renamed script on the same host needs a close match
+	hostThreshold = 0.90
+)
+
+// Number of earlier scripts compared when looking for the previous build
+const (
+	patternCandidates = 20
+	hostCandidates    = 200
+)
+
+// Assign sets the URL pattern, fuzzy hash, lineage and previous version of a js_file
+// record about to be created with the given content. The previous version is, in order:
+// the latest script with the same URL, the closest script with the same URL pattern, or
+// a very close script on the same host. Without one, the record starts a new lineage.
+func Assign(app core.App, record *core.Record, content string) {
+	scriptURL := record.GetString("url")
+	pattern := urlutils.URLPattern(scriptURL)
+	fuzzyHash := hash.GenerateFuzzyHash(content)
+
+	record.Set("url_pattern", pattern)
+	record.Set("fuzzy_hash", fuzzyHash)
+
+	previous := findPrevious(app, record, scriptURL, pattern, fuzzyHash)
+	if previous == nil {
+		record.Set("lineage_id", core.GenerateDefaultRandomId())
+		return
+	}
+
+	lineageID := previous.GetString("lineage_id")
+	if lineageID == "" {
+		lineageID = core.GenerateDefaultRandomId()
+	}
+	record.Set("lineage_id", lineageID)
+	record.Set("previous_version", previous.Id)
+}
+
+// findPrevious returns the earlier build of the script, or nil
+func findPrevious(app core.App, record *core.Record, scriptURL string, pattern string, fuzzyHash string) *core.Record {
+	// Only scripts stored before this one can be its previous build
+	before := record.GetDateTime("created_at")
+	if before.IsZero() {
+		before = types.NowDateTime()
+	}
+	earlier := dbx.And(
+		dbx.Not(dbx.HashExp{"id": record.Id}),
+		dbx.NewExp("created_at <= {:before}", dbx.Params{"before": before.String()}),
+	)
+
+	// Same URL: new content of the same script
+	sameURL := []*core.Record{}
+	err := app.RecordQuery("js_files").
+		AndWhere(dbx.HashExp{"url": scriptURL}).
+		AndWhere(earlier).
+		OrderBy("created_at DESC").
+		Limit(1).
+		All(&sameURL)
+	if err == nil && len(sameURL) > 0 {
+		return sameURL[0]
+	}
+
+	if fuzzyHash == "" {
+		return nil
+	}
+
+	// Same URL pattern: the bundle was renamed by its content hash
+	candidates := []*core.Record{}
+	err = app.RecordQuery("js_files").
+		AndWhere(dbx.HashExp{"url_pattern": pattern}).
+		AndWhere(earlier).
+		OrderBy("created_at DESC").
+		Limit(patternCandidates).
+		All(&candidates)
+	if err == nil {
+		if best := closest(candidates, fuzzyHash, patternThreshold); best != nil {
+			return best
+		}
+	}
+
+	// Same host: the bundle was renamed some other way
+	parsedURL, err := url.Parse(scriptURL)
+	if err != nil || parsedURL.Host == "" {
+		return nil
+	}
+	hostPrefix := urlutils.URLPattern(parsedURL.Scheme + "://" + parsedURL.Host + "/")
+	candidates = []*core.Record{}
+	err = app.RecordQuery("js_files").
+		AndWhere(dbx.Like("url_pattern", hostPrefix).Match(false, true)).
+		AndWhere(dbx.HashExp{"type": record.GetString("type")}).
+		AndWhere(dbx.NewExp("fuzzy_hash != ''")).
+		AndWhere(earlier).
+		OrderBy("created_at DESC").
+		Limit(hostCandidates).
+		All(&candidates)
+	if err != nil {
+		return nil
+	}
+	return closest(candidates, fuzzyHash, hostThreshold)
+}
+
+// closest returns the candidate whose fuzzy hash is the most similar, if it reaches the threshold
+func closest(candidates []*core.Record, fuzzyHash string, threshold float64) *core.Record {
+	var best *core.Record
+	bestSimilarity := threshold
+	for _, candidate := range candidates {
+		if similarity := hash.FuzzySimilarity(fuzzyHash, candidate.GetString("fuzzy_hash")); similarity >= bestSimilarity {
+			best = candidate
+			bestSimilarity = similarity
+		}
+	}
+	return best
+}
+
+// Backfill assigns a lineage to the js_files stored before lineages were tracked,
+// oldest first so every script can link to the builds that came before it
+func Backfill(app core.App) {
+	records, err := app.FindRecordsByFilter("js_files", "lineage_id = '' && hash != ''", "created_at", 0, 0)
+	if err != nil {
+		logger.Error("Failed to find js_files without lineage: %v", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	startTime := time.Now()
+	assigned := 0
+	for _, record := range records {
+		filePath, err := storage.GetJSFilePath(record.GetString("url"), record.GetString("hash"))
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+
+		Assign(app, record, string(content))
+
+		// Skip hooks: the lineage must not re-trigger any stage
+		if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+			logger.Error("Failed to save lineage of %s: %v", record.GetString("url"), err)
+			continue
+		}
+		assigned++
+	}
+
+	logger.Info("Assigned a lineage to %d of %d js_files in %v", assigned, len(records), time.Since(startTime))
+}
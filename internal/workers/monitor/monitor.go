@@ -0,0 +1,403 @@
+package monitor
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/events"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Collections of the monitor
+const (
+	CollectionName        = "monitors"
+	ChangesCollectionName = "changes"
+)
+
+// States of a monitor
+const (
+	StateIdle     = "idle"     // Waiting for its next check
+	StateChecking = "checking" // Endpoint sent back through the pipeline, waiting for it to settle
+)
+
+// jobID is the cron job checking the monitors every minute
+const jobID = "jshunter_monitor"
+
+// settleTimeout is how long a check waits for the pipeline before comparing what it has
+const settleTimeout = 6 * time.Hour
+
+// maxChunkDepth bounds how many levels of chunks below the scripts of an endpoint are compared
+const maxChunkDepth = 5
+
+// ErrChecking is returned when a check is requested while the previous one is still waiting
+var ErrChecking = errors.New("monitor is already checking its endpoint")
+
+// ticking makes sure a slow tick is never overlapped by the next one
+var ticking sync.Mutex
+
+// Script is a script of an endpoint in a snapshot
+type Script struct {
+	ID   string `json:"id"`
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// Finding is a distinct finding of a change
+type Finding struct {
+	Fingerprint string `json:"fingerprint"`
+	Category    string `json:"category"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+}
+
+// Snapshot is the state of an endpoint at the end of a check
+type Snapshot struct {
+	TakenAt  time.Time `json:"taken_at"`
+	Scripts  []Script  `json:"scripts"`
+	Findings []string  `json:"findings"` // Fingerprints
+}
+
+// Validate checks the settings of a monitor
+func Validate(record *core.Record) error {
+	if record.GetInt("interval") < 1 {
+		return errors.New("interval must be at least 1 minute")
+	}
+	return nil
+}
+
+// Baseline sets the first snapshot of a monitor about to be created, when its endpoint
+// is not in the pipeline; otherwise the first check takes it
+func Baseline(app core.App, record *core.Record) {
+	endpoint, err := app.FindRecordById("endpoints", record.GetString("endpoint"))
+	if err != nil || !Settled(app, endpoint) {
+		return
+	}
+	snapshot, err := Take(app, endpoint)
+	if err != nil {
+		logger.Error("Failed to take the first snapshot of %s: %v", endpoint.GetString("url"), err)
+		return
+	}
+	record.Set("snapshot", snapshot)
+	record.Set("last_compared_at", snapshot.TakenAt)
+}
+
+// Start registers the cron job checking the monitors
+func Start(app *pocketbase.PocketBase) error {
+	return app.Cron().Add(jobID, "* * * * *", func() {
+		Tick(app)
+	})
+}
+
+// Tick checks every enabled monitor: endpoints due for a check are sent back through the
+// pipeline, and endpoints whose check settled are compared with their last snapshot
+func Tick(app *pocketbase.PocketBase) {
+	if !ticking.TryLock() {
+		return
+	}
+	defer ticking.Unlock()
+
+	monitors, err := app.FindRecordsByFilter(CollectionName, "enabled = true", "", 0, 0)
+	if err != nil {
+		logger.Error("Failed to load monitors: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, record := range monitors {
+		endpoint, err := app.FindRecordById("endpoints", record.GetString("endpoint"))
+		if err != nil {
+			continue
+		}
+
+		switch record.GetString("state") {
+		case StateChecking:
+			waited := now.Sub(record.GetDateTime("last_check_at").Time())
+			if !Settled(app, endpoint) && waited < settleTimeout {
+				continue
+			}
+			if _, err := Compare(app, record, endpoint); err != nil {
+				logger.Error("Failed to compare monitored endpoint %s: %v", endpoint.GetString("url"), err)
+			}
+		default:
+			interval := time.Duration(record.GetInt("interval")) * time.Minute
+			if last := record.GetDateTime("last_check_at"); !last.IsZero() && now.Sub(last.Time()) < interval {
+				continue
+			}
+			if err := check(app, record, endpoint); err != nil {
+				logger.Error("Failed to check monitored endpoint %s: %v", endpoint.GetString("url"), err)
+			}
+		}
+	}
+}
+
+// Check sends the endpoint of a monitor back through the pipeline now, without waiting
+// for its interval
+func Check(app *pocketbase.PocketBase, record *core.Record) error {
+	if record.GetString("state") == StateChecking {
+		return ErrChecking
+	}
+	endpoint, err := app.FindRecordById("endpoints", record.GetString("endpoint"))
+	if err != nil {
+		return fmt.Errorf("endpoint not found: %w", err)
+	}
+	return check(app, record, endpoint)
+}
+
+// check re-extracts the endpoint and marks the monitor as waiting for the pipeline. An
+// endpoint still in the pipeline is not restarted: the monitor waits for the current run.
+func check(app *pocketbase.PocketBase, record *core.Record, endpoint *core.Record) error {
+	if !pipeline.InFlight(endpoint) {
+		if err := pipeline.Restart(app, endpoint, pool.RecordPriority(endpoint)); err != nil {
+			return err
+		}
+	}
+
+	record.Set("state", StateChecking)
+	record.Set("last_check_at", time.Now())
+	return save(app, record)
+}
+
+// Compare takes a snapshot of the endpoint of a monitor and stores the differences with the
+// previous one in the changes collection. It returns the change, or nil when nothing
+// changed or the monitor had no snapshot yet.
+func Compare(app *pocketbase.PocketBase, record *core.Record, endpoint *core.Record) (*core.Record, error) {
+	current, err := Take(app, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *Snapshot
+	if err := record.UnmarshalJSONField("snapshot", &previous); err != nil {
+		previous = nil
+	}
+
+	record.Set("state", StateIdle)
+	record.Set("snapshot", current)
+	record.Set("last_compared_at", current.TakenAt)
+
+	// The first snapshot is the baseline of the next checks
+	if previous == nil {
+		return nil, save(app, record)
+	}
+
+	newScripts := scriptsOnlyIn(current.Scripts, previous.Scripts)
+	removedScripts := scriptsOnlyIn(previous.Scripts, current.Scripts)
+	newFindings, err := loadFindings(app, fingerprintsOnlyIn(current.Findings, previous.Findings))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(newScripts) == 0 && len(removedScripts) == 0 && len(newFindings) == 0 {
+		return nil, save(app, record)
+	}
+
+	collection, err := app.FindCollectionByNameOrId(ChangesCollectionName)
+	if err != nil {
+		return nil, err
+	}
+	change := core.NewRecord(collection)
+	change.Set("monitor", record.Id)
+	change.Set("endpoint", endpoint.Id)
+	change.Set("url", endpoint.GetString("url"))
+	change.Set("detected_at", current.TakenAt)
+	change.Set("new_scripts", newScripts)
+	change.Set("removed_scripts", removedScripts)
+	change.Set("new_findings", newFindings)
+	if err := app.Save(change); err != nil {
+		return nil, err
+	}
+
+	if err := save(app, record); err != nil {
+		return nil, err
+	}
+
+	events.Publish(events.Event{
+		Type:       events.ChangeDetected,
+		Collection: ChangesCollectionName,
+		RecordID:   change.Id,
+		URL:        endpoint.GetString("url"),
+		Data: map[string]any{
+			"monitor":         record.Id,
+			"endpoint":        endpoint.Id,
+			"new_scripts":     len(newScripts),
+			"removed_scripts": len(removedScripts),
+			"new_findings":    len(newFindings),
+		},
+	})
+	logger.Info("Change detected on %s: %d new scripts, %d removed scripts, %d new findings",
+		endpoint.GetString("url"), len(newScripts), len(removedScripts), len(newFindings))
+
+	return change, nil
+}
+
+// Take returns the current scripts of an endpoint, with their chunks, and the fingerprints
+// of their findings
+func Take(app core.App, endpoint *core.Record) (Snapshot, error) {
+	snapshot := Snapshot{TakenAt: time.Now(), Scripts: []Script{}, Findings: []string{}}
+
+	jsFiles, err := Scripts(app, endpoint)
+	if err != nil {
+		return snapshot, err
+	}
+	if len(jsFiles) == 0 {
+		return snapshot, nil
+	}
+
+	ids := make([]any, 0, len(jsFiles))
+	for _, jsFile := range jsFiles {
+		ids = append(ids, jsFile.Id)
+		snapshot.Scripts = append(snapshot.Scripts, Script{
+			ID:   jsFile.Id,
+			URL:  jsFile.GetString("url"),
+			Hash: jsFile.GetString("hash"),
+		})
+	}
+
+	var fingerprints []string
+	err = app.DB().Select("fingerprint").Distinct(true).
+		From("findings").
+		Where(dbx.In("js_file", ids...)).
+		AndWhere(dbx.NewExp("fingerprint != ''")).
+		Column(&fingerprints)
+	if err != nil {
+		return snapshot, err
+	}
+	slices.Sort(fingerprints)
+	snapshot.Findings = append(snapshot.Findings, fingerprints...)
+
+	slices.SortFunc(snapshot.Scripts, func(a, b Script) int {
+		return cmp.Or(strings.Compare(a.URL, b.URL), strings.Compare(a.Hash, b.Hash))
+	})
+	return snapshot, nil
+}
+
+// Scripts returns the js_files of an endpoint and the chunks found in them
+func Scripts(app core.App, endpoint *core.Record) ([]*core.Record, error) {
+	ids := endpoint.GetStringSlice("js_files")
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	jsFiles, err := app.FindRecordsByIds("js_files", ids)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(jsFiles))
+	for _, jsFile := range jsFiles {
+		seen[jsFile.Id] = true
+	}
+
+	level := jsFiles
+	for depth := 0; depth < maxChunkDepth && len(level) > 0; depth++ {
+		parentIDs := make([]any, 0, len(level))
+		for _, jsFile := range level {
+			parentIDs = append(parentIDs, jsFile.Id)
+		}
+		chunks, err := app.FindAllRecords("js_files", dbx.In("parent_id", parentIDs...))
+		if err != nil {
+			return nil, err
+		}
+
+		level = nil
+		for _, chunk := range chunks {
+			if seen[chunk.Id] {
+				continue
+			}
+			seen[chunk.Id] = true
+			level = append(level, chunk)
+			jsFiles = append(jsFiles, chunk)
+		}
+	}
+	return jsFiles, nil
+}
+
+// Settled reports whether the endpoint and all its scripts went through the pipeline. Failed
+// and timed out stages are finished, as are the stages waiting on them, which never run.
+func Settled(app core.App, endpoint *core.Record) bool {
+	if pipeline.InFlight(endpoint) {
+		return false
+	}
+	jsFiles, err := Scripts(app, endpoint)
+	if err != nil {
+		return false
+	}
+	for _, jsFile := range jsFiles {
+		if pipeline.InFlight(jsFile) {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptsOnlyIn returns the scripts of a whose URL and hash are not in b
+func scriptsOnlyIn(a []Script, b []Script) []Script {
+	known := make(map[Script]bool, len(b))
+	for _, script := range b {
+		known[Script{URL: script.URL, Hash: script.Hash}] = true
+	}
+	only := []Script{}
+	for _, script := range a {
+		if !known[Script{URL: script.URL, Hash: script.Hash}] {
+			only = append(only, script)
+		}
+	}
+	return only
+}
+
+// fingerprintsOnlyIn returns the fingerprints of a not in b
+func fingerprintsOnlyIn(a []string, b []string) []string {
+	known := make(map[string]bool, len(b))
+	for _, fingerprint := range b {
+		known[fingerprint] = true
+	}
+	var only []string
+	for _, fingerprint := range a {
+		if !known[fingerprint] {
+			only = append(only, fingerprint)
+		}
+	}
+	return only
+}
+
+// loadFindings describes the distinct findings with the given fingerprints
+func loadFindings(app core.App, fingerprints []string) ([]Finding, error) {
+	findings := []Finding{}
+	if len(fingerprints) == 0 {
+		return findings, nil
+	}
+
+	values := make([]any, 0, len(fingerprints))
+	for _, value := range fingerprints {
+		values = append(values, value)
+	}
+	records, err := app.FindAllRecords(fingerprint.CollectionName, dbx.In("fingerprint", values...))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		findings = append(findings, Finding{
+			Fingerprint: record.GetString("fingerprint"),
+			Category:    record.GetString("category"),
+			Type:        record.GetString("type"),
+			Value:       record.GetString("value"),
+		})
+	}
+	return findings, nil
+}
+
+// save stores the state of a monitor without hooks, so the tick does not touch updated_at
+func save(app core.App, record *core.Record) error {
+	return app.UnsafeWithoutHooks().Save(record)
+}
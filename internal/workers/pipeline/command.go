@@ -0,0 +1,168 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultCommandTimeout = 300 * time.Second
+	defaultCommandWorkers = 2
+	maxCommandOutput      = 64 * 1024 // Bytes of stdout kept in the output field
+)
+
+// CommandJob represents a custom stage command to run on a record
+type CommandJob struct {
+	App    *pocketbase.PocketBase
+	Record *core.Record
+	Stage  *Stage
+}
+
+// CommandWorkerPool runs the commands of the custom stages sharing a pool name
+type CommandWorkerPool struct {
+	*pool.Pool[CommandJob]
+}
+
+var (
+	commandPoolsMu sync.Mutex
+	commandPools   = make(map[string]*CommandWorkerPool)
+)
+
+// commandPoolFor returns the running pool of a custom stage, creating and starting it on first use
+func commandPoolFor(stage *Stage) *CommandWorkerPool {
+	commandPoolsMu.Lock()
+	defer commandPoolsMu.Unlock()
+
+	if p, ok := commandPools[stage.Pool]; ok {
+		return p
+	}
+
+	workers := stage.Workers
+	if workers < 1 {
+		workers = defaultCommandWorkers
+	}
+
+	p := &CommandWorkerPool{}
+	p.Pool = pool.New(stage.Pool, workers, config.PrettifyQueueSize, p.processJob)
+	p.KeyFunc(func(job CommandJob) string {
+		return job.Record.Id
+	})
+	p.OnDrain(func(job CommandJob) {
+		pool.ResetStatus(job.App, job.Record, job.Stage.StatusField)
+	})
+	p.SetTimeout(stage.timeout())
+	if err := p.Start(); err != nil {
+		logger.Error("Failed to start %s worker pool: %v", stage.Pool, err)
+	}
+	pool.Register(p)
+
+	commandPools[stage.Pool] = p
+	return p
+}
+
+// submitter returns the SubmitFunc queueing the command of the given custom stage
+func (p *CommandWorkerPool) submitter(stage *Stage) SubmitFunc {
+	return func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+		return p.SubmitJob(CommandJob{App: app, Record: record, Stage: stage}, priority)
+	}
+}
+
+// recordFilePath returns the stored file of an endpoint or JavaScript file record
+func recordFilePath(record *core.Record) (string, error) {
+	if record.Collection().Name == "endpoints" {
+		return storage.GetHTMLFilePath(record.GetString("url"), record.GetString("hash"))
+	}
+	return storage.GetJSFilePath(record.GetString("url"), record.GetString("hash"))
+}
+
+// commandArgs replaces the placeholders of the stage command for a record
+func commandArgs(command []string, record *core.Record, filePath string) []string {
+	replacer := strings.NewReplacer(
+		"{file}", filePath,
+		"{url}", record.GetString("url"),
+		"{id}", record.Id,
+		"{collection}", record.Collection().Name,
+	)
+
+	args := make([]string, len(command))
+	for i, arg := range command {
+		args[i] = replacer.Replace(arg)
+	}
+	return args
+}
+
+// processJob runs the stage command on the stored file of the record
+func (p *CommandWorkerPool) processJob(ctx context.Context, workerID int, job CommandJob) {
+	startTime := time.Now()
+	stage := job.Stage
+
+	run := jobrun.Start(job.App, stage.Name, job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+	log := run.Logger()
+
+	filePath, err := recordFilePath(job.Record)
+	if err != nil {
+		log.Error("%s Worker %d failed to resolve file of %s: %v", stage.Name, workerID, job.Record.GetString("url"), err)
+		markFailed(ctx, job, "", err)
+		return
+	}
+
+	args := commandArgs(stage.Command, job.Record, filePath)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := jobrun.Output(ctx, cmd)
+	if ctx.Err() != nil {
+		err = fmt.Errorf("%s command interrupted: %w", stage.Name, ctx.Err())
+	}
+	if err != nil {
+		log.Error("%s Worker %d failed on %s: %v", stage.Name, workerID, job.Record.GetString("url"), err)
+		markFailed(ctx, job, filePath, err)
+		return
+	}
+
+	if len(output) > maxCommandOutput {
+		output = output[:maxCommandOutput]
+	}
+	job.Record.Set(stage.OutputField(), strings.ToValidUTF8(string(output), ""))
+	job.Record.Set(stage.StatusField, pool.StatusProcessed)
+	if err := job.App.Save(job.Record); err != nil {
+		log.Error("%s Worker %d failed to save results for %s: %v", stage.Name, workerID, job.Record.GetString("url"), err)
+	}
+
+	log.Debug("%s worker finished %s in %v", stage.Name, job.Record.GetString("url"), time.Since(startTime))
+}
+
+// markFailed sets the failure status of the custom stage and stores the job in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job CommandJob, inputPath string, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	job.Record.Set(job.Stage.StatusField, status)
+	job.App.Save(job.Record)
+	if status == pool.StatusPending {
+		return
+	}
+
+	deadletter.Record(job.App, deadletter.Entry{
+		Stage:      job.Stage.Name,
+		Collection: job.Record.Collection().Name,
+		RecordID:   job.Record.Id,
+		URL:        job.Record.GetString("url"),
+		InputPath:  inputPath,
+		Err:        err,
+	})
+}
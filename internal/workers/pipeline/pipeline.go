@@ -0,0 +1,439 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// SubmitFunc queues the job of a stage for a record in the lane of the given priority
+type SubmitFunc func(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error
+
+// Stage is a validated pipeline stage ready to receive records
+type Stage struct {
+	config.StageConfig
+	StatusField string `json:"status_field"`
+	Custom      bool   `json:"custom"`
+
+	submit SubmitFunc
+}
+
+// builtinStage is a stage implemented in Go by one of the worker packages
+type builtinStage struct {
+	pool   string
+	submit SubmitFunc
+}
+
+var (
+	mu       sync.RWMutex
+	builtins = make(map[string]builtinStage)
+	stages   []*Stage
+)
+
+// Collections whose records have a stored file the stages can work on
+var stageCollections = []string{"endpoints", "js_files"}
+
+func stageKey(collection string, name string) string {
+	return collection + "/" + name
+}
+
+// RegisterBuiltin makes a stage implemented in Go available to the pipeline configuration
+func RegisterBuiltin(collection string, name string, poolName string, submit SubmitFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	builtins[stageKey(collection, name)] = builtinStage{pool: poolName, submit: submit}
+}
+
+// Load validates the stage graph and makes it the active pipeline.
+// Custom stages get their command worker pools created and started.
+func Load(configs []config.StageConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	builtinPools := make(map[string]bool)
+	for _, builtin := range builtins {
+		builtinPools[builtin.pool] = true
+	}
+
+	loaded := make([]*Stage, 0, len(configs))
+	byKey := make(map[string]*Stage)
+	for _, stageConfig := range configs {
+		if stageConfig.Name == "" {
+			return fmt.Errorf("pipeline stage without name")
+		}
+		if !slices.Contains(stageCollections, stageConfig.Collection) {
+			return fmt.Errorf("stage %q: collection must be one of %s", stageConfig.Name, strings.Join(stageCollections, ", "))
+		}
+
+		key := stageKey(stageConfig.Collection, stageConfig.Name)
+		if _, exists := byKey[key]; exists {
+			return fmt.Errorf("stage %q is defined twice for %s", stageConfig.Name, stageConfig.Collection)
+		}
+
+		if stageConfig.Trigger == "" {
+			stageConfig.Trigger = pool.StatusProcessed
+		}
+		if !slices.Contains(pool.StatusValues, stageConfig.Trigger) {
+			return fmt.Errorf("stage %q: unknown trigger status %q", stageConfig.Name, stageConfig.Trigger)
+		}
+
+		stage := &Stage{
+			StageConfig: stageConfig,
+			StatusField: stageConfig.Name + "_status",
+		}
+
+		if builtin, ok := builtins[key]; ok {
+			if len(stageConfig.Command) > 0 {
+				return fmt.Errorf("stage %q is built in and cannot run a command", stageConfig.Name)
+			}
+			if stageConfig.Pool != "" && stageConfig.Pool != builtin.pool {
+				return fmt.Errorf("stage %q always runs on the %s pool", stageConfig.Name, builtin.pool)
+			}
+			stage.Pool = builtin.pool
+			stage.submit = builtin.submit
+		} else {
+			if len(stageConfig.Command) == 0 {
+				return fmt.Errorf("unknown stage %q for %s: set a command to define a custom stage", stageConfig.Name, stageConfig.Collection)
+			}
+			if stage.Pool == "" {
+				stage.Pool = stageConfig.Name
+			}
+			if builtinPools[stage.Pool] {
+				return fmt.Errorf("stage %q cannot use the built-in %s pool", stageConfig.Name, stage.Pool)
+			}
+			stage.Custom = true
+		}
+
+		loaded = append(loaded, stage)
+		byKey[key] = stage
+	}
+
+	for _, stage := range loaded {
+		for _, dependency := range stage.DependsOn {
+			if _, ok := byKey[stageKey(stage.Collection, dependency)]; !ok {
+				return fmt.Errorf("stage %q depends on unknown stage %q of %s", stage.Name, dependency, stage.Collection)
+			}
+		}
+	}
+	if err := checkCycles(loaded, byKey); err != nil {
+		return err
+	}
+
+	for _, stage := range loaded {
+		if stage.Custom {
+			stage.submit = commandPoolFor(stage).submitter(stage)
+		}
+	}
+
+	stages = loaded
+	return nil
+}
+
+// checkCycles makes sure the dependencies form a DAG
+func checkCycles(loaded []*Stage, byKey map[string]*Stage) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[*Stage]int)
+
+	var visit func(stage *Stage, path []string) error
+	visit = func(stage *Stage, path []string) error {
+		path = append(path, stage.Name)
+		switch state[stage] {
+		case visiting:
+			return fmt.Errorf("pipeline cycle in %s: %s", stage.Collection, strings.Join(path, " -> "))
+		case done:
+			return nil
+		}
+
+		state[stage] = visiting
+		for _, dependency := range stage.DependsOn {
+			if err := visit(byKey[stageKey(stage.Collection, dependency)], path); err != nil {
+				return err
+			}
+		}
+		state[stage] = done
+		return nil
+	}
+
+	for _, stage := range loaded {
+		if err := visit(stage, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stages returns the active pipeline in configuration order
+func Stages() []*Stage {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	result := make([]*Stage, len(stages))
+	copy(result, stages)
+	return result
+}
+
+// Find returns the active stage with the given name for a collection
+func Find(collection string, name string) (*Stage, error) {
+	for _, stage := range Stages() {
+		if stage.Collection == collection && stage.Name == name {
+			return stage, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown stage %q for %s", name, collection)
+}
+
+// stagesFor returns the active stages of a collection
+func stagesFor(collection string) []*Stage {
+	var result []*Stage
+	for _, stage := range Stages() {
+		if stage.Collection == collection {
+			result = append(result, stage)
+		}
+	}
+	return result
+}
+
+// Submit queues the stage job for a record. The caller is responsible for the status field.
+func (s *Stage) Submit(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+	return s.submit(app, record, priority)
+}
+
+// dependenciesMet reports whether every dependency of the stage reached the trigger status.
+// Disabled dependencies are always met.
+func (s *Stage) dependenciesMet(record *core.Record, siblings []*Stage) bool {
+	for _, dependency := range s.DependsOn {
+		for _, sibling := range siblings {
+			if sibling.Name != dependency || sibling.Disabled {
+				continue
+			}
+			if record.GetString(sibling.StatusField) != s.Trigger {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// blocked reports whether a pending stage can no longer run on the record: one of its
+// dependencies ended in a status other than the trigger, or is blocked itself
+func (s *Stage) blocked(record *core.Record, siblings []*Stage) bool {
+	for _, dependency := range s.DependsOn {
+		for _, sibling := range siblings {
+			if sibling.Name != dependency || sibling.Disabled {
+				continue
+			}
+			switch status := record.GetString(sibling.StatusField); status {
+			case s.Trigger, pool.StatusProcessing:
+			case pool.StatusPending:
+				if sibling.blocked(record, siblings) {
+					return true
+				}
+			default:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Init sets the initial status of every stage on a record about to be created
+func Init(record *core.Record) {
+	recordType := record.GetString("type")
+	for _, stage := range stagesFor(record.Collection().Name) {
+		if slices.Contains(stage.SkipTypes, recordType) {
+			record.Set(stage.StatusField, pool.StatusProcessed)
+			continue
+		}
+		if record.GetString(stage.StatusField) == "" {
+			record.Set(stage.StatusField, pool.StatusPending)
+		}
+	}
+}
+
+// InFlight reports whether a stage of the record is processing, or pending with
+// dependencies that can still be met. Stages left pending behind a failed or timed out
+// dependency never run, so they do not count.
+func InFlight(record *core.Record) bool {
+	siblings := stagesFor(record.Collection().Name)
+	for _, stage := range siblings {
+		if stage.Disabled {
+			continue
+		}
+		switch record.GetString(stage.StatusField) {
+		case pool.StatusProcessing:
+			return true
+		case pool.StatusPending:
+			if !stage.blocked(record, siblings) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Restart puts every stage of an existing record back to its initial status, saves it and
+// queues its first stages in the lane of the given priority, so the record runs through
+// the whole pipeline again
+func Restart(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority) error {
+	recordType := record.GetString("type")
+	for _, stage := range stagesFor(record.Collection().Name) {
+		if slices.Contains(stage.SkipTypes, recordType) {
+			record.Set(stage.StatusField, pool.StatusProcessed)
+		} else {
+			record.Set(stage.StatusField, pool.StatusPending)
+		}
+	}
+	// Saved without hooks so Advance does not queue the stages at the priority of the record
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		return err
+	}
+	advance(app, record, priority, pool.StatusPending)
+	return nil
+}
+
+// Advance queues every stage of the record that is pending and whose dependencies are met.
+// The status change is saved without hooks, so it does not trigger another Advance.
+func Advance(app *pocketbase.PocketBase, record *core.Record) {
+	advance(app, record, pool.RecordPriority(record), pool.StatusPending)
+}
+
+// advance queues the ready stages of a record. Stages in one of the given statuses are candidates.
+func advance(app *pocketbase.PocketBase, record *core.Record, priority pool.Priority, candidates ...string) int {
+	siblings := stagesFor(record.Collection().Name)
+
+	var ready []*Stage
+	for _, stage := range siblings {
+		if stage.Disabled || !slices.Contains(candidates, record.GetString(stage.StatusField)) {
+			continue
+		}
+		if stage.dependenciesMet(record, siblings) {
+			ready = append(ready, stage)
+		}
+	}
+	if len(ready) == 0 {
+		return 0
+	}
+
+	for _, stage := range ready {
+		record.Set(stage.StatusField, pool.StatusProcessing)
+	}
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		logger.Error("Failed to mark %s as processing: %v", record.GetString("url"), err)
+		return 0
+	}
+
+	queued := 0
+	for _, stage := range ready {
+		if err := stage.submit(app, record, priority); err != nil {
+			logger.Error("Failed to queue %s job for %s: %v", stage.Name, record.GetString("url"), err)
+			pool.ResetStatus(app, record, stage.StatusField)
+			continue
+		}
+		queued++
+	}
+	return queued
+}
+
+// Recover queues the stages left pending or processing by a previous run.
+// Recovered jobs go to the background lane so fresh submissions are served first.
+func Recover(app *pocketbase.PocketBase) {
+	for _, collection := range stageCollections {
+		var conditions []dbx.Expression
+		for _, stage := range stagesFor(collection) {
+			if stage.Disabled {
+				continue
+			}
+			conditions = append(conditions, dbx.In(stage.StatusField, pool.StatusPending, pool.StatusProcessing))
+		}
+		if len(conditions) == 0 {
+			continue
+		}
+
+		records, err := app.FindAllRecords(collection, dbx.Or(conditions...))
+		if err != nil {
+			logger.Error("Error finding unfinished %s records: %v", collection, err)
+			continue
+		}
+
+		// Oldest records first, like the original submission order
+		slices.SortStableFunc(records, func(a, b *core.Record) int {
+			return a.GetDateTime("created_at").Time().Compare(b.GetDateTime("created_at").Time())
+		})
+
+		queued := 0
+		for _, record := range records {
+			queued += advance(app, record, pool.PriorityBackground, pool.StatusPending, pool.StatusProcessing)
+		}
+		if queued > 0 {
+			logger.Info("Recovered %d %s jobs", queued, collection)
+		}
+	}
+}
+
+// EnsureFields adds the status field of every stage, and the output field of custom
+// stages, to their collection when it is missing
+func EnsureFields(app core.App) error {
+	for _, collection := range stageCollections {
+		target, err := app.FindCollectionByNameOrId(collection)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for _, stage := range stagesFor(collection) {
+			if target.Fields.GetByName(stage.StatusField) == nil {
+				target.Fields.Add(&core.SelectField{
+					Name:   stage.StatusField,
+					Values: pool.StatusValues,
+					Hidden: true,
+				})
+				changed = true
+			}
+			// Recovery and shutdown look records up by status
+			if indexName := pool.StatusIndexName(collection, stage.StatusField); target.GetIndex(indexName) == "" {
+				target.AddIndex(indexName, false, stage.StatusField, "")
+				changed = true
+			}
+			if stage.Custom && target.Fields.GetByName(stage.OutputField()) == nil {
+				target.Fields.Add(&core.TextField{
+					Name: stage.OutputField(),
+					Max:  maxCommandOutput,
+				})
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := app.Save(target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// OutputField is the field where a custom stage stores the output of its command
+func (s *Stage) OutputField() string {
+	return s.Name + "_output"
+}
+
+// timeout returns the per-job timeout of a custom stage
+func (s *Stage) timeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return defaultCommandTimeout
+}
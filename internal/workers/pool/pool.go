@@ -0,0 +1,480 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Handler processes a single job on the given worker. The context is cancelled
+// when the job exceeds the pool timeout or the pool is stopped.
+type Handler[J any] func(ctx context.Context, workerID int, job J)
+
+// Stats is a snapshot of the pool state
+type Stats struct {
+	Name      string         `json:"name"`
+	Running   bool           `json:"running"`
+	Paused    bool           `json:"paused"`
+	Workers   int            `json:"workers"`
+	Active    int            `json:"active"`
+	Queued    int            `json:"queued"`
+	Lanes     map[string]int `json:"lanes"`
+	Capacity  int            `json:"capacity"`
+	Processed uint64         `json:"processed"`
+	Timeout   string         `json:"timeout"`
+}
+
+// queuedJob is a job waiting in one of the priority lanes
+type queuedJob[J any] struct {
+	job J
+}
+
+// Pool is a bounded job queue served by a resizable set of workers.
+// Jobs are kept in priority lanes; workers always take the oldest job of the
+// highest non-empty lane. It can be paused and resumed at runtime without
+// losing queued jobs.
+type Pool[J any] struct {
+	name     string
+	handler  Handler[J]
+	onDrain  func(job J)
+	keyOf    func(job J) string
+	capacity int
+	timeout  time.Duration
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	cond      *sync.Cond
+	lanes     [numPriorities][]queuedJob[J]
+	queued    int
+	workers   int // Desired number of workers
+	live      int // Number of worker goroutines currently alive
+	retiring  int // Number of workers asked to exit after a shrink
+	nextID    int
+	active    int
+	processed uint64
+	paused    bool
+	isRunning bool
+	stopping  bool
+	workerWg  sync.WaitGroup
+}
+
+// New creates a new pool. The pool does nothing until Start is called.
+func New[J any](name string, maxWorkers int, queueSize int, handler Handler[J]) *Pool[J] {
+	p := &Pool[J]{
+		name:     name,
+		handler:  handler,
+		capacity: queueSize,
+		workers:  maxWorkers,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// OnDrain sets a callback invoked for every queued job removed by Drain
+func (p *Pool[J]) OnDrain(fn func(job J)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onDrain = fn
+}
+
+// SetTimeout sets the maximum duration of a single job. Zero disables the timeout.
+func (p *Pool[J]) SetTimeout(timeout time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeout = timeout
+}
+
+// KeyFunc sets how jobs are identified when their priority is changed with SetPriority
+func (p *Pool[J]) KeyFunc(fn func(job J) string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyOf = fn
+}
+
+// Name returns the stage name of the pool
+func (p *Pool[J]) Name() string {
+	return p.name
+}
+
+// Start initializes and starts the worker goroutines
+func (p *Pool[J]) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.isRunning {
+		return fmt.Errorf("%s worker pool is already running", p.name)
+	}
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.stopping = false
+	p.retiring = 0
+	for i := 0; i < p.workers; i++ {
+		p.spawnLocked()
+	}
+
+	p.isRunning = true
+	return nil
+}
+
+// Stop shuts down the pool. In-flight jobs have their context cancelled and
+// jobs still waiting in the queue are discarded.
+func (p *Pool[J]) Stop() error {
+	p.mu.Lock()
+	if !p.isRunning {
+		p.mu.Unlock()
+		return nil
+	}
+
+	// Cancel context to signal in-flight jobs to stop
+	p.cancel()
+
+	p.stopping = true
+	p.clearLocked()
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	// Wait for all workers to finish
+	p.workerWg.Wait()
+
+	p.mu.Lock()
+	p.isRunning = false
+	p.mu.Unlock()
+	return nil
+}
+
+// Shutdown stops accepting jobs, hands every queued job to the OnDrain callback and
+// waits up to timeout for in-flight jobs to finish. Jobs still running after the
+// deadline have their context cancelled. It returns false when jobs had to be cancelled.
+func (p *Pool[J]) Shutdown(timeout time.Duration) bool {
+	p.mu.Lock()
+	if !p.isRunning || p.stopping {
+		p.mu.Unlock()
+		return true
+	}
+
+	var drained []J
+	for _, lane := range p.lanes {
+		for _, item := range lane {
+			drained = append(drained, item.job)
+		}
+	}
+	p.stopping = true
+	p.clearLocked()
+	p.cond.Broadcast()
+	onDrain := p.onDrain
+	p.mu.Unlock()
+
+	if onDrain != nil {
+		for _, job := range drained {
+			onDrain(job)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.workerWg.Wait()
+		close(done)
+	}()
+
+	graceful := true
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		graceful = false
+		p.cancel()
+		<-done
+	}
+	p.cancel()
+
+	p.mu.Lock()
+	p.isRunning = false
+	p.mu.Unlock()
+	return graceful
+}
+
+// SubmitJob adds a job to the lane of the given priority
+func (p *Pool[J]) SubmitJob(job J, priority Priority) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isRunning || p.stopping {
+		return fmt.Errorf("%s worker pool is not running", p.name)
+	}
+
+	if p.queued >= p.capacity {
+		return fmt.Errorf("%s job queue is full", p.name)
+	}
+
+	p.pushLocked(job, priority)
+	p.cond.Signal()
+	return nil
+}
+
+// SubmitJobs adds several jobs at once, failing without queueing anything if they do not fit
+func (p *Pool[J]) SubmitJobs(jobs []J, priority Priority) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isRunning || p.stopping {
+		return fmt.Errorf("%s worker pool is not running", p.name)
+	}
+
+	availableSpace := p.capacity - p.queued
+	if len(jobs) > availableSpace {
+		return fmt.Errorf("not enough space in %s queue: need %d slots, have %d available", p.name, len(jobs), availableSpace)
+	}
+
+	for _, job := range jobs {
+		p.pushLocked(job, priority)
+	}
+	p.cond.Broadcast()
+	return nil
+}
+
+// SetPriority moves every queued job matching key to the lane of the given priority.
+// It returns how many jobs were moved.
+func (p *Pool[J]) SetPriority(key string, priority Priority) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keyOf == nil {
+		return 0
+	}
+
+	var moved []J
+	for lane := range p.lanes {
+		if Priority(lane) == priority {
+			continue
+		}
+		kept := p.lanes[lane][:0]
+		for _, item := range p.lanes[lane] {
+			if p.keyOf(item.job) == key {
+				moved = append(moved, item.job)
+				continue
+			}
+			kept = append(kept, item)
+		}
+		p.lanes[lane] = kept
+	}
+
+	p.queued -= len(moved)
+	for _, job := range moved {
+		p.pushLocked(job, priority)
+	}
+
+	return len(moved)
+}
+
+// Take removes up to max jobs from the queue, highest priority first, so they can be
+// processed outside the pool (remote workers). Paused or stopped pools hand out nothing.
+func (p *Pool[J]) Take(max int) []J {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.isRunning || p.stopping || p.paused {
+		return nil
+	}
+
+	var jobs []J
+	for len(jobs) < max && p.queued > 0 {
+		jobs = append(jobs, p.popLocked())
+	}
+	return jobs
+}
+
+// Pause stops workers from picking up new jobs. In-flight jobs are not interrupted.
+func (p *Pool[J]) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+}
+
+// Resume lets workers pick up jobs again after a Pause
+func (p *Pool[J]) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+	p.cond.Broadcast()
+}
+
+// Resize changes the number of workers. Extra workers exit once their current job is done.
+func (p *Pool[J]) Resize(workers int) error {
+	if workers < 1 {
+		return fmt.Errorf("%s worker pool needs at least one worker", p.name)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.workers = workers
+	if !p.isRunning {
+		return nil
+	}
+
+	// Cancel pending retirements first, then spawn or retire the difference
+	alive := p.live - p.retiring
+	for alive < workers && p.retiring > 0 {
+		p.retiring--
+		alive++
+	}
+	for alive < workers {
+		p.spawnLocked()
+		alive++
+	}
+	if alive > workers {
+		p.retiring += alive - workers
+		p.cond.Broadcast()
+	}
+
+	return nil
+}
+
+// Drain removes every queued job without processing it and returns how many were removed
+func (p *Pool[J]) Drain() int {
+	p.mu.Lock()
+	var drained []J
+	for _, lane := range p.lanes {
+		for _, item := range lane {
+			drained = append(drained, item.job)
+		}
+	}
+	p.clearLocked()
+	onDrain := p.onDrain
+	p.mu.Unlock()
+
+	if onDrain != nil {
+		for _, job := range drained {
+			onDrain(job)
+		}
+	}
+
+	return len(drained)
+}
+
+// GetQueueSize returns the current number of jobs in the queue
+func (p *Pool[J]) GetQueueSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// GetAvailableSpace returns the available space in the queue
+func (p *Pool[J]) GetAvailableSpace() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.capacity - p.queued
+}
+
+// IsRunning returns whether the worker pool is currently running
+func (p *Pool[J]) IsRunning() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.isRunning
+}
+
+// Stats returns a snapshot of the pool state
+func (p *Pool[J]) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	lanes := make(map[string]int, numPriorities)
+	for lane := range p.lanes {
+		lanes[Priority(lane).String()] = len(p.lanes[lane])
+	}
+
+	return Stats{
+		Name:      p.name,
+		Running:   p.isRunning,
+		Paused:    p.paused,
+		Workers:   p.workers,
+		Active:    p.active,
+		Queued:    p.queued,
+		Lanes:     lanes,
+		Capacity:  p.capacity,
+		Processed: p.processed,
+		Timeout:   p.timeout.String(),
+	}
+}
+
+// pushLocked appends a job to its lane. p.mu must be held.
+func (p *Pool[J]) pushLocked(job J, priority Priority) {
+	if priority < 0 || priority >= numPriorities {
+		priority = PriorityNormal
+	}
+	p.lanes[priority] = append(p.lanes[priority], queuedJob[J]{job: job})
+	p.queued++
+}
+
+// popLocked removes the oldest job of the highest non-empty lane. p.mu must be held.
+func (p *Pool[J]) popLocked() J {
+	for lane := range p.lanes {
+		if len(p.lanes[lane]) == 0 {
+			continue
+		}
+		item := p.lanes[lane][0]
+		p.lanes[lane][0] = queuedJob[J]{}
+		p.lanes[lane] = p.lanes[lane][1:]
+		p.queued--
+		return item.job
+	}
+
+	var zero J
+	return zero
+}
+
+// clearLocked empties every lane. p.mu must be held.
+func (p *Pool[J]) clearLocked() {
+	for lane := range p.lanes {
+		p.lanes[lane] = nil
+	}
+	p.queued = 0
+}
+
+// spawnLocked starts a new worker goroutine. p.mu must be held.
+func (p *Pool[J]) spawnLocked() {
+	workerID := p.nextID
+	p.nextID++
+	p.live++
+	p.workerWg.Add(1)
+	go p.worker(workerID)
+}
+
+// worker is the main worker loop that takes jobs from the queue
+func (p *Pool[J]) worker(workerID int) {
+	defer p.workerWg.Done()
+
+	for {
+		p.mu.Lock()
+		for !p.stopping && p.retiring == 0 && (p.paused || p.queued == 0) {
+			p.cond.Wait()
+		}
+
+		if p.stopping || p.retiring > 0 {
+			if p.retiring > 0 && !p.stopping {
+				p.retiring--
+			}
+			p.live--
+			p.mu.Unlock()
+			return
+		}
+
+		job := p.popLocked()
+		p.active++
+		jobCtx, cancel := p.ctx, context.CancelFunc(func() {})
+		if p.timeout > 0 {
+			jobCtx, cancel = context.WithTimeout(p.ctx, p.timeout)
+		}
+		p.mu.Unlock()
+
+		// Process the job
+		p.handler(jobCtx, workerID, job)
+		cancel()
+
+		p.mu.Lock()
+		p.active--
+		p.processed++
+		p.mu.Unlock()
+	}
+}
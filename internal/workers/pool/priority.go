@@ -0,0 +1,62 @@
+package pool
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Priority selects the queue lane a job is placed in. Lower values are served first.
+type Priority int
+
+const (
+	PriorityHigh       Priority = iota // User-submitted endpoints
+	PriorityNormal                     // Scripts loaded directly by an endpoint
+	PriorityLow                        // Chunks discovered by the dechunker
+	PriorityBackground                 // Jobs re-queued by the startup recovery
+	numPriorities
+)
+
+// PriorityValues lists the priority names in lane order, as stored in the "priority" fields
+var PriorityValues = []string{"high", "normal", "low", "background"}
+
+// String returns the name of the priority
+func (p Priority) String() string {
+	if p < 0 || p >= numPriorities {
+		return PriorityValues[PriorityNormal]
+	}
+	return PriorityValues[p]
+}
+
+// Lower returns the next lane down, used for jobs derived from another job
+func (p Priority) Lower() Priority {
+	if p >= PriorityBackground {
+		return PriorityBackground
+	}
+	return p + 1
+}
+
+// ParsePriority converts a priority name into a Priority
+func ParsePriority(name string) (Priority, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, value := range PriorityValues {
+		if value == name {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q, expected one of %s", name, strings.Join(PriorityValues, ", "))
+}
+
+// RecordPriority returns the priority stored on a record, defaulting to normal
+func RecordPriority(record *core.Record) Priority {
+	if record == nil {
+		return PriorityNormal
+	}
+
+	priority, err := ParsePriority(record.GetString("priority"))
+	if err != nil {
+		return PriorityNormal
+	}
+	return priority
+}
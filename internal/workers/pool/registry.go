@@ -0,0 +1,61 @@
+package pool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Controller exposes the runtime controls shared by every stage pool
+type Controller interface {
+	Name() string
+	Pause()
+	Resume()
+	Resize(workers int) error
+	Drain() int
+	SetPriority(key string, priority Priority) int
+	Shutdown(timeout time.Duration) bool
+	Stats() Stats
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Controller
+)
+
+// Register makes a pool available to the runtime controls (API and CLI)
+func Register(controller Controller) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, existing := range registry {
+		if existing.Name() == controller.Name() {
+			registry[i] = controller
+			return
+		}
+	}
+	registry = append(registry, controller)
+}
+
+// Get returns the registered pool for the given stage
+func Get(name string) (Controller, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, controller := range registry {
+		if controller.Name() == name {
+			return controller, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown stage %q", name)
+}
+
+// All returns every registered pool in registration order
+func All() []Controller {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	controllers := make([]Controller, len(registry))
+	copy(controllers, registry)
+	return controllers
+}
@@ -0,0 +1,55 @@
+package pool
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Stage status values shared by every *_status field
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+	StatusTimeout    = "timeout"
+)
+
+// StatusValues lists every stage status, as stored in the *_status select fields
+var StatusValues = []string{StatusPending, StatusProcessing, StatusProcessed, StatusFailed, StatusTimeout}
+
+// FailureStatus returns the status a record gets when its job fails with the given context:
+// "timeout" when the job ran out of time, "pending" when the pool was stopped underneath it
+// (the job will be recovered on the next start) and "failed" otherwise.
+func FailureStatus(ctx context.Context) string {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return StatusTimeout
+	case errors.Is(ctx.Err(), context.Canceled):
+		return StatusPending
+	default:
+		return StatusFailed
+	}
+}
+
+// StatusIndexName returns the name of the index of a stage status field
+func StatusIndexName(collection string, statusField string) string {
+	return "idx_" + collection + "_" + statusField
+}
+
+// ResetStatus puts a record that was removed from a queue back into the pending state.
+// Hooks are skipped so the record is not immediately queued again; the next
+// recovery run picks it up.
+func ResetStatus(app core.App, record *core.Record, statusField string) {
+	if app == nil || record == nil || record.Id == "" {
+		return
+	}
+
+	record.Set(statusField, StatusPending)
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		logger.Error("Failed to reset %s for %s: %v", statusField, record.Id, err)
+	}
+}
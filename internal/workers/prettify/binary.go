@@ -1,12 +1,14 @@
 package prettify
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 
 	"github.com/jsh-team/jshunter/internal/config"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
 )
 
 // getPrettierBinaryPath gets the prettifier binary path from configuration
@@ -25,8 +27,9 @@ func (p *PrettifyWorkerPool) getPrettierBinaryPath() (string, error) {
 	return prettifierPath, nil
 }
 
-// prettifyFileInPlace prettifies a file in place by calling the prettier binary directly
-func (p *PrettifyWorkerPool) prettifyFile(filePath string, fileType string) error {
+// prettifyFile prettifies a file in place by calling the prettier binary directly.
+// The prettier process is killed when ctx is done.
+func (p *PrettifyWorkerPool) prettifyFile(ctx context.Context, filePath string, fileType string) error {
 	// Get the path to the prettier binary
 	prettierPath, err := p.getPrettierBinaryPath()
 	if err != nil {
@@ -39,13 +42,16 @@ func (p *PrettifyWorkerPool) prettifyFile(filePath string, fileType string) erro
 	}
 
 	// Run prettier with just the file path - it auto-detects the type
-	cmd := exec.Command(prettierPath, "--"+fileType, filePath)
+	cmd := exec.CommandContext(ctx, prettierPath, "--"+fileType, filePath)
 
-	_, err = cmd.Output()
+	_, err = jobrun.Output(ctx, cmd)
+	if ctx.Err() != nil {
+		return fmt.Errorf("prettier interrupted: %w", ctx.Err())
+	}
 	if err != nil {
-		logger.Error("Prettifier command failed: %v", err)
+		logger.FromContext(ctx).Error("Prettifier command failed: %v", err)
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			logger.Error("Prettifier stderr: %s", string(exitErr.Stderr))
+			logger.FromContext(ctx).Error("Prettifier stderr: %s", string(exitErr.Stderr))
 		}
 		return fmt.Errorf("prettier formatting failed: %w", err)
 	}
@@ -2,16 +2,24 @@ package prettify
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"time"
 
-	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 )
 
 // processJob processes a single prettify job
-func (p *PrettifyWorkerPool) processJob(workerID int, job PrettifyJob) {
+func (p *PrettifyWorkerPool) processJob(ctx context.Context, workerID int, job PrettifyJob) {
+	run := jobrun.Start(job.App, "prettify", job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+	log := run.Logger()
+
 	startTime := time.Now()
 	errorCount := 0
 
@@ -19,27 +27,25 @@ func (p *PrettifyWorkerPool) processJob(workerID int, job PrettifyJob) {
 	fullPath := job.FilePath
 	if fullPath == "" {
 		errorCount++
-		logger.Error("Prettify Worker %d failed: missing file path for job", workerID)
+		log.Error("Prettify Worker %d failed: missing file path for job", workerID)
 		// Only set status if this is a real record (not temp record for HTML)
 		if job.Record != nil && job.Record.Id != "" {
-			job.Record.Set("prettify_status", "failed")
-			job.App.Save(job.Record)
+			markFailed(ctx, job, fmt.Errorf("missing file path for job"))
 		}
-		logger.Info("Prettify worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Info("Prettify worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
 	// Call prettifier binary directly on the file
-	if err := p.prettifyFile(fullPath, job.Type); err != nil {
+	if err := p.prettifyFile(ctx, fullPath, job.Type); err != nil {
 		errorCount++
 
-		logger.Error("Prettify Worker %d failed to prettify file %s: %v | URL: %s", workerID, fullPath, err, job.Record.Get("url"))
+		log.Error("Prettify Worker %d failed to prettify file %s: %v | URL: %s", workerID, fullPath, err, job.Record.Get("url"))
 		// Only set status if this is a real record (not temp record for HTML)
 		if job.Record != nil && job.Record.Id != "" {
-			job.Record.Set("prettify_status", "failed")
-			job.App.Save(job.Record)
+			markFailed(ctx, job, err)
 		}
-		logger.Info("Prettify worker finished in %v with %d errors", time.Since(startTime), errorCount)
+		log.Info("Prettify worker finished in %v with %d errors", time.Since(startTime), errorCount)
 		return
 	}
 
@@ -55,12 +61,33 @@ func (p *PrettifyWorkerPool) processJob(workerID int, job PrettifyJob) {
 		job.Record.Set("last_modified", time.Now())
 		if err := job.App.Save(job.Record); err != nil {
 			errorCount++
-			logger.Error("Prettify Worker %d failed to save final record: %v", workerID, err)
+			log.Error("Prettify Worker %d failed to save final record: %v", workerID, err)
 		}
 	}
 
 }
 
+// markFailed sets the failure status of the prettify job and stores it in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job PrettifyJob, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	job.Record.Set("prettify_status", status)
+	job.App.Save(job.Record)
+	if status == pool.StatusPending {
+		return
+	}
+
+	deadletter.Record(job.App, deadletter.Entry{
+		Stage:      "prettify",
+		Collection: job.Record.Collection().Name,
+		RecordID:   job.Record.Id,
+		URL:        job.Record.GetString("url"),
+		InputPath:  job.FilePath,
+		Err:        err,
+	})
+}
+
 func countLines(filePath string) (int, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
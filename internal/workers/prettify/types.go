@@ -1,8 +1,7 @@
 package prettify
 
 import (
-	"context"
-	"sync"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -14,17 +13,10 @@ type PrettifyJob struct {
 	Content  string
 	FilePath string
 	Type     string
-	Context  context.Context
 	App      *pocketbase.PocketBase
 }
 
 // PrettifyWorkerPool manages a pool of workers for prettifying content
 type PrettifyWorkerPool struct {
-	workers   int
-	jobQueue  chan PrettifyJob
-	workerWg  sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-	isRunning bool
-	mu        sync.RWMutex
+	*pool.Pool[PrettifyJob]
 }
@@ -0,0 +1,385 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/storage"
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// LeaseTTL is how long a lease survives without a heartbeat
+const LeaseTTL = 60 * time.Second
+
+// ErrUnknownLease is returned for leases that expired, were reassigned or never existed
+var ErrUnknownLease = errors.New("unknown or expired lease")
+
+// lease is the coordinator side of a job handed to a remote worker
+type lease struct {
+	Lease
+	workerID string
+	record   *core.Record
+	run      *jobrun.Run
+}
+
+// WorkerInfo describes a remote worker seen by the coordinator
+type WorkerInfo struct {
+	ID       string    `json:"id"`
+	Stages   []string  `json:"stages"`
+	LastSeen time.Time `json:"last_seen"`
+	Leases   int       `json:"leases"`
+}
+
+// Coordinator hands queued jobs of the extraction and analysis pools to remote workers
+// and puts them back in the queue when a worker stops sending heartbeats
+type Coordinator struct {
+	app        *pocketbase.PocketBase
+	extraction *extraction.ExtractionWorkerPool
+	analysis   *analysis.AnalysisWorkerPool
+
+	mu      sync.Mutex
+	leases  map[string]*lease
+	workers map[string]*WorkerInfo
+	stop    chan struct{}
+}
+
+// NewCoordinator creates a coordinator leasing jobs from the given pools
+func NewCoordinator(app *pocketbase.PocketBase, extractionPool *extraction.ExtractionWorkerPool, analysisPool *analysis.AnalysisWorkerPool) *Coordinator {
+	return &Coordinator{
+		app:        app,
+		extraction: extractionPool,
+		analysis:   analysisPool,
+		leases:     make(map[string]*lease),
+		workers:    make(map[string]*WorkerInfo),
+	}
+}
+
+// Start runs the loop that reassigns the jobs of expired leases
+func (c *Coordinator) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+
+	go func(stop chan struct{}) {
+		ticker := time.NewTicker(LeaseTTL / 4)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.reassignExpired()
+			case <-stop:
+				return
+			}
+		}
+	}(c.stop)
+}
+
+// Stop ends the reassignment loop. Outstanding leases stay in processing and are
+// recovered like any other unfinished job.
+func (c *Coordinator) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// Lease takes up to max queued jobs of the requested stages for a worker
+func (c *Coordinator) Lease(req LeaseRequest) ([]Lease, error) {
+	if req.WorkerID == "" {
+		return nil, fmt.Errorf("worker_id is required")
+	}
+	for _, stage := range req.Stages {
+		if !slices.Contains(Stages, stage) {
+			return nil, fmt.Errorf("stage %q cannot run on remote workers", stage)
+		}
+	}
+	if req.Max < 1 {
+		req.Max = 1
+	}
+
+	c.touch(req.WorkerID, req.Stages)
+
+	var leased []Lease
+	for _, stage := range req.Stages {
+		remaining := req.Max - len(leased)
+		if remaining <= 0 {
+			break
+		}
+
+		for _, record := range c.take(stage, remaining) {
+			leased = append(leased, c.newLease(req.WorkerID, stage, record))
+		}
+	}
+	return leased, nil
+}
+
+// take removes queued records of a stage from its local pool
+func (c *Coordinator) take(stage string, max int) []*core.Record {
+	var records []*core.Record
+	switch stage {
+	case StageExtraction:
+		for _, job := range c.extraction.Take(max) {
+			records = append(records, job.Record)
+		}
+	case StageAnalysis:
+		for _, job := range c.analysis.Take(max) {
+			records = append(records, job.Record)
+		}
+	}
+	return records
+}
+
+// newLease registers a lease of the record for a worker
+func (c *Coordinator) newLease(workerID string, stage string, record *core.Record) Lease {
+	l := &lease{
+		Lease: Lease{
+			ID:        security.RandomString(24),
+			Stage:     stage,
+			RecordID:  record.Id,
+			URL:       record.GetString("url"),
+			ExpiresAt: time.Now().Add(LeaseTTL),
+		},
+		workerID: workerID,
+		record:   record,
+		run:      jobrun.Start(c.app, stage, record, workerID),
+	}
+
+	switch stage {
+	case StageExtraction:
+		l.Headers = extraction.RecordHeaders(record)
+		l.Mobile = config.MobileExtractionEnabled
+		l.Timeout = config.BrowserWorkerTimeout
+	case StageAnalysis:
+		l.Timeout = config.AnalysisTimeout
+	}
+
+	c.mu.Lock()
+	c.leases[l.ID] = l
+	c.mu.Unlock()
+
+	logger.Debug("Leased %s job for %s to worker %s", stage, l.URL, workerID)
+	return l.Lease
+}
+
+// Heartbeat extends a lease held by the worker
+func (c *Coordinator) Heartbeat(leaseID string, workerID string) (Lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.leases[leaseID]
+	if !ok || l.workerID != workerID {
+		return Lease{}, ErrUnknownLease
+	}
+	l.ExpiresAt = time.Now().Add(LeaseTTL)
+	if worker, ok := c.workers[workerID]; ok {
+		worker.LastSeen = time.Now()
+	}
+	return l.Lease, nil
+}
+
+// InputPath returns the stored file a lease works on (analysis only)
+func (c *Coordinator) InputPath(leaseID string, workerID string) (string, error) {
+	l, err := c.get(leaseID, workerID)
+	if err != nil {
+		return "", err
+	}
+	if l.Stage != StageAnalysis {
+		return "", fmt.Errorf("%s leases have no input file", l.Stage)
+	}
+	return storage.GetJSFilePath(l.record.GetString("url"), l.record.GetString("hash"))
+}
+
+// Complete stores the uploaded result of a lease and releases it
+func (c *Coordinator) Complete(leaseID string, req CompleteRequest) error {
+	l, err := c.release(leaseID, req.WorkerID)
+	if err != nil {
+		return err
+	}
+	l.run.SetCommand(req.Command)
+	l.run.AddPages(req.Pages...)
+	defer l.run.Finish()
+
+	switch l.Stage {
+	case StageExtraction:
+		if req.Extraction == nil {
+			err = fmt.Errorf("missing extraction result")
+			l.run.Fail(pool.StatusFailed, err)
+			break
+		}
+		err = extraction.SaveResults(c.app, l.record, req.Extraction.HTML, req.Extraction.JSFiles, false)
+		if err == nil && l.Mobile {
+			err = extraction.SaveResults(c.app, l.record, req.Extraction.MobileHTML, req.Extraction.MobileJSFiles, true)
+		}
+		if err == nil {
+			err = extraction.Complete(c.app, l.record)
+		}
+		if err != nil {
+			l.run.Fail(pool.StatusFailed, err)
+			extraction.Fail(c.app, l.record, pool.StatusFailed, err)
+		}
+	case StageAnalysis:
+		if req.Analysis == nil {
+			err = fmt.Errorf("missing analysis result")
+			l.run.Fail(pool.StatusFailed, err)
+			break
+		}
+		if err = analysis.Complete(c.app, l.record, req.Analysis.Findings); err != nil {
+			l.run.Fail(pool.StatusFailed, err)
+			analysis.Fail(c.app, l.record, pool.StatusFailed, "", err)
+		}
+	}
+	return err
+}
+
+// Fail records the failure reported by a worker and releases the lease.
+// Interrupted jobs (status pending) go back to the queue.
+func (c *Coordinator) Fail(leaseID string, req FailRequest) error {
+	l, err := c.release(leaseID, req.WorkerID)
+	if err != nil {
+		return err
+	}
+
+	status := req.Status
+	if status != pool.StatusTimeout && status != pool.StatusPending {
+		status = pool.StatusFailed
+	}
+
+	jobErr := fmt.Errorf("remote worker %s: %s", req.WorkerID, req.Error)
+	l.run.SetCommand(req.Command)
+	l.run.AddPages(req.Pages...)
+	l.run.Fail(status, jobErr)
+	l.run.Finish()
+
+	if status == pool.StatusPending {
+		c.requeue(l)
+		return nil
+	}
+
+	logger.Error("Remote %s job for %s failed: %v", l.Stage, l.URL, jobErr)
+	switch l.Stage {
+	case StageExtraction:
+		extraction.Fail(c.app, l.record, status, jobErr)
+	case StageAnalysis:
+		analysis.Fail(c.app, l.record, status, "", jobErr)
+	}
+	return nil
+}
+
+// Workers returns the remote workers seen by the coordinator
+func (c *Coordinator) Workers() []WorkerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, l := range c.leases {
+		counts[l.workerID]++
+	}
+
+	workers := make([]WorkerInfo, 0, len(c.workers))
+	for _, worker := range c.workers {
+		info := *worker
+		info.Leases = counts[worker.ID]
+		workers = append(workers, info)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].ID < workers[j].ID
+	})
+	return workers
+}
+
+// touch records that a worker is alive
+func (c *Coordinator) touch(workerID string, stages []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	worker, ok := c.workers[workerID]
+	if !ok {
+		worker = &WorkerInfo{ID: workerID}
+		c.workers[workerID] = worker
+		logger.Info("Remote worker %s connected (%v)", workerID, stages)
+	}
+	worker.Stages = stages
+	worker.LastSeen = time.Now()
+}
+
+// get returns a lease held by the worker
+func (c *Coordinator) get(leaseID string, workerID string) (*lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.leases[leaseID]
+	if !ok || l.workerID != workerID {
+		return nil, ErrUnknownLease
+	}
+	return l, nil
+}
+
+// release removes a lease held by the worker
+func (c *Coordinator) release(leaseID string, workerID string) (*lease, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	l, ok := c.leases[leaseID]
+	if !ok || l.workerID != workerID {
+		return nil, ErrUnknownLease
+	}
+	delete(c.leases, leaseID)
+	return l, nil
+}
+
+// reassignExpired puts the jobs of leases without recent heartbeats back in their queue
+func (c *Coordinator) reassignExpired() {
+	now := time.Now()
+
+	c.mu.Lock()
+	var expired []*lease
+	for id, l := range c.leases {
+		if now.After(l.ExpiresAt) {
+			expired = append(expired, l)
+			delete(c.leases, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, l := range expired {
+		logger.Info("Lease of %s job for %s expired on worker %s, reassigning", l.Stage, l.URL, l.workerID)
+		l.run.Fail(pool.StatusPending, fmt.Errorf("lease expired on worker %s", l.workerID))
+		l.run.Finish()
+		c.requeue(l)
+	}
+}
+
+// requeue submits the job of a lease to its local pool again
+func (c *Coordinator) requeue(l *lease) {
+	var err error
+	switch l.Stage {
+	case StageExtraction:
+		err = c.extraction.SubmitJob(extraction.ExtractionJob{App: c.app, Record: l.record}, pool.RecordPriority(l.record))
+	case StageAnalysis:
+		err = c.analysis.SubmitJob(analysis.AnalysisJob{App: c.app, Record: l.record}, pool.RecordPriority(l.record))
+	}
+	if err != nil {
+		logger.Error("Failed to requeue %s job for %s: %v", l.Stage, l.URL, err)
+		pool.ResetStatus(c.app, l.record, l.Stage+"_status")
+	}
+}
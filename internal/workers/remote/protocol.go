@@ -0,0 +1,73 @@
+package remote
+
+import (
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+)
+
+// Stages that can run on remote workers
+const (
+	StageExtraction = "extraction"
+	StageAnalysis   = "analysis"
+)
+
+// Stages lists every stage a remote worker can lease
+var Stages = []string{StageExtraction, StageAnalysis}
+
+// LeaseRequest asks the coordinator for jobs of the given stages
+type LeaseRequest struct {
+	WorkerID string   `json:"worker_id"`
+	Stages   []string `json:"stages"`
+	Max      int      `json:"max"`
+}
+
+// Lease is a job handed to a remote worker until it completes, fails or expires
+type Lease struct {
+	ID        string            `json:"id"`
+	Stage     string            `json:"stage"`
+	RecordID  string            `json:"record_id"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"` // Extraction: request headers of the endpoint
+	Mobile    bool              `json:"mobile,omitempty"`  // Extraction: also extract the mobile version
+	Timeout   int               `json:"timeout"`           // Seconds the worker may spend on the job
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ExtractionResult carries the pages and scripts collected by a remote browser
+type ExtractionResult struct {
+	HTML          string                    `json:"html"`
+	JSFiles       []extraction.JSFileResult `json:"js_files"`
+	MobileHTML    string                    `json:"mobile_html,omitempty"`
+	MobileJSFiles []extraction.JSFileResult `json:"mobile_js_files,omitempty"`
+}
+
+// AnalysisResult carries the findings of a remote analyzer run
+type AnalysisResult struct {
+	Findings []analysis.Finding `json:"findings"`
+}
+
+// CompleteRequest uploads the result of a lease. Only the field of the lease stage is read.
+type CompleteRequest struct {
+	WorkerID   string              `json:"worker_id"`
+	Extraction *ExtractionResult   `json:"extraction,omitempty"`
+	Analysis   *AnalysisResult     `json:"analysis,omitempty"`
+	Command    *jobrun.Command     `json:"command,omitempty"` // External binary run by the worker, if any
+	Pages      []jobrun.PageTiming `json:"pages,omitempty"`   // Pages loaded by an extraction
+}
+
+// FailRequest reports a lease that could not be processed
+type FailRequest struct {
+	WorkerID string              `json:"worker_id"`
+	Error    string              `json:"error"`
+	Status   string              `json:"status"` // failed, timeout, or pending when the worker was interrupted
+	Command  *jobrun.Command     `json:"command,omitempty"`
+	Pages    []jobrun.PageTiming `json:"pages,omitempty"`
+}
+
+// HeartbeatRequest keeps a lease alive while the worker is still processing it
+type HeartbeatRequest struct {
+	WorkerID string `json:"worker_id"`
+}
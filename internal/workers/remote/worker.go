@@ -0,0 +1,292 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/extraction"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+)
+
+// WorkerOptions configures a remote worker process
+type WorkerOptions struct {
+	Server       string // Base URL of the coordinator, e.g. http://10.0.0.1:20450
+	Token        string
+	WorkerID     string
+	Stages       []string
+	Concurrency  int
+	PollInterval time.Duration
+}
+
+// Worker leases jobs from a coordinator, runs them locally and uploads the results
+type Worker struct {
+	opts   WorkerOptions
+	client *http.Client
+}
+
+// NewWorker creates a remote worker
+func NewWorker(opts WorkerOptions) *Worker {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	opts.Server = strings.TrimRight(opts.Server, "/")
+
+	return &Worker{
+		opts:   opts,
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Run processes leased jobs until ctx is cancelled. Jobs interrupted by the
+// cancellation are handed back to the coordinator.
+func (w *Worker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			w.loop(ctx, slot)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// loop leases and processes one job at a time
+func (w *Worker) loop(ctx context.Context, slot int) {
+	for ctx.Err() == nil {
+		var leases []Lease
+		err := w.call(ctx, http.MethodPost, "/api/workers/lease", LeaseRequest{
+			WorkerID: w.opts.WorkerID,
+			Stages:   w.opts.Stages,
+			Max:      1,
+		}, &leases)
+		if err != nil && ctx.Err() == nil {
+			logger.Error("Worker slot %d failed to lease jobs: %v", slot, err)
+		}
+
+		if len(leases) == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.opts.PollInterval):
+			}
+			continue
+		}
+
+		for _, l := range leases {
+			w.process(ctx, slot, l)
+		}
+	}
+}
+
+// process runs a leased job while keeping its lease alive
+func (w *Worker) process(ctx context.Context, slot int, l Lease) {
+	startTime := time.Now()
+	log := logger.With(logger.Fields{
+		"stage":     l.Stage,
+		"worker_id": w.opts.WorkerID,
+		"lease_id":  l.ID,
+		"record_id": l.RecordID,
+		"url":       l.URL,
+	})
+	log.Info("Worker slot %d processing %s job for %s", slot, l.Stage, l.URL)
+
+	var jobCtx context.Context
+	var cancel context.CancelFunc
+	if l.Timeout > 0 {
+		jobCtx, cancel = context.WithTimeout(ctx, time.Duration(l.Timeout)*time.Second)
+	} else {
+		jobCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// The run only collects the details of the external binary; the coordinator stores it
+	run := jobrun.Start(nil, l.Stage, nil, w.opts.WorkerID)
+	runCtx := logger.NewContext(jobrun.NewContext(jobCtx, run), log)
+
+	// Heartbeats stop the coordinator from reassigning the job; a lost lease cancels it
+	heartbeatDone := make(chan struct{})
+	defer close(heartbeatDone)
+	go func() {
+		ticker := time.NewTicker(LeaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+				err := w.call(jobCtx, http.MethodPost, "/api/workers/leases/"+l.ID+"/heartbeat", HeartbeatRequest{WorkerID: w.opts.WorkerID}, nil)
+				if err == ErrUnknownLease {
+					log.Error("Lease of %s job for %s was lost, cancelling", l.Stage, l.URL)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	req := CompleteRequest{WorkerID: w.opts.WorkerID}
+	var err error
+	switch l.Stage {
+	case StageExtraction:
+		req.Extraction, err = w.runExtraction(runCtx, l)
+	case StageAnalysis:
+		req.Analysis, err = w.runAnalysis(runCtx, l)
+	default:
+		err = fmt.Errorf("unsupported stage %q", l.Stage)
+	}
+
+	// Results are reported even when the worker is shutting down
+	reportCtx, reportCancel := context.WithTimeout(context.Background(), time.Minute)
+	defer reportCancel()
+
+	if err != nil {
+		status := pool.FailureStatus(jobCtx)
+		log.Error("Worker slot %d failed %s job for %s (%s): %v", slot, l.Stage, l.URL, status, err)
+		failErr := w.call(reportCtx, http.MethodPost, "/api/workers/leases/"+l.ID+"/fail", FailRequest{
+			WorkerID: w.opts.WorkerID,
+			Error:    err.Error(),
+			Status:   status,
+			Command:  run.Command(),
+			Pages:    run.Pages(),
+		}, nil)
+		if failErr != nil {
+			log.Error("Failed to report failure of %s job for %s: %v", l.Stage, l.URL, failErr)
+		}
+		return
+	}
+
+	req.Command = run.Command()
+	req.Pages = run.Pages()
+	if err := w.call(reportCtx, http.MethodPost, "/api/workers/leases/"+l.ID+"/complete", req, nil); err != nil {
+		log.Error("Failed to upload %s result for %s: %v", l.Stage, l.URL, err)
+		return
+	}
+	log.Info("Worker slot %d finished %s job for %s in %v", slot, l.Stage, l.URL, time.Since(startTime))
+}
+
+// runExtraction loads the endpoint in a local browser
+func (w *Worker) runExtraction(ctx context.Context, l Lease) (*ExtractionResult, error) {
+	html, jsFiles, err := extraction.ExtractEndpoint(ctx, l.URL, l.Headers, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ExtractionResult{HTML: html, JSFiles: jsFiles}
+	if l.Mobile {
+		result.MobileHTML, result.MobileJSFiles, err = extraction.ExtractEndpoint(ctx, l.URL, l.Headers, true)
+		if err != nil {
+			return nil, fmt.Errorf("mobile extraction failed: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// runAnalysis downloads the JavaScript file and runs the local analyzer on it
+func (w *Worker) runAnalysis(ctx context.Context, l Lease) (*AnalysisResult, error) {
+	tmp, err := os.CreateTemp("", "jshunter-*.js")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = w.download(ctx, "/api/workers/leases/"+l.ID+"/input?worker_id="+url.QueryEscape(w.opts.WorkerID), tmp)
+	tmp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download input file: %w", err)
+	}
+
+	findings, err := analysis.AnalyzeFile(ctx, tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &AnalysisResult{Findings: findings}, nil
+}
+
+// newRequest builds an authenticated request to the coordinator
+func (w *Worker) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.opts.Server+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.opts.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// call sends a JSON request to the coordinator and decodes the JSON response
+func (w *Worker) call(ctx context.Context, method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := w.newRequest(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// download streams a file from the coordinator into dst
+func (w *Worker) download(ctx context.Context, path string, dst io.Writer) error {
+	req, err := w.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, resp.Body)
+	return err
+}
+
+// checkResponse turns error responses of the coordinator into errors
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusConflict {
+		return ErrUnknownLease
+	}
+	if resp.StatusCode >= 400 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("coordinator returned HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/utils/logger"
+	"github.com/jsh-team/jshunter/internal/workers/pipeline"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+)
+
+// CollectionName is the name of the collection storing the re-crawl schedules
+const CollectionName = "schedules"
+
+// Statuses of the last run of a schedule
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// jobPrefix prefixes the cron job IDs so they do not clash with the PocketBase jobs
+const jobPrefix = "jshunter_schedule_"
+
+// nextRunHorizon bounds the search for the next run time of an expression
+const nextRunHorizon = 366 * 24 * time.Hour
+
+// Result is the outcome of one run of a schedule
+type Result struct {
+	Queued  int // Endpoints sent back to extraction
+	Skipped int // Endpoints still in the pipeline from a previous run
+	Failed  int // Endpoints that could not be queued
+}
+
+// ErrRunning is returned when a schedule is run while its previous run is still going
+var ErrRunning = errors.New("schedule is already running")
+
+// running holds the schedules currently running, so a slow run is never overlapped by the next one
+var running sync.Map
+
+// Validate checks a cron expression
+func Validate(expression string) error {
+	if _, err := cron.NewSchedule(strings.TrimSpace(expression)); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", expression, err)
+	}
+	return nil
+}
+
+// NextRun returns the next time after from at which the expression is due, in UTC like
+// the PocketBase cron. It returns false when the expression is invalid or never due within a year.
+func NextRun(expression string, from time.Time) (time.Time, bool) {
+	schedule, err := cron.NewSchedule(strings.TrimSpace(expression))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	next := from.UTC().Truncate(time.Minute).Add(time.Minute)
+	for end := next.Add(nextRunHorizon); next.Before(end); next = next.Add(time.Minute) {
+		if schedule.IsDue(cron.NewMoment(next)) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// IsRunning reports whether the schedule is currently re-queuing its endpoints
+func IsRunning(id string) bool {
+	_, ok := running.Load(id)
+	return ok
+}
+
+// IsRegistered reports whether the schedule has a job in the cron of the app
+func IsRegistered(app *pocketbase.PocketBase, id string) bool {
+	for _, job := range app.Cron().Jobs() {
+		if job.Id() == jobPrefix+id {
+			return true
+		}
+	}
+	return false
+}
+
+// Load registers the cron jobs of every enabled schedule
+func Load(app *pocketbase.PocketBase) error {
+	records, err := app.FindAllRecords(CollectionName)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := Sync(app, record); err != nil {
+			logger.Error("Failed to register schedule %s: %v", record.Id, err)
+		}
+	}
+	return nil
+}
+
+// Sync adds or replaces the cron job of a schedule, or removes it when the schedule is disabled
+func Sync(app *pocketbase.PocketBase, record *core.Record) error {
+	if !record.GetBool("enabled") {
+		Remove(app, record.Id)
+		return nil
+	}
+
+	id := record.Id
+	return app.Cron().Add(jobPrefix+id, strings.TrimSpace(record.GetString("cron")), func() {
+		// Reload the schedule so the run sees its latest settings
+		current, err := app.FindRecordById(CollectionName, id)
+		if err != nil {
+			Remove(app, id)
+			return
+		}
+		if _, err := Run(app, current); err != nil {
+			logger.Error("Scheduled re-crawl %s failed: %v", id, err)
+		}
+	})
+}
+
+// Remove removes the cron job of a schedule
+func Remove(app *pocketbase.PocketBase, id string) {
+	app.Cron().Remove(jobPrefix + id)
+}
+
+// Run sends the endpoints of a schedule back through the pipeline, starting with browser
+// extraction, and stores the result on the schedule. Endpoints that are still in the pipeline
+// are skipped. A schedule without an endpoint covers every endpoint of the target. The
+// extractions go to the low priority lane so manual submissions are served first.
+func Run(app *pocketbase.PocketBase, record *core.Record) (Result, error) {
+	var result Result
+
+	if _, busy := running.LoadOrStore(record.Id, struct{}{}); busy {
+		return result, ErrRunning
+	}
+	defer running.Delete(record.Id)
+
+	startTime := time.Now()
+
+	var endpoints []*core.Record
+	var err error
+	if endpointID := record.GetString("endpoint"); endpointID != "" {
+		var endpoint *core.Record
+		endpoint, err = app.FindRecordById("endpoints", endpointID)
+		endpoints = []*core.Record{endpoint}
+	} else {
+		endpoints, err = app.FindAllRecords("endpoints")
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to load endpoints: %w", err)
+		finish(app, record, result, StatusFailed, err)
+		return result, err
+	}
+
+	for _, endpoint := range endpoints {
+		if pipeline.InFlight(endpoint) {
+			result.Skipped++
+			continue
+		}
+		if err := pipeline.Restart(app, endpoint, pool.PriorityLow); err != nil {
+			logger.Error("Failed to re-queue %s: %v", endpoint.GetString("url"), err)
+			result.Failed++
+			continue
+		}
+		result.Queued++
+	}
+
+	status := StatusOK
+	var runErr error
+	if result.Failed > 0 {
+		status = StatusFailed
+		runErr = fmt.Errorf("%d endpoints could not be queued", result.Failed)
+	}
+	finish(app, record, result, status, runErr)
+
+	logger.Info("Schedule %s queued %d endpoints for re-crawl (%d still in progress, %d failed) in %v",
+		record.Id, result.Queued, result.Skipped, result.Failed, time.Since(startTime))
+	return result, nil
+}
+
+// finish stores the result of a run on the schedule
+func finish(app *pocketbase.PocketBase, record *core.Record, result Result, status string, err error) {
+	errorMessage := ""
+	if err != nil {
+		errorMessage = err.Error()
+	}
+
+	record.Set("last_run_at", time.Now())
+	record.Set("last_status", status)
+	record.Set("last_error", errorMessage)
+	record.Set("last_queued", result.Queued)
+	record.Set("last_skipped", result.Skipped)
+	record.Set("last_failed", result.Failed)
+
+	// Skip hooks: the result must not re-register the cron job that is running
+	if err := app.UnsafeWithoutHooks().Save(record); err != nil {
+		logger.Error("Failed to save result of schedule %s: %v", record.Id, err)
+	}
+}
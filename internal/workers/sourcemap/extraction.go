@@ -37,7 +37,7 @@ type SourceFile struct {
 }
 
 // ProcessSourceMap is the main function that handles all sourcemap extraction logic
-func ProcessSourceMap(jsBody string, jsURL string) (SourceMapResult, error) {
+func ProcessSourceMap(ctx context.Context, jsBody string, jsURL string) (SourceMapResult, error) {
 	result := SourceMapResult{
 		Found:       false,
 		SourceFiles: []SourceFile{},
@@ -51,16 +51,19 @@ func ProcessSourceMap(jsBody string, jsURL string) (SourceMapResult, error) {
 
 	if sourceMapURL != "" {
 		// Step 2a: Process sourcemap URL (data URI or regular URL)
-		sourceMapContent, err = getSourceMapContent(sourceMapURL, jsURL)
+		sourceMapContent, err = getSourceMapContent(ctx, sourceMapURL, jsURL)
 		if err != nil {
 			// Step 2b: If failed, try fallback .map URL
-			sourceMapContent, err = tryFallbackMapURL(jsURL)
+			sourceMapContent, err = tryFallbackMapURL(ctx, jsURL)
 		}
 	} else {
 		// Step 2b: No sourcemap URL found, try fallback .map URL
-		sourceMapContent, err = tryFallbackMapURL(jsURL)
+		sourceMapContent, err = tryFallbackMapURL(ctx, jsURL)
 	}
 
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
 	if err != nil || sourceMapContent == nil {
 		return result, nil // No sourcemap found, not an error
 	}
@@ -94,7 +97,7 @@ func findSourceMapURL(jsBody string) string {
 }
 
 // getSourceMapContent retrieves sourcemap content from URL or data URI
-func getSourceMapContent(sourceMapURL string, jsURL string) ([]byte, error) {
+func getSourceMapContent(ctx context.Context, sourceMapURL string, jsURL string) ([]byte, error) {
 	// Handle inline data URI sourcemaps
 	if strings.HasPrefix(sourceMapURL, "data:") {
 		return url.DecodeDataURI(sourceMapURL)
@@ -107,11 +110,11 @@ func getSourceMapContent(sourceMapURL string, jsURL string) ([]byte, error) {
 	}
 
 	// Fetch the sourcemap from the URL
-	return fetchSourceMapContent(fullURL)
+	return fetchSourceMapContent(ctx, fullURL)
 }
 
 // tryFallbackMapURL tries to fetch sourcemap using .map extension
-func tryFallbackMapURL(jsURL string) ([]byte, error) {
+func tryFallbackMapURL(ctx context.Context, jsURL string) ([]byte, error) {
 	// Remove query string and add .map extension
 	cleanURL, err := url.RemoveQueryString(jsURL)
 	if err != nil {
@@ -119,16 +122,16 @@ func tryFallbackMapURL(jsURL string) ([]byte, error) {
 	}
 
 	mapURL := cleanURL + ".map"
-	return fetchSourceMapContent(mapURL)
+	return fetchSourceMapContent(ctx, mapURL)
 }
 
 // fetchSourceMapContent downloads sourcemap content using the fetch utility
-func fetchSourceMapContent(mapURL string) ([]byte, error) {
+func fetchSourceMapContent(ctx context.Context, mapURL string) ([]byte, error) {
 	assetFetcher := fetch.NewAssetFetcher()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	content, success, err := assetFetcher.RateLimitedGet(ctx, mapURL)
+	content, success, err := assetFetcher.RateLimitedGet(fetchCtx, mapURL)
 	if !success || err != nil {
 		return nil, fmt.Errorf("failed to download sourcemap from %s: %w", mapURL, err)
 	}
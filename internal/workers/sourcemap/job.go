@@ -1,38 +1,45 @@
 package sourcemap
 
 import (
+	"context"
+	"fmt"
 	"os"
 
+	"github.com/jsh-team/jshunter/internal/events"
 	"github.com/jsh-team/jshunter/internal/storage"
 	"github.com/jsh-team/jshunter/internal/utils/filesystem"
+	"github.com/jsh-team/jshunter/internal/workers/deadletter"
+	"github.com/jsh-team/jshunter/internal/workers/jobrun"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 )
 
 // processJob processes a single sourcemap job
-func (p *SourcemapWorkerPool) processJob(workerID int, job SourcemapJob) {
+func (p *SourcemapWorkerPool) processJob(ctx context.Context, workerID int, job SourcemapJob) {
+	run := jobrun.Start(job.App, "sourcemap", job.Record, jobrun.LocalWorker(workerID))
+	defer run.Finish()
+	ctx = jobrun.NewContext(ctx, run)
+
 	jsFileRecord := job.Record
 
 	// Get file hash and URL to build the path
 	bodyHash := jsFileRecord.GetString("hash")
 	fileURL := jsFileRecord.GetString("url")
 	if bodyHash == "" || fileURL == "" {
-		jsFileRecord.Set("sourcemap_status", "failed")
-		job.App.Save(jsFileRecord)
+		markFailed(ctx, job, "", fmt.Errorf("missing hash or URL"))
 		return
 	}
 
 	// Read JS file content directly from filesystem using filesystem utility
 	filePath, err := storage.GetJSFilePath(fileURL, bodyHash)
 	if err != nil {
-		jsFileRecord.Set("sourcemap_status", "failed")
-		job.App.Save(jsFileRecord)
+		markFailed(ctx, job, "", err)
 		return
 	}
 
 	// Read file content
 	jsContentBytes, err := os.ReadFile(filePath)
 	if err != nil {
-		jsFileRecord.Set("sourcemap_status", "failed")
-		job.App.Save(jsFileRecord)
+		markFailed(ctx, job, filePath, err)
 		return
 	}
 	jsContent := string(jsContentBytes)
@@ -40,13 +47,12 @@ func (p *SourcemapWorkerPool) processJob(workerID int, job SourcemapJob) {
 	// Extract domain for organizing source files
 	domain, err := filesystem.ExtractDomain(jsFileRecord.GetString("url"))
 	if err != nil {
-		jsFileRecord.Set("sourcemap_status", "failed")
-		job.App.Save(jsFileRecord)
+		markFailed(ctx, job, filePath, err)
 		return
 	}
 
 	// Process sourcemap
-	result, err := ProcessSourceMap(jsContent, jsFileRecord.GetString("url"))
+	result, err := ProcessSourceMap(ctx, jsContent, jsFileRecord.GetString("url"))
 	if err != nil {
 		// Not having a sourcemap is expected and not an error, so we don't log this as an error
 		jsFileRecord.Set("sourcemap_status", "processed")
@@ -70,4 +76,34 @@ func (p *SourcemapWorkerPool) processJob(workerID int, job SourcemapJob) {
 		return
 	}
 
+	if successCount > 0 {
+		events.Publish(events.Event{
+			Type:       events.SourcemapRecovered,
+			Collection: "js_files",
+			RecordID:   jsFileRecord.Id,
+			URL:        jsFileRecord.GetString("url"),
+			Data:       map[string]any{"sources": successCount},
+		})
+	}
+}
+
+// markFailed sets the failure status of the sourcemap job and stores it in the dead letters
+// collection, unless the job was only interrupted by a shutdown
+func markFailed(ctx context.Context, job SourcemapJob, inputPath string, err error) {
+	status := pool.FailureStatus(ctx)
+	jobrun.FromContext(ctx).Fail(status, err)
+	job.Record.Set("sourcemap_status", status)
+	job.App.Save(job.Record)
+	if status == pool.StatusPending {
+		return
+	}
+
+	deadletter.Record(job.App, deadletter.Entry{
+		Stage:      "sourcemap",
+		Collection: "js_files",
+		RecordID:   job.Record.Id,
+		URL:        job.Record.GetString("url"),
+		InputPath:  inputPath,
+		Err:        err,
+	})
 }
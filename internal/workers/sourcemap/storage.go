@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/metrics"
 	"github.com/jsh-team/jshunter/internal/utils/filesystem"
 	"github.com/jsh-team/jshunter/internal/utils/logger"
 
@@ -55,9 +56,10 @@ func (p *SourcemapWorkerPool) saveSourceFile(app *pocketbase.PocketBase, domain
 	}
 
 	// Write source file
-	if err := os.WriteFile(fullPath, []byte(sourceFile.Content), 0644); err != nil {
+	if err := filesystem.WriteFileAtomic(fullPath, []byte(sourceFile.Content), 0644); err != nil {
 		return fmt.Errorf("failed to write source file %s: %w", fullPath, err)
 	}
+	metrics.StoredBytes.Add(float64(len(sourceFile.Content)), "sourcemap")
 
 	logger.Debug("Saved source file: %s", fullPath)
 	return nil
@@ -1,8 +1,7 @@
 package sourcemap
 
 import (
-	"context"
-	"sync"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
 
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
@@ -16,11 +15,5 @@ type SourcemapJob struct {
 
 // SourcemapWorkerPool manages a pool of workers for sourcemap processing
 type SourcemapWorkerPool struct {
-	workers   int
-	jobQueue  chan SourcemapJob
-	workerWg  sync.WaitGroup
-	ctx       context.Context
-	cancel    context.CancelFunc
-	isRunning bool
-	mu        sync.RWMutex
+	*pool.Pool[SourcemapJob]
 }
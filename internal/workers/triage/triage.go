@@ -0,0 +1,269 @@
+// Package triage keeps the review state of findings: a status, a severity, notes and an
+// assignee, with an audit trail of every change. The latest decision on a finding is also
+// kept on its fingerprint so the same finding detected again in a later build starts from it.
+package triage
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jsh-team/jshunter/internal/config"
+	"github.com/jsh-team/jshunter/internal/workers/fingerprint"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// AuditCollectionName is the name of the collection storing the triage changes
+const AuditCollectionName = "finding_audit"
+
+// UsersCollectionName is the name of the auth collection findings are assigned to
+const UsersCollectionName = "users"
+
+// Statuses of a finding
+const (
+	StatusNew           = "new"
+	StatusInvestigating = "investigating"
+	StatusConfirmed     = "confirmed"
+	StatusFalsePositive = "false_positive"
+	StatusWontFix       = "wont_fix"
+)
+
+// Statuses lists the statuses of a finding
+var Statuses = []string{StatusNew, StatusInvestigating, StatusConfirmed, StatusFalsePositive, StatusWontFix}
+
+// MaxNotes is the maximum length of the notes of a finding
+const MaxNotes = 10000
+
+// Fields lists the triage fields, in the order changes are audited
+var Fields = []string{"status", "severity", "notes", "assignee"}
+
+// Change is a triage decision. Nil fields keep their current value; an empty assignee
+// unassigns the finding.
+type Change struct {
+	Status   *string `json:"status"`
+	Severity *string `json:"severity"`
+	Notes    *string `json:"notes"`
+	Assignee *string `json:"assignee"`
+}
+
+// Empty reports whether the change sets no field
+func (c Change) Empty() bool {
+	return c.Status == nil && c.Severity == nil && c.Notes == nil && c.Assignee == nil
+}
+
+// values returns the fields set by the change
+func (c Change) values() map[string]string {
+	values := make(map[string]string, len(Fields))
+	for field, value := range map[string]*string{"status": c.Status, "severity": c.Severity, "notes": c.Notes, "assignee": c.Assignee} {
+		if value != nil {
+			values[field] = *value
+		}
+	}
+	return values
+}
+
+// Validate checks the values of a change and that its assignee is a user
+func (c Change) Validate(app core.App) error {
+	if c.Empty() {
+		return errors.New("nothing to change: set status, severity, notes or assignee")
+	}
+	if c.Status != nil && !slices.Contains(Statuses, *c.Status) {
+		return fmt.Errorf("unknown status %q, use one of %v", *c.Status, Statuses)
+	}
+	if c.Severity != nil && !slices.Contains(config.Severities, *c.Severity) {
+		return fmt.Errorf("unknown severity %q, use one of %v", *c.Severity, config.Severities)
+	}
+	if c.Notes != nil && len(*c.Notes) > MaxNotes {
+		return fmt.Errorf("notes are limited to %d characters", MaxNotes)
+	}
+	if c.Assignee != nil && *c.Assignee != "" {
+		if _, err := app.FindRecordById(UsersCollectionName, *c.Assignee); err != nil {
+			return fmt.Errorf("user %q not found", *c.Assignee)
+		}
+	}
+	return nil
+}
+
+// Actor is who made a change: a user when the request was authenticated, and a free-form
+// name otherwise
+type Actor struct {
+	User string
+	Name string
+}
+
+// Apply sets a change on findings in one transaction, records an audit entry for every
+// field it changes and keeps the decision on the fingerprints of the findings. It returns
+// the number of findings changed; findings already in the requested state are skipped.
+func Apply(app core.App, findings []*core.Record, change Change, actor Actor) (int, error) {
+	if err := change.Validate(app); err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	err := app.RunInTransaction(func(txApp core.App) error {
+		auditCollection, err := txApp.FindCollectionByNameOrId(AuditCollectionName)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		values := change.values()
+		decisions := make(map[string]*core.Record)
+
+		for _, finding := range findings {
+			modified := false
+			for _, field := range Fields {
+				value, ok := values[field]
+				if !ok || finding.GetString(field) == value {
+					continue
+				}
+
+				entry := core.NewRecord(auditCollection)
+				entry.Set("finding", finding.Id)
+				entry.Set("fingerprint", finding.GetString("fingerprint"))
+				entry.Set("field", field)
+				entry.Set("old_value", finding.GetString(field))
+				entry.Set("new_value", value)
+				entry.Set("user", actor.User)
+				entry.Set("actor", actor.Name)
+				entry.Set("created_at", now)
+				if err := txApp.Save(entry); err != nil {
+					return err
+				}
+
+				finding.Set(field, value)
+				modified = true
+			}
+			if !modified {
+				continue
+			}
+
+			finding.Set("triaged_at", now)
+			if err := txApp.Save(finding); err != nil {
+				return fmt.Errorf("failed to save finding %s: %w", finding.Id, err)
+			}
+			changed++
+
+			if err := keepDecision(txApp, decisions, finding, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return changed, nil
+}
+
+// keepDecision copies the triage fields of a finding to its fingerprint, loading each
+// fingerprint once per transaction
+func keepDecision(app core.App, decisions map[string]*core.Record, finding *core.Record, triagedAt time.Time) error {
+	value := finding.GetString("fingerprint")
+	if value == "" {
+		return nil
+	}
+
+	record, ok := decisions[value]
+	if !ok {
+		found, err := app.FindFirstRecordByFilter(fingerprint.CollectionName, "fingerprint = {:fingerprint}", dbx.Params{"fingerprint": value})
+		if err != nil {
+			// Fingerprinted at the next start by the backfill
+			return nil
+		}
+		record = found
+		decisions[value] = record
+	}
+
+	for _, field := range Fields {
+		record.Set(field, finding.Get(field))
+	}
+	record.Set("triaged_at", triagedAt)
+	return app.Save(record)
+}
+
+// Inherit copies the latest decision on a fingerprint to a new finding with that
+// fingerprint. It reports whether the fingerprint had been triaged; when it had not, the
+// finding keeps the severity it was given and starts as new.
+func Inherit(finding *core.Record, decision *core.Record) bool {
+	if decision == nil || decision.GetDateTime("triaged_at").IsZero() {
+		return false
+	}
+	for _, field := range Fields {
+		value := decision.GetString(field)
+		if field == "severity" && value == "" {
+			continue
+		}
+		finding.Set(field, value)
+	}
+	finding.Set("triaged_at", decision.GetDateTime("triaged_at"))
+	return true
+}
+
+// Find returns the findings selected by record ids, fingerprints and unique keys, at most
+// limit of them. An error is returned when more match so a bulk change is never partial.
+func Find(app core.App, ids []string, fingerprints []string, uniqueKeys []string, limit int) ([]*core.Record, error) {
+	var conditions []dbx.Expression
+	if len(ids) > 0 {
+		conditions = append(conditions, dbx.In("id", anySlice(ids)...))
+	}
+	if len(fingerprints) > 0 {
+		conditions = append(conditions, dbx.In("fingerprint", anySlice(fingerprints)...))
+	}
+	if len(uniqueKeys) > 0 {
+		conditions = append(conditions, dbx.In("unique_key", anySlice(uniqueKeys)...))
+	}
+	if len(conditions) == 0 {
+		return nil, errors.New("select findings with ids, fingerprints or unique_keys")
+	}
+
+	records := []*core.Record{}
+	err := app.RecordQuery("findings").
+		AndWhere(dbx.Or(conditions...)).
+		OrderBy("created_at", "id").
+		Limit(int64(limit + 1)).
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > limit {
+		return nil, fmt.Errorf("more than %d findings selected, narrow the selection", limit)
+	}
+	return records, nil
+}
+
+// StatusExpression returns the condition selecting the fingerprints with a status.
+// Fingerprints that were never triaged have no status and count as new.
+func StatusExpression(status string) dbx.Expression {
+	if status == StatusNew {
+		return dbx.In("status", "", StatusNew)
+	}
+	return dbx.HashExp{"status": status}
+}
+
+// NewActor returns the actor of a request: the authenticated user, or the given name
+// ("api" when empty) for unauthenticated requests and superusers
+func NewActor(auth *core.Record, name string) Actor {
+	if auth != nil && auth.Collection().Name == UsersCollectionName {
+		return Actor{User: auth.Id, Name: auth.Email()}
+	}
+	if auth != nil && auth.Email() != "" {
+		return Actor{Name: auth.Email()}
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		return Actor{Name: name}
+	}
+	return Actor{Name: "api"}
+}
+
+func anySlice(values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
@@ -0,0 +1,86 @@
+// Package versioning keeps numbered content histories: every distinct hash seen for a
+// subject, such as a script URL or the page of an endpoint, is a version of that subject.
+package versioning
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxAttempts bounds the attempts to number a new version when workers race for it
+const maxAttempts = 3
+
+// Observe records that a subject had the content of the given hash. The subject is the set
+// of columns identifying it in the versions collection; fields are stored on a new version.
+// The first time a subject is seen with a hash a new version is added, numbered after the
+// latest one; afterwards only its last_seen timestamp moves forward.
+//
+// The versions collection must have unique indexes on the subject and hash, and on the
+// subject and version: a worker numbering the same version meanwhile makes Observe try again.
+func Observe(app core.App, collectionName string, subject dbx.HashExp, hash string, fields map[string]any) error {
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var found bool
+		if found, err = touch(app, collectionName, subject, hash); found || err != nil {
+			return err
+		}
+
+		err = app.RunInTransaction(func(txApp core.App) error {
+			collection, err := txApp.FindCollectionByNameOrId(collectionName)
+			if err != nil {
+				return err
+			}
+
+			var latest struct {
+				Version int `db:"version"`
+			}
+			err = txApp.DB().
+				Select("COALESCE(MAX(version), 0) AS version").
+				From(collectionName).
+				Where(subject).
+				One(&latest)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			record := core.NewRecord(collection)
+			for column, value := range subject {
+				record.Set(column, value)
+			}
+			for field, value := range fields {
+				record.Set(field, value)
+			}
+			record.Set("hash", hash)
+			record.Set("version", latest.Version+1)
+			record.Set("first_seen", now)
+			record.Set("last_seen", now)
+			return txApp.Save(record)
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("no version added after %d attempts: %w", maxAttempts, err)
+}
+
+// touch moves the last_seen timestamp of the version of a subject with the given hash
+// forward. It reports whether the version exists.
+func touch(app core.App, collectionName string, subject dbx.HashExp, hash string) (bool, error) {
+	conditions := dbx.HashExp{"hash": hash}
+	for column, value := range subject {
+		conditions[column] = value
+	}
+
+	record := &core.Record{}
+	err := app.RecordQuery(collectionName).Where(conditions).Limit(1).One(record)
+	if err != nil {
+		return false, nil
+	}
+
+	record.Set("last_seen", time.Now())
+	return true, app.Save(record)
+}
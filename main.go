@@ -1,10 +1,6 @@
 package main
 
 import (
-	"os"
-	"os/signal"
-	"syscall"
-
 	"github.com/jsh-team/jshunter/cmd"
 
 	_ "github.com/jsh-team/jshunter/internal/db"
@@ -27,15 +23,6 @@ func main() {
 	// Set version information in cmd package
 	cmd.SetVersion(Version, BuildTime, GitCommit)
 
-	// Set up signal handling for immediate shutdown
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-signalChan
-		os.Exit(0)
-	}()
-
 	m.Register(func(app core.App) error {
 		superusers, err := app.FindCollectionByNameOrId(core.CollectionNameSuperusers)
 		if err != nil {
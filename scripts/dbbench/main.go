@@ -0,0 +1,229 @@
+// Command dbbench measures the database lookups of the workers on a seeded target, with and
+// without the lookup indexes, and the cost of saving findings one row at a time versus in
+// one transaction. The lookups are the script and chunk deduplication and the status scans
+// of the shutdown and the startup recovery.
+//
+// It creates a throwaway database in a temporary directory, runs the migrations, seeds it
+// with js_files and prints the timings:
+//
+//	go run ./scripts/dbbench
+//	go run ./scripts/dbbench -files 100000 -lookups 200 -findings 2000
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/jsh-team/jshunter/internal/db"
+	"github.com/jsh-team/jshunter/internal/utils/hash"
+	"github.com/jsh-team/jshunter/internal/workers/analysis"
+	"github.com/jsh-team/jshunter/internal/workers/pool"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+var (
+	files    = flag.Int("files", 100000, "js_files seeded in the database")
+	lookups  = flag.Int("lookups", 200, "Lookups timed for each query")
+	findings = flag.Int("findings", 2000, "Findings saved for each way of saving them")
+)
+
+func main() {
+	flag.Parse()
+
+	dataDir, err := os.MkdirTemp("", "jshunter-dbbench-*")
+	if err != nil {
+		fail(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: dataDir})
+	if err := app.Bootstrap(); err != nil {
+		fail(err)
+	}
+	if err := app.RunAllMigrations(); err != nil {
+		fail(err)
+	}
+
+	start := time.Now()
+	if err := seed(app, *files); err != nil {
+		fail(err)
+	}
+	fmt.Printf("Seeded %d js_files in %v\n\n", *files, time.Since(start).Round(time.Millisecond))
+
+	fmt.Printf("%-40s %12s %12s\n", "QUERY", "INDEXED", "NO INDEXES")
+	indexed := runLookups(app)
+	if err := dropIndexes(app); err != nil {
+		fail(err)
+	}
+	plain := runLookups(app)
+	for i, result := range indexed {
+		fmt.Printf("%-40s %12v %12v\n", result.name, result.elapsed.Round(time.Microsecond), plain[i].elapsed.Round(time.Microsecond))
+	}
+
+	fmt.Println()
+	saves, err := saveFindings(app, *findings)
+	if err != nil {
+		fail(err)
+	}
+	for _, result := range saves {
+		fmt.Printf("%-40s %12v\n", result.name, result.elapsed.Round(time.Millisecond))
+	}
+}
+
+// seed inserts js_files with distinct URLs and hashes, one in a thousand being analyzed
+func seed(app core.App, count int) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		now := time.Now().UTC().Format("2006-01-02 15:04:05.000Z")
+		for i := 0; i < count; i++ {
+			status := pool.StatusProcessed
+			if i%1000 == 0 {
+				status = pool.StatusProcessing
+			}
+			_, err := txApp.DB().Insert("js_files", dbx.Params{
+				"id":               security.RandomString(15),
+				"url":              fileURL(i),
+				"hash":             hash.GenerateSha256Hash(fileURL(i)),
+				"prettify_status":  pool.StatusProcessed,
+				"analysis_status":  status,
+				"dechunker_status": pool.StatusProcessed,
+				"sourcemap_status": pool.StatusProcessed,
+				"created_at":       now,
+			}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func fileURL(i int) string {
+	return fmt.Sprintf("https://cdn.example.com/static/js/%d.%x.js", i, i*7919)
+}
+
+type timing struct {
+	name    string
+	elapsed time.Duration
+}
+
+// runLookups times the queries run by the workers for every script and at startup
+func runLookups(app core.App) []timing {
+	timeIt := func(name string, query func(i int)) timing {
+		start := time.Now()
+		for i := 0; i < *lookups; i++ {
+			query(i * (*files / *lookups))
+		}
+		return timing{name: fmt.Sprintf("%d %s", *lookups, name), elapsed: time.Since(start)}
+	}
+
+	return []timing{
+		timeIt("dedupe lookups by hash", func(i int) {
+			app.FindFirstRecordByFilter("js_files", "hash = {:hash}", dbx.Params{"hash": hash.GenerateSha256Hash(fileURL(i))})
+		}),
+		timeIt("dedupe lookups by url", func(i int) {
+			app.FindFirstRecordByFilter("js_files", "url = {:url}", dbx.Params{"url": fileURL(i)})
+		}),
+		// Shutdown and recovery look up the records of a stage by status
+		timeIt("status scans", func(int) {
+			var ids []string
+			app.DB().Select("id").From("js_files").Where(dbx.HashExp{"analysis_status": pool.StatusProcessing}).Column(&ids)
+		}),
+	}
+}
+
+// dropIndexes removes the lookup indexes of js_files, leaving the table as before them
+func dropIndexes(app core.App) error {
+	var names []string
+	err := app.DB().
+		Select("name").
+		From("sqlite_master").
+		Where(dbx.HashExp{"type": "index", "tbl_name": "js_files"}).
+		Column(&names)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "idx_") {
+			continue
+		}
+		if _, err := app.DB().NewQuery("DROP INDEX " + name).Execute(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveFindings times saving findings one record at a time, as the analysis did before, the
+// same records in one transaction, and analysis.SaveFindings, which also fingerprints them
+func saveFindings(app *pocketbase.PocketBase, count int) ([]timing, error) {
+	var jsFileIDs []string
+	if err := app.DB().Select("id").From("js_files").Limit(3).Column(&jsFileIDs); err != nil {
+		return nil, err
+	}
+	collection, err := app.FindCollectionByNameOrId("findings")
+	if err != nil {
+		return nil, err
+	}
+
+	batch := make([]analysis.Finding, count)
+	for i := range batch {
+		batch[i] = analysis.Finding{
+			Type:   "url",
+			Line:   i + 1,
+			Column: 1,
+			Value:  fmt.Sprintf("/api/v1/resource/%d", i),
+			Data:   map[string]any{"finding_category": "httpapi"},
+		}
+	}
+	save := func(txApp core.App, jsFileID string) error {
+		for _, finding := range batch {
+			record := core.NewRecord(collection)
+			record.Set("type", finding.Type)
+			record.Set("line", finding.Line)
+			record.Set("column", finding.Column)
+			record.Set("value", finding.Value)
+			record.Set("js_file", jsFileID)
+			record.Set("metadata", finding.Data)
+			record.Set("created_at", time.Now())
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var results []timing
+	start := time.Now()
+	if err := save(app, jsFileIDs[0]); err != nil {
+		return nil, err
+	}
+	results = append(results, timing{fmt.Sprintf("%d findings saved per row", count), time.Since(start)})
+
+	start = time.Now()
+	err = app.RunInTransaction(func(txApp core.App) error {
+		return save(txApp, jsFileIDs[1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, timing{fmt.Sprintf("%d findings saved in a transaction", count), time.Since(start)})
+
+	start = time.Now()
+	if _, err := analysis.SaveFindings(app, jsFileIDs[2], batch); err != nil {
+		return nil, err
+	}
+	results = append(results, timing{fmt.Sprintf("%d findings by SaveFindings", count), time.Since(start)})
+	return results, nil
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	os.Exit(1)
+}